@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jmcgill/formation/core"
+	"gopkg.in/yaml.v2"
+)
+
+// Account is an AWS account listed in an -accounts file. Credentials for the account come from a named profile,
+// by assuming a role, or both (in which case the profile is used to assume the role).
+//
+//	accounts:
+//	  - name: production
+//	    assume_role_arn: arn:aws:iam::123456789012:role/formation
+//	    regions: [us-east-1, eu-west-1]
+//	  - name: staging
+//	    profile: staging
+type Account struct {
+	Name string `yaml:"name"`
+
+	Profile       string `yaml:"profile"`
+	AssumeRoleARN string `yaml:"assume_role_arn"`
+	ExternalID    string `yaml:"external_id"`
+	SessionName   string `yaml:"session_name"`
+
+	// Optional. Overrides -regions for this account.
+	Regions []string `yaml:"regions"`
+
+	// Optional. The directory to write configuration and state to, which defaults to the name of the account.
+	OutputDir string `yaml:"output_dir"`
+
+	// Optional. An existing tfstate file to merge this account's resources into.
+	TFState string `yaml:"tfstate"`
+}
+
+type accountsFile struct {
+	Accounts []*Account `yaml:"accounts"`
+}
+
+// ReadAccounts reads and validates the list of accounts in path.
+func ReadAccounts(path string) ([]*Account, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file accountsFile
+	if err := yaml.UnmarshalStrict(contents, &file); err != nil {
+		return nil, err
+	}
+
+	if len(file.Accounts) == 0 {
+		return nil, fmt.Errorf("%s does not list any accounts", path)
+	}
+
+	if err := validateAccounts(file.Accounts); err != nil {
+		return nil, err
+	}
+	return file.Accounts, nil
+}
+
+// Check that every account can be imported, and fill in the default output directory of each.
+func validateAccounts(accounts []*Account) error {
+	names := make(map[string]bool)
+	dirs := make(map[string]bool)
+	for i, account := range accounts {
+		if account.Name == "" {
+			return fmt.Errorf("account %d has no name", i+1)
+		}
+		if names[account.Name] {
+			return fmt.Errorf("account %s is listed more than once", account.Name)
+		}
+		names[account.Name] = true
+
+		if account.Profile == "" && account.AssumeRoleARN == "" {
+			return fmt.Errorf("account %s needs a profile or an assume_role_arn", account.Name)
+		}
+
+		if account.OutputDir == "" {
+			account.OutputDir = account.Name
+		}
+		if dirs[account.OutputDir] {
+			return fmt.Errorf("account %s shares output directory %s with another account", account.Name, account.OutputDir)
+		}
+		dirs[account.OutputDir] = true
+	}
+	return nil
+}
+
+// The settings which select this account's credentials, in the form accepted by the provider configuration.
+func (a *Account) providerSettings() map[string]interface{} {
+	settings := make(map[string]interface{})
+	if a.Profile != "" {
+		settings["profile"] = a.Profile
+	}
+
+	if a.AssumeRoleARN != "" {
+		assumeRole := map[string]interface{}{
+			"role_arn": a.AssumeRoleARN,
+		}
+		if a.ExternalID != "" {
+			assumeRole["external_id"] = a.ExternalID
+		}
+		if a.SessionName != "" {
+			assumeRole["session_name"] = a.SessionName
+		}
+		settings["assume_role"] = []interface{}{assumeRole}
+	}
+
+	return settings
+}
+
+// The same settings as providerSettings, as fields of a provider block.
+func (a *Account) providerFields() []*core.Field {
+	var fields []*core.Field
+	if a.Profile != "" {
+		fields = append(fields, stringField("profile", a.Profile))
+	}
+
+	if a.AssumeRoleARN != "" {
+		assumeRole := &core.InlineResource{}
+		assumeRole.Append(stringField("role_arn", a.AssumeRoleARN))
+		if a.ExternalID != "" {
+			assumeRole.Append(stringField("external_id", a.ExternalID))
+		}
+		if a.SessionName != "" {
+			assumeRole.Append(stringField("session_name", a.SessionName))
+		}
+
+		fields = append(fields, &core.Field{
+			FieldType: core.LIST,
+			Key:       "assume_role",
+			NestedValue: &core.InlineResource{
+				Fields: []*core.Field{
+					{
+						FieldType:   core.NESTED,
+						NestedValue: assumeRole,
+					},
+				},
+			},
+		})
+	}
+
+	return fields
+}
+
+func stringField(key string, value string) *core.Field {
+	return &core.Field{
+		FieldType:   core.SCALAR,
+		Key:         key,
+		ScalarValue: core.NewScalarValue(value, core.TypeString),
+	}
+}
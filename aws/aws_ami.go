@@ -1,6 +1,9 @@
 package aws
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/jmcgill/formation/core"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/hashicorp/terraform/config/configschema"
@@ -9,13 +12,34 @@ import (
 )
 
 type AwsAmiImporter struct {
+	// The owners of the images to import. Defaults to the images owned by this account.
+	owners []string
 }
 
-func (*AwsAmiImporter) Describe(meta interface{}) ([]*core.Instance, error) {
+// Configure accepts an owners option: a comma separated list of the account IDs or aliases (e.g.
+// self,123456789012) whose images are imported.
+func (i *AwsAmiImporter) Configure(options map[string]string) error {
+	for key, value := range options {
+		switch key {
+		case "owners":
+			i.owners = strings.Split(value, ",")
+		default:
+			return fmt.Errorf("unknown option %s", key)
+		}
+	}
+	return nil
+}
+
+func (i *AwsAmiImporter) Describe(meta interface{}) ([]*core.Instance, error) {
 	svc :=  meta.(*AWSClient).ec2conn
 
+	owners := i.owners
+	if len(owners) == 0 {
+		owners = []string{"self"}
+	}
+
 	input := ec2.DescribeImagesInput{
-		Owners: []*string{aws.String("self")},
+		Owners: aws.StringSlice(owners),
 	}
 
 	result, err := svc.DescribeImages(&input)
@@ -42,6 +42,11 @@ func (*AwsAutoscalingGroupImporter) Links() map[string]string {
 	return map[string]string{
 		"placement_group": "aws_placement_group.id",
 		"launch_configuration": "aws_launch_configuration.name",
-		"initial_lifecycle_hook.role_arn": "aws_role.arn",
+		"initial_lifecycle_hook.role_arn": "aws_iam_role.arn",
 	}
 }
+
+// desired_capacity changes whenever the group scales
+func (*AwsAutoscalingGroupImporter) IgnoreChanges() []string {
+	return []string{"desired_capacity"}
+}
@@ -25,6 +25,7 @@ func (*AwsCustomerGatewayImporter) Describe(meta interface{}) ([]*core.Instance,
 		instances[i] = &core.Instance{
 			Name: namer.NameOrDefault(existingInstance.Tags, existingInstance.CustomerGatewayId),
 			ID:   aws.StringValue(existingInstance.CustomerGatewayId),
+			Tags: tagsOf(existingInstance.Tags),
 		}
 	}
 
@@ -32,6 +32,7 @@ func (*AwsEbsVolumeImporter) Describe(meta interface{}) ([]*core.Instance, error
 		instances[i] = &core.Instance{
 			Name: namer.NameOrDefault(existingInstance.Tags, existingInstance.VolumeId),
 			ID:   aws.StringValue(existingInstance.VolumeId),
+			Tags: tagsOf(existingInstance.Tags),
 		}
 	}
 
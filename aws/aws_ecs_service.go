@@ -96,7 +96,12 @@ func (*AwsEcsServiceImporter) Links() map[string]string {
 		"iam_role":                              "aws_iam_role.arn",
 		"load_balancer.elb_name":                "aws_elb.name",
 		"load_balancer.target_group_arn":        "aws_alb_target_group.arn",
-		"network_configuration.subnet":          "aws_subnet.id",
+		"network_configuration.subnets":         "aws_subnet.id",
 		"network_configuration.security_groups": "aws_security_group.id",
 	}
 }
+
+// task_definition names a revision, which changes with every deployment made outside of Terraform
+func (*AwsEcsServiceImporter) IgnoreChanges() []string {
+	return []string{"task_definition"}
+}
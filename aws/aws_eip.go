@@ -51,7 +51,6 @@ func (*AwsEipImporter) AdjustSchema(in *configschema.Block) *configschema.Block
 func (*AwsEipImporter) Links() map[string]string {
 	return map[string]string{
 		"instance": "aws_instance.id",
-		"subnet_id": "aws_subnet.id",
 		"network_interface": "aws_network_interface.id",
 	}
 }
@@ -58,7 +58,7 @@ func (*AwsIamGroupMembershipImporter) Clean(in *terraform.InstanceState, meta in
 // Describes which other resources this resource can reference
 func (*AwsIamGroupMembershipImporter) Links() map[string]string {
 	return map[string]string{
-		"group": "aws_iam_group.group.name",
+		"group": "aws_iam_group.name",
 		"users": "aws_iam_user.name",
 	}
 }
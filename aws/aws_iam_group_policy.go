@@ -80,3 +80,8 @@ func (*AwsIamGroupPolicyImporter) Links() map[string]string {
 		"group": "aws_iam_group.name",
 	}
 }
+
+// Attributes which hold an IAM policy document
+func (*AwsIamGroupPolicyImporter) PolicyAttributes() []string {
+	return []string{"policy"}
+}
@@ -1,21 +1,45 @@
 package aws
 
 import (
+	"fmt"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/jmcgill/formation/core"
 )
 
 type AwsIamPolicyImporter struct {
+	// Which policies to import: Local (the default), AWS or All
+	scope string
+}
+
+// Configure accepts a scope option: Local to import customer managed policies, AWS for AWS managed policies,
+// or All.
+func (i *AwsIamPolicyImporter) Configure(options map[string]string) error {
+	for key, value := range options {
+		switch key {
+		case "scope":
+			if value != iam.PolicyScopeTypeLocal && value != iam.PolicyScopeTypeAws && value != iam.PolicyScopeTypeAll {
+				return fmt.Errorf("invalid scope %s, expected Local, AWS or All", value)
+			}
+			i.scope = value
+		default:
+			return fmt.Errorf("unknown option %s", key)
+		}
+	}
+	return nil
 }
 
 // Lists all resources of this type
-func (*AwsIamPolicyImporter) Describe(meta interface{}) ([]*core.Instance, error) {
+func (i *AwsIamPolicyImporter) Describe(meta interface{}) ([]*core.Instance, error) {
 	svc := meta.(*AWSClient).iamconn
 
 	// Add code to list resources here
 	existingInstances := make([]*iam.Policy, 0)
-	scope := "Local"
+	scope := iam.PolicyScopeTypeLocal
+	if i.scope != "" {
+		scope = i.scope
+	}
 	input := &iam.ListPoliciesInput{
 		Scope: &scope,
 	}
@@ -45,3 +69,8 @@ func (*AwsIamPolicyImporter) Describe(meta interface{}) ([]*core.Instance, error
 func (*AwsIamPolicyImporter) Links() map[string]string {
 	return map[string]string{}
 }
+
+// Attributes which hold an IAM policy document
+func (*AwsIamPolicyImporter) PolicyAttributes() []string {
+	return []string{"policy"}
+}
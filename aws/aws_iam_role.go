@@ -41,3 +41,8 @@ func (*AwsIamRoleImporter) Describe(meta interface{}) ([]*core.Instance, error)
 func (*AwsIamRoleImporter) Links() map[string]string {
 	return map[string]string{}
 }
+
+// Attributes which hold an IAM policy document
+func (*AwsIamRoleImporter) PolicyAttributes() []string {
+	return []string{"assume_role_policy"}
+}
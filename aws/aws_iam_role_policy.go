@@ -59,3 +59,8 @@ func (*AwsIamRolePolicyImporter) Links() map[string]string {
 		"role": "aws_iam_role.id",
 	}
 }
+
+// Attributes which hold an IAM policy document
+func (*AwsIamRolePolicyImporter) PolicyAttributes() []string {
+	return []string{"policy"}
+}
@@ -81,3 +81,8 @@ func (*AwsIamUserPolicyImporter) Links() map[string]string {
 		"user": "aws_iam_user.name",
 	}
 }
+
+// Attributes which hold an IAM policy document
+func (*AwsIamUserPolicyImporter) PolicyAttributes() []string {
+	return []string{"policy"}
+}
@@ -41,6 +41,7 @@ func (*AwsInstanceImporter) Describe(meta interface{}) ([]*core.Instance, error)
 		instances = append(instances, &core.Instance{
 			Name: namer.NameOrDefault(existingInstance.Tags, existingInstance.InstanceId),
 			ID:   aws.StringValue(existingInstance.InstanceId),
+			Tags: tagsOf(existingInstance.Tags),
 		})
 	}
 
@@ -96,18 +97,22 @@ func (*AwsInstanceImporter) Clean(in *terraform.InstanceState, meta interface{})
 // Come back and check links once all resources are imported.
 func (*AwsInstanceImporter) Links() map[string]string {
 	return map[string]string{
-		"ami":               "aws_ami.id",
-		"availability_zone": "aws_availability_zone.name",
-		"placement_group":   "aws_placement_group.id",
+		"ami":             "aws_ami.id",
+		"placement_group": "aws_placement_group.id",
 
-		// Should this be ARN or name? The documentation suggests
-		// name, but that is optional.
-		"security_groups":                        "aws_security_group.arn",
+		// security_groups holds the names of groups outside of a VPC,
+		// vpc_security_group_ids holds their IDs.
+		"security_groups":                        "aws_security_group.name",
 		"vpc_security_group_ids":                 "aws_security_group.id",
-		"subnet_id":                              "aws_subnet_id.id",
+		"subnet_id":                              "aws_subnet.id",
 		"iam_instance_profile":                   "aws_iam_instance_profile.name",
 		"ebs_block_device.device_name":           "aws_ebs_volume.id",
 		"ebs_block_device.snapshot_id":           "aws_ebs_snapshot.id",
 		"network_interface.network_interface_id": "aws_network_interface.id",
 	}
 }
+
+// user_data is held in state as a hash, so it cannot be written back in the encoding it was created with
+func (*AwsInstanceImporter) IgnoreChanges() []string {
+	return []string{"user_data"}
+}
@@ -26,6 +26,7 @@ func (*AwsInternetGatewayImporter) Describe(meta interface{}) ([]*core.Instance,
 		instances[i] = &core.Instance{
 			Name: namer.NameOrDefault(existingInstance.Tags, gatewayId),
 			ID:   aws.StringValue(existingInstance.InternetGatewayId),
+			Tags: tagsOf(existingInstance.Tags),
 		}
 	}
 
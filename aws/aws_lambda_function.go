@@ -87,3 +87,8 @@ func (*AwsLambdaFunctionImporter) Links() map[string]string {
 		"vpc_config.subnet_ids":         "aws_subnet.id",
 	}
 }
+
+// The deployment package is downloaded to filename, whose hash never matches the source_code_hash in state
+func (*AwsLambdaFunctionImporter) IgnoreChanges() []string {
+	return []string{"filename", "source_code_hash"}
+}
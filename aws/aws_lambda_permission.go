@@ -133,7 +133,7 @@ func (*AwsLambdaPermissionImporter) Clean(in *terraform.InstanceState, meta inte
 // Describes which other resources this resource can reference
 func (*AwsLambdaPermissionImporter) Links() map[string]string {
 	return map[string]string{
-		"function_name": "aws_lambda_function.name",
+		"function_name": "aws_lambda_function.function_name",
 		// Source ARN can be an s3 bucker OR a cloud watch event rule - need to support multiple
 		// "source_arn": ""
 	}
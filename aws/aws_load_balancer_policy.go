@@ -62,6 +62,6 @@ func (*AwsLoadBalancerPolicyImporter) Clean(in *terraform.InstanceState, meta in
 // Describes which other resources this resource can reference
 func (*AwsLoadBalancerPolicyImporter) Links() map[string]string {
 	return map[string]string{
-		"load_balancer": "aws_elb.name",
+		"load_balancer_name": "aws_elb.name",
 	}
 }
@@ -56,6 +56,7 @@ func (*AwsMainRouteTableAssociationImporter) Describe(meta interface{}) ([]*core
 		instances[i] = &core.Instance{
 			Name: vpcName,
 			ID:   aws.StringValue(associationId),
+			Tags: tagsOf(existingInstance.Tags),
 			CompositeID: map[string]string{
 				"vpc_id":         aws.StringValue(existingInstance.VpcId),
 				"route_table_id": aws.StringValue(existingInstance.RouteTableId),
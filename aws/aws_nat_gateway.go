@@ -32,6 +32,7 @@ func (*AwsNatGatewayImporter) Describe(meta interface{}) ([]*core.Instance, erro
 		instances[i] = &core.Instance{
 			Name: namer.NameOrDefault(existingInstance.Tags, existingInstance.NatGatewayId),
 			ID:   aws.StringValue(existingInstance.NatGatewayId),
+			Tags: tagsOf(existingInstance.Tags),
 		}
 	}
 
@@ -25,6 +25,7 @@ func (*AwsNetworkAclImporter) Describe(meta interface{}) ([]*core.Instance, erro
 		instances[i] = &core.Instance{
 			Name: namer.NameOrDefault(existingInstance.Tags, existingInstance.NetworkAclId),
 			ID:   aws.StringValue(existingInstance.NetworkAclId),
+			Tags: tagsOf(existingInstance.Tags),
 		}
 	}
 
@@ -42,6 +42,6 @@ func (*AwsRoute53HealthCheckImporter) Describe(meta interface{}) ([]*core.Instan
 func (*AwsRoute53HealthCheckImporter) Links() map[string]string {
 	return map[string]string{
 		"child_healthchecks":    "aws_route53_health_check.id",
-		"cloudwatch_alarm_name": "aws_cloudwatch_metric_alarm.name",
+		"cloudwatch_alarm_name": "aws_cloudwatch_metric_alarm.alarm_name",
 	}
 }
@@ -24,6 +24,7 @@ func (*AwsRouteTableImporter) Describe(meta interface{}) ([]*core.Instance, erro
 		instances[i] = &core.Instance{
 			Name: namer.NameOrDefault(existingInstance.Tags, existingInstance.RouteTableId),
 			ID:   aws.StringValue(existingInstance.RouteTableId),
+			Tags: tagsOf(existingInstance.Tags),
 		}
 	}
 
@@ -35,9 +36,9 @@ func (*AwsRouteTableImporter) Links() map[string]string {
 	return map[string]string{
 		"vpc_id":                          "aws_vpc.id",
 		"route.instance_id":               "aws_instance.id",
-		"route.gateway_id":                "aws_gateway.id",
+		"route.gateway_id":                "aws_internet_gateway.id",
 		"route.nat_gateway_id":            "aws_nat_gateway.id",
-		"route.egress_only_gateway_id":    "aws_gateway.id",
+		"route.egress_only_gateway_id":    "aws_egress_only_internet_gateway.id",
 		"route.vpc_peering_connection_id": "aws_vpc_peering_connection.id",
 		"route.network_interface_id":      "aws_network_interface.id",
 	}
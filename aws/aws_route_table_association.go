@@ -32,6 +32,7 @@ func (*AwsRouteTableAssociationImporter) Describe(meta interface{}) ([]*core.Ins
 			instances = append(instances, &core.Instance{
 				Name: name,
 				ID:   aws.StringValue(association.RouteTableAssociationId),
+				Tags: tagsOf(table.Tags),
 				CompositeID: map[string]string{
 					"route_table_id": aws.StringValue(association.RouteTableId),
 				},
@@ -34,3 +34,8 @@ func (*AwsS3BucketImporter) Links() map[string]string {
 		"replication_configuration.rules.destination.bucket": "aws_s3_bucket.arn",
 	}
 }
+
+// Attributes which hold an IAM policy document
+func (*AwsS3BucketImporter) PolicyAttributes() []string {
+	return []string{"policy"}
+}
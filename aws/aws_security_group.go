@@ -39,6 +39,7 @@ func (*AwsSecurityGroupImporter) Describe(meta interface{}) ([]*core.Instance, e
 		instances[i] = &core.Instance{
 			Name: namer.NameOrDefault(existingInstance.Tags, existingInstance.GroupId),
 			ID:   aws.StringValue(existingInstance.GroupId),
+			Tags: tagsOf(existingInstance.Tags),
 		}
 	}
 
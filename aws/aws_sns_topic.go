@@ -43,3 +43,8 @@ func (*AwsSnsTopicImporter) Describe(meta interface{}) ([]*core.Instance, error)
 func (*AwsSnsTopicImporter) Links() map[string]string {
 	return map[string]string{}
 }
+
+// Attributes which hold an IAM policy document
+func (*AwsSnsTopicImporter) PolicyAttributes() []string {
+	return []string{"policy"}
+}
@@ -76,3 +76,8 @@ func (*AwsSnsTopicPolicyImporter) Clean(in *terraform.InstanceState, meta interf
 func (*AwsSnsTopicPolicyImporter) Links() map[string]string {
 	return map[string]string{}
 }
+
+// Attributes which hold an IAM policy document
+func (*AwsSnsTopicPolicyImporter) PolicyAttributes() []string {
+	return []string{"policy"}
+}
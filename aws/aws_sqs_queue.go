@@ -37,3 +37,8 @@ func (*AwsSqsQueueImporter) Links() map[string]string {
 		"kms_master_key_id": "aws_kms_key.key_id",
 	}
 }
+
+// Attributes which hold an IAM policy document
+func (*AwsSqsQueueImporter) PolicyAttributes() []string {
+	return []string{"policy"}
+}
@@ -50,3 +50,8 @@ func (*AwsSqsQueuePolicyImporter) Links() map[string]string {
 		"queue_url": "aws_sqs_queue.id",
 	}
 }
+
+// Attributes which hold an IAM policy document
+func (*AwsSqsQueuePolicyImporter) PolicyAttributes() []string {
+	return []string{"policy"}
+}
@@ -24,6 +24,7 @@ func (*AwsSubnetImporter) Describe(meta interface{}) ([]*core.Instance, error) {
 		instances[i] = &core.Instance{
 			Name: core.Format(aws.StringValue(existingInstance.SubnetId)),
 			ID:   aws.StringValue(existingInstance.SubnetId),
+			Tags: tagsOf(existingInstance.Tags),
 		}
 	}
 
@@ -33,7 +34,6 @@ func (*AwsSubnetImporter) Describe(meta interface{}) ([]*core.Instance, error) {
 // Describes which other resources this resource can reference
 func (*AwsSubnetImporter) Links() map[string]string {
 	return map[string]string{
-		"availability_zone": "aws_availability_zone.name",
-		"vpc_id":            "aws_vpc.id",
+		"vpc_id": "aws_vpc.id",
 	}
 }
@@ -24,6 +24,7 @@ func (*AwsVpcImporter) Describe(meta interface{}) ([]*core.Instance, error) {
 		instances[i] = &core.Instance{
 			Name: namer.NameOrDefault(existingInstance.Tags, existingInstance.VpcId),
 			ID:   aws.StringValue(existingInstance.VpcId),
+			Tags: tagsOf(existingInstance.Tags),
 		}
 	}
 
@@ -15,15 +15,19 @@ func isAWSErr(err error, code string, message string) bool {
 	return false
 }
 
-func retryOnAwsCode(code string, f func() (interface{}, error)) (interface{}, error) {
+// Call f, retrying for up to a minute while it fails with any of codes.
+func retryOnAwsCodes(codes []string, f func() (interface{}, error)) (interface{}, error) {
 	var resp interface{}
 	err := resource.Retry(1*time.Minute, func() *resource.RetryError {
 		var err error
 		resp, err = f()
 		if err != nil {
-			awsErr, ok := err.(awserr.Error)
-			if ok && awsErr.Code() == code {
-				return resource.RetryableError(err)
+			if awsErr, ok := err.(awserr.Error); ok {
+				for _, code := range codes {
+					if awsErr.Code() == code {
+						return resource.RetryableError(err)
+					}
+				}
 			}
 			return resource.NonRetryableError(err)
 		}
@@ -198,6 +198,19 @@ func (c *AWSClient) IsChinaCloud() bool {
 	return false
 }
 
+// The account, partition and region this client imports from
+func (c *AWSClient) AccountID() string {
+	return c.accountid
+}
+
+func (c *AWSClient) Partition() string {
+	return c.partition
+}
+
+func (c *AWSClient) Region() string {
+	return c.region
+}
+
 // Client configures and returns a fully initialized AWSClient
 func (c *Config) Client() (interface{}, error) {
 	// Get the auth and region. This can fail if keys/regions were not
@@ -0,0 +1,125 @@
+package aws
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/jmcgill/formation/core"
+)
+
+// LinkProblem describes a link declared by an importer which does not match the provider schema.
+type LinkProblem struct {
+	// The resource type of the importer which declared the link
+	Type string
+
+	Source  string
+	Target  string
+	Problem string
+}
+
+func (p *LinkProblem) String() string {
+	return fmt.Sprintf("%s: %s -> %s: %s", p.Type, p.Source, p.Target, p.Problem)
+}
+
+// LintLinks checks the Links() of every importer against the schema of provider. Every source must be an
+// attribute of the importer's resource type, and every target must be an attribute of another resource type
+// which is either computed or identifies that resource. Problems are returned in a stable order.
+func LintLinks(importers map[string]core.Importer, provider *schema.Provider) []*LinkProblem {
+	var problems []*LinkProblem
+
+	resourceTypes := make([]string, 0, len(importers))
+	for resourceType := range importers {
+		resourceTypes = append(resourceTypes, resourceType)
+	}
+	sort.Strings(resourceTypes)
+
+	for _, resourceType := range resourceTypes {
+		links := importers[resourceType].Links()
+
+		sources := make([]string, 0, len(links))
+		for source := range links {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		for _, source := range sources {
+			target := links[source]
+			problem := func(format string, a ...interface{}) {
+				problems = append(problems, &LinkProblem{
+					Type:    resourceType,
+					Source:  source,
+					Target:  target,
+					Problem: fmt.Sprintf(format, a...),
+				})
+			}
+
+			resource, ok := provider.ResourcesMap[resourceType]
+			if !ok {
+				problem("unknown resource type %s", resourceType)
+				continue
+			}
+
+			if _, err := lookupAttribute(resource.Schema, source); err != nil {
+				problem("unknown source attribute: %s", err)
+			}
+
+			parts := strings.SplitN(target, ".", 2)
+			if len(parts) != 2 {
+				problem("target must be of the form type.attribute")
+				continue
+			}
+
+			targetResource, ok := provider.ResourcesMap[parts[0]]
+			if !ok {
+				problem("unknown target resource type %s", parts[0])
+				continue
+			}
+
+			// Every resource has an id, even though it is not part of the schema
+			if parts[1] == "id" {
+				continue
+			}
+
+			attribute, err := lookupAttribute(targetResource.Schema, parts[1])
+			if err != nil {
+				problem("unknown target attribute: %s", err)
+				continue
+			}
+
+			if !isIdentifier(parts[1], attribute) {
+				problem("target %s is neither computed nor an identifier", parts[1])
+			}
+		}
+	}
+
+	return problems
+}
+
+// Walk a dotted path, without list indexes, through nested resources in a schema.
+func lookupAttribute(s map[string]*schema.Schema, path string) (*schema.Schema, error) {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		attribute, ok := s[part]
+		if !ok {
+			return nil, fmt.Errorf("no attribute %s", strings.Join(parts[:i+1], "."))
+		}
+
+		if i == len(parts)-1 {
+			return attribute, nil
+		}
+
+		nested, ok := attribute.Elem.(*schema.Resource)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a nested block", strings.Join(parts[:i+1], "."))
+		}
+		s = nested.Schema
+	}
+	return nil, fmt.Errorf("empty path")
+}
+
+// An attribute which cannot change without replacing the resource (such as a name) identifies that resource.
+func isIdentifier(name string, attribute *schema.Schema) bool {
+	return attribute.Computed || attribute.ForceNew || name == "name" || name == "arn"
+}
@@ -0,0 +1,52 @@
+package aws_test
+
+import (
+	. "github.com/jmcgill/formation/aws"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/jmcgill/formation/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	aws2 "github.com/terraform-providers/terraform-provider-aws/aws"
+)
+
+type linksOnlyImporter struct {
+	links map[string]string
+}
+
+func (*linksOnlyImporter) Describe(meta interface{}) ([]*core.Instance, error) {
+	return nil, nil
+}
+
+func (i *linksOnlyImporter) Links() map[string]string {
+	return i.links
+}
+
+var _ = Describe("LintLinks", func() {
+	provider := aws2.Provider().(*schema.Provider)
+
+	It("should accept the links declared by every importer", func() {
+		Expect(LintLinks(Importers(), provider)).To(BeEmpty())
+	})
+
+	It("should report links which do not match the provider schema", func() {
+		importers := map[string]core.Importer{
+			"aws_instance": &linksOnlyImporter{
+				links: map[string]string{
+					"subnet_id":                              "aws_subnet_id.id",
+					"no_such_attribute":                      "aws_subnet.id",
+					"ebs_block_device.snapshot_id":           "aws_ebs_snapshot.no_such_attribute",
+					"vpc_security_group_ids":                 "aws_security_group.revoke_rules_on_delete",
+					"network_interface.network_interface_id": "aws_network_interface.id",
+				},
+			},
+		}
+
+		problems := LintLinks(importers, provider)
+		Expect(problems).To(HaveLen(4))
+		Expect(problems[0].String()).To(Equal("aws_instance: ebs_block_device.snapshot_id -> aws_ebs_snapshot.no_such_attribute: unknown target attribute: no attribute no_such_attribute"))
+		Expect(problems[1].String()).To(Equal("aws_instance: no_such_attribute -> aws_subnet.id: unknown source attribute: no attribute no_such_attribute"))
+		Expect(problems[2].String()).To(Equal("aws_instance: subnet_id -> aws_subnet_id.id: unknown target resource type aws_subnet_id"))
+		Expect(problems[3].String()).To(Equal("aws_instance: vpc_security_group_ids -> aws_security_group.revoke_rules_on_delete: target revoke_rules_on_delete is neither computed nor an identifier"))
+	})
+})
@@ -0,0 +1,85 @@
+package aws
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// DescribeVpc returns the attributes of a VPC which identify it without its ID: default, cidr_block and the Name
+// tag as tags.Name.
+func DescribeVpc(meta interface{}, id string) (map[string]string, error) {
+	svc := meta.(*AWSClient).ec2conn
+
+	result, err := svc.DescribeVpcs(&ec2.DescribeVpcsInput{
+		VpcIds: []*string{aws.String(id)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Vpcs) != 1 {
+		return nil, fmt.Errorf("VPC %s not found", id)
+	}
+	vpc := result.Vpcs[0]
+
+	attributes := map[string]string{
+		"default":    fmt.Sprintf("%t", aws.BoolValue(vpc.IsDefault)),
+		"cidr_block": aws.StringValue(vpc.CidrBlock),
+	}
+	for _, tag := range vpc.Tags {
+		if aws.StringValue(tag.Key) == "Name" {
+			attributes["tags.Name"] = aws.StringValue(tag.Value)
+		}
+	}
+	return attributes, nil
+}
+
+// DescribeImage returns the attributes of an AMI which identify it without its ID: name, owner_id and
+// image_owner_alias (e.g. amazon), if it has one.
+func DescribeImage(meta interface{}, id string) (map[string]string, error) {
+	svc := meta.(*AWSClient).ec2conn
+
+	result, err := svc.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(id)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Images) != 1 {
+		return nil, fmt.Errorf("AMI %s not found", id)
+	}
+	image := result.Images[0]
+
+	attributes := map[string]string{
+		"name":     aws.StringValue(image.Name),
+		"owner_id": aws.StringValue(image.OwnerId),
+	}
+	if image.ImageOwnerAlias != nil {
+		attributes["image_owner_alias"] = aws.StringValue(image.ImageOwnerAlias)
+	}
+	return attributes, nil
+}
+
+// BucketRegion returns the region that a bucket was created in.
+func BucketRegion(meta interface{}, bucket string) (string, error) {
+	svc := meta.(*AWSClient).s3conn
+
+	result, err := svc.GetBucketLocation(&s3.GetBucketLocationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Buckets in us-east-1 have no location constraint, and the oldest buckets in eu-west-1 have the constraint EU
+	switch region := aws.StringValue(result.LocationConstraint); region {
+	case "":
+		return "us-east-1", nil
+	case "EU":
+		return "eu-west-1", nil
+	default:
+		return region, nil
+	}
+}
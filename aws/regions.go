@@ -0,0 +1,56 @@
+package aws
+
+import "strings"
+
+// Regions which can be imported by passing -regions all. GovCloud and China require separate credentials, so
+// they are only imported when named explicitly.
+var allRegions = []string{
+	"ap-northeast-1",
+	"ap-northeast-2",
+	"ap-south-1",
+	"ap-southeast-1",
+	"ap-southeast-2",
+	"ca-central-1",
+	"eu-central-1",
+	"eu-west-1",
+	"eu-west-2",
+	"sa-east-1",
+	"us-east-1",
+	"us-east-2",
+	"us-west-1",
+	"us-west-2",
+}
+
+func AllRegions() []string {
+	return append([]string(nil), allRegions...)
+}
+
+var regionAbbreviations = map[string]string{
+	"north":     "n",
+	"northeast": "ne",
+	"northwest": "nw",
+	"south":     "s",
+	"southeast": "se",
+	"southwest": "sw",
+	"east":      "e",
+	"west":      "w",
+	"central":   "c",
+}
+
+// RegionAlias returns a short name for a region which can be used as a provider alias, e.g. use1 for
+// us-east-1 and apse2 for ap-southeast-2.
+func RegionAlias(region string) string {
+	parts := strings.Split(region, "-")
+	for i, part := range parts {
+		if i == 0 || i == len(parts)-1 {
+			continue
+		}
+
+		if abbreviation, ok := regionAbbreviations[part]; ok {
+			parts[i] = abbreviation
+		} else {
+			parts[i] = part[:1]
+		}
+	}
+	return strings.Join(parts, "")
+}
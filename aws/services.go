@@ -0,0 +1,127 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The AWS service which serves each resource type, named after the corresponding connection in AWSClient.
+// Entries are matched in order, so more specific prefixes must come first. Resource types which do not match
+// any prefix are served by EC2.
+var servicePrefixes = []struct {
+	prefix  string
+	service string
+}{
+	{"aws_iam_", "iamconn"},
+	{"aws_route53_", "r53conn"},
+	{"aws_s3_", "s3conn"},
+	{"aws_sns_", "snsconn"},
+	{"aws_sqs_", "sqsconn"},
+	{"aws_lambda_", "lambdaconn"},
+	{"aws_db_", "rdsconn"},
+	{"aws_rds_", "rdsconn"},
+	{"aws_dynamodb_", "dynamodbconn"},
+	{"aws_ecs_", "ecsconn"},
+	{"aws_ecr_", "ecrconn"},
+	{"aws_appautoscaling_", "appautoscalingconn"},
+	{"aws_autoscaling_", "autoscalingconn"},
+	{"aws_launch_configuration", "autoscalingconn"},
+	{"aws_app_cookie_stickiness_policy", "elbconn"},
+	{"aws_lb_cookie_stickiness_policy", "elbconn"},
+	{"aws_lb_ssl_negotiation_policy", "elbconn"},
+	{"aws_load_balancer_", "elbconn"},
+	{"aws_proxy_protocol_policy", "elbconn"},
+	{"aws_elb", "elbconn"},
+	{"aws_alb", "elbv2conn"},
+	{"aws_lb", "elbv2conn"},
+	{"aws_cloudfront_", "cloudfrontconn"},
+	{"aws_cloudformation_", "cfconn"},
+	{"aws_cloudtrail", "cloudtrailconn"},
+	{"aws_cloudwatch_log_", "cloudwatchlogsconn"},
+	{"aws_cloudwatch_event_", "cloudwatcheventsconn"},
+	{"aws_cloudwatch_", "cloudwatchconn"},
+	{"aws_kms_", "kmsconn"},
+	{"aws_kinesis_firehose_", "firehoseconn"},
+	{"aws_kinesis_", "kinesisconn"},
+	{"aws_elasticache_", "elasticacheconn"},
+	{"aws_elasticsearch_", "esconn"},
+	{"aws_redshift_", "redshiftconn"},
+	{"aws_ssm_", "ssmconn"},
+	{"aws_wafregional_", "wafregionalconn"},
+	{"aws_waf_", "wafconn"},
+	{"aws_api_gateway_", "apigateway"},
+	{"aws_efs_", "efsconn"},
+	{"aws_emr_", "emrconn"},
+	{"aws_ses_", "sesConn"},
+}
+
+// Service returns the name of the AWS service used to import a resource type, e.g. ec2conn or iamconn.
+func Service(resourceType string) string {
+	for _, s := range servicePrefixes {
+		if strings.HasPrefix(resourceType, s.prefix) {
+			return s.service
+		}
+	}
+	return "ec2conn"
+}
+
+// Services which are not tied to a region. Resources served by these are only imported once, no matter how
+// many regions are imported. S3 is included because ListBuckets returns the buckets of every region, and bucket
+// names are unique across every region.
+var globalServices = map[string]bool{
+	"cloudfrontconn": true,
+	"iamconn":        true,
+	"r53conn":        true,
+	"s3conn":         true,
+}
+
+// IsGlobal returns true if resourceType belongs to a service which is not tied to a region.
+func IsGlobal(resourceType string) bool {
+	return globalServices[Service(resourceType)]
+}
+
+// Resource types which are imported once, along with global resources, but which each belong to the region of a
+// bucket. Buckets record their region in the region attribute of their state, and the other types are listed with
+// the attribute which names their bucket.
+var ownRegionTypes = map[string]string{
+	"aws_s3_bucket":              "",
+	"aws_s3_bucket_notification": "bucket",
+	"aws_s3_bucket_object":       "bucket",
+	"aws_s3_bucket_policy":       "bucket",
+}
+
+// HasOwnRegion returns true if each resource of resourceType belongs to the region of its bucket, rather than to
+// the region it was imported from.
+func HasOwnRegion(resourceType string) bool {
+	_, ok := ownRegionTypes[resourceType]
+	return ok
+}
+
+// ResourceRegion returns the region that a resource of a type which HasOwnRegion belongs to, given the attributes
+// of its refreshed state. The region of a bucket is only looked up if the state does not record it.
+func ResourceRegion(meta interface{}, resourceType string, attributes map[string]string) (string, error) {
+	if region := attributes["region"]; region != "" {
+		return region, nil
+	}
+
+	attribute, ok := ownRegionTypes[resourceType]
+	if !ok || attribute == "" || attributes[attribute] == "" {
+		return "", fmt.Errorf("%s does not record its region or its bucket", resourceType)
+	}
+	return BucketRegion(meta, attributes[attribute])
+}
+
+// Error codes returned by AWS when requests are being rate limited
+var throttlingCodes = []string{
+	"Throttling",
+	"ThrottlingException",
+	"RequestLimitExceeded",
+	"TooManyRequestsException",
+	"PriorRequestNotComplete",
+}
+
+// RetryOnThrottling calls f, backing off and retrying for as long as AWS reports that requests are being
+// throttled.
+func RetryOnThrottling(f func() (interface{}, error)) (interface{}, error) {
+	return retryOnAwsCodes(throttlingCodes, f)
+}
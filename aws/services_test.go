@@ -0,0 +1,31 @@
+package aws_test
+
+import (
+	. "github.com/jmcgill/formation/aws"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ResourceRegion", func() {
+	It("should give every bucket-scoped type its own region", func() {
+		for _, resourceType := range []string{"aws_s3_bucket", "aws_s3_bucket_notification", "aws_s3_bucket_object", "aws_s3_bucket_policy"} {
+			Expect(HasOwnRegion(resourceType)).To(BeTrue())
+		}
+		Expect(HasOwnRegion("aws_iam_role")).To(BeFalse())
+	})
+
+	It("should use the region recorded in state", func() {
+		region, err := ResourceRegion(nil, "aws_s3_bucket", map[string]string{"bucket": "logs", "region": "eu-west-1"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(region).To(Equal("eu-west-1"))
+	})
+
+	It("should fail for a resource which records neither its region nor its bucket", func() {
+		_, err := ResourceRegion(nil, "aws_s3_bucket", map[string]string{"bucket": "logs"})
+		Expect(err).Should(HaveOccurred())
+
+		_, err = ResourceRegion(nil, "aws_s3_bucket_policy", map[string]string{})
+		Expect(err).Should(HaveOccurred())
+	})
+})
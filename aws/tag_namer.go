@@ -34,3 +34,12 @@ func (n *tagNamer) NameOrDefault(tags []*ec2.Tag, otherwise *string) string {
 
 	return core.Format(name)
 }
+
+// The tags of an EC2 resource, as a map from key to value.
+func tagsOf(tags []*ec2.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, t := range tags {
+		m[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return m
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// CheckpointEntry records every refreshed InstanceState for a single discovered instance.
+type CheckpointEntry struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+
+	// core.Instance.Key() of the discovered instance
+	Key string `json:"key"`
+
+	States []*CheckpointState `json:"states"`
+}
+
+type CheckpointState struct {
+	ImportID string                   `json:"import_id"`
+	State    *terraform.InstanceState `json:"state"`
+}
+
+// Checkpoint persists each imported instance as soon as it has been refreshed, so that an interrupted import
+// can be resumed without importing those instances again. Each instance is stored as its own file, so that a
+// crash can never corrupt instances which have already been written.
+type Checkpoint struct {
+	dir string
+
+	mu      sync.Mutex
+	entries map[string]*CheckpointEntry
+}
+
+// OpenCheckpoint opens the checkpoint in dir. When resuming, existing entries are loaded, otherwise any
+// existing checkpoint is discarded.
+func OpenCheckpoint(dir string, resume bool) (*Checkpoint, error) {
+	c := &Checkpoint{
+		dir:     dir,
+		entries: make(map[string]*CheckpointEntry),
+	}
+
+	if !resume {
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := &CheckpointEntry{}
+		if err := json.Unmarshal(contents, entry); err != nil {
+			return nil, err
+		}
+		c.entries[checkpointKey(entry.Type, entry.Key)] = entry
+	}
+
+	return c, nil
+}
+
+func checkpointKey(resourceType string, key string) string {
+	return resourceType + "." + key
+}
+
+// Get returns the entry for an instance, if it has already been imported.
+func (c *Checkpoint) Get(resourceType string, key string) (*CheckpointEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[checkpointKey(resourceType, key)]
+	return entry, ok
+}
+
+// Save writes an entry to disk.
+func (c *Checkpoint) Save(entry *CheckpointEntry) error {
+	contents, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// Instance keys can contain any character, so files are named after a hash of the key
+	hash := sha1.Sum([]byte(checkpointKey(entry.Type, entry.Key)))
+	path := filepath.Join(c.dir, entry.Type+"-"+hex.EncodeToString(hash[:])+".json")
+
+	// Write to a temporary file first, so that a partially written entry is never loaded
+	if err := ioutil.WriteFile(path+".tmp", contents, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[checkpointKey(entry.Type, entry.Key)] = entry
+	return nil
+}
+
+// Remove deletes the checkpoint once it is no longer needed.
+func (c *Checkpoint) Remove() error {
+	return os.RemoveAll(c.dir)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"sort"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/jmcgill/formation/core"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds every setting of a Formation run. Settings are read from a YAML file passed with -config, and any
+// flag given on the command line overrides the file.
+//
+//	include: [aws_iam_*, aws_s3_bucket]
+//	exclude: [aws_iam_user_ssh_key]
+//	dependencies: true
+//	filters:
+//	  names: ["^prod-"]
+//	  tags: {team: payments}
+//	  exclude_tags: {environment: test}
+//	output:
+//	  dir: terraform
+//	  layout: single
+//	  format: json
+//	naming: id
+//	syntax: hcl2
+//	state_format: v4
+//	merge_policy: keep-existing
+//	regions: [us-east-1, eu-west-1]
+//	concurrency:
+//	  parallelism: 32
+//	  service_limits: {iamconn: 2}
+//	importers:
+//	  aws_iam_policy: {scope: All}
+//	ignore_changes:
+//	  aws_db_instance: [password]
+type Config struct {
+	// Resource types to import, which may contain wildcards. Every resource type is imported if empty.
+	Include []string `yaml:"include"`
+
+	// Resource types not to import, which may contain wildcards
+	Exclude []string `yaml:"exclude"`
+
+	// Also import every resource that an included resource references, directly or transitively
+	Dependencies bool `yaml:"dependencies"`
+
+	// Look up referenced resources which were not imported with data sources, rather than hard-coding their IDs
+	DataSources bool `yaml:"data_sources"`
+
+	// Refer to the account ID, region and partition in values through data sources, rather than literally
+	Template bool `yaml:"template"`
+
+	// Write IAM and resource policies as aws_iam_policy_document data sources
+	PolicyDocuments bool `yaml:"policy_documents"`
+
+	Filters FiltersConfig `yaml:"filters"`
+	Output  OutputConfig  `yaml:"output"`
+
+	// How resources are named: name (the name of the resource in AWS) or id (the ID used to import it)
+	Naming string `yaml:"naming"`
+
+	// hcl1 or hcl2, as for -syntax
+	Syntax string `yaml:"syntax"`
+
+	// v3, v4 or import, as for -state-format
+	StateFormat string `yaml:"state_format"`
+
+	// keep-existing, overwrite or fail, as for -merge-policy
+	MergePolicy string `yaml:"merge_policy"`
+
+	// State files, or directories of state files and configuration, whose resources are already managed by
+	// Terraform and are not imported again
+	Managed []string `yaml:"managed"`
+
+	// Regions to import. An empty list uses the region from the environment.
+	Regions []string `yaml:"regions"`
+
+	// Accounts to import, in the same form as an -accounts file
+	Accounts []*Account `yaml:"accounts"`
+
+	Concurrency ConcurrencyConfig `yaml:"concurrency"`
+
+	// Options for individual importers, keyed by resource type
+	Importers map[string]map[string]string `yaml:"importers"`
+
+	// Attributes to ignore changes to, keyed by resource type, in addition to those declared by each importer
+	IgnoreChanges map[string][]string `yaml:"ignore_changes"`
+}
+
+type FiltersConfig struct {
+	// Regular expressions, one of which must match the name of an instance
+	Names        []string `yaml:"names"`
+	ExcludeNames []string `yaml:"exclude_names"`
+
+	// The IDs of the instances to import
+	IDs        []string `yaml:"ids"`
+	ExcludeIDs []string `yaml:"exclude_ids"`
+
+	// Tags which every imported resource must have, and tags which no imported resource may have. An empty value
+	// matches any value of that tag.
+	Tags        map[string]string `yaml:"tags"`
+	ExcludeTags map[string]string `yaml:"exclude_tags"`
+}
+
+// Filter compiles the filters into a core.Filter.
+func (c *FiltersConfig) Filter() (*core.Filter, error) {
+	names, err := compilePatterns(c.Names)
+	if err != nil {
+		return nil, err
+	}
+
+	excludeNames, err := compilePatterns(c.ExcludeNames)
+	if err != nil {
+		return nil, err
+	}
+
+	return &core.Filter{
+		Names:        names,
+		IDs:          c.IDs,
+		Tags:         c.Tags,
+		ExcludeNames: excludeNames,
+		ExcludeIDs:   c.ExcludeIDs,
+		ExcludeTags:  c.ExcludeTags,
+	}, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name filter %s: %s", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+type OutputConfig struct {
+	// The directory to write configuration and state to. Accounts are written to subdirectories of this directory.
+	Dir string `yaml:"dir"`
+
+	// type writes one file per resource type (e.g. aws_vpc.tf), single writes all resources to main.tf
+	Layout string `yaml:"layout"`
+
+	// hcl writes .tf files, json writes .tf.json files, and both also writes .tf.json files to a json subdirectory
+	Format string `yaml:"format"`
+
+	// Skip resource types which already have a file in the output directory. Only applies to the type layout.
+	SkipExisting bool `yaml:"skip_existing"`
+}
+
+type ConcurrencyConfig struct {
+	Parallelism        int            `yaml:"parallelism"`
+	ServiceParallelism int            `yaml:"service_parallelism"`
+	ServiceLimits      map[string]int `yaml:"service_limits"`
+}
+
+// DefaultConfig returns the settings used when there is no configuration file.
+func DefaultConfig() *Config {
+	return &Config{
+		Output: OutputConfig{
+			Layout:       "type",
+			Format:       "hcl",
+			SkipExisting: true,
+		},
+		Naming:      "name",
+		Syntax:      "hcl1",
+		StateFormat: "v3",
+		MergePolicy: "overwrite",
+		Concurrency: ConcurrencyConfig{
+			Parallelism:        16,
+			ServiceParallelism: 4,
+			ServiceLimits:      make(map[string]int),
+		},
+		Importers: make(map[string]map[string]string),
+	}
+}
+
+// ReadConfig reads a configuration file. Settings which are not in the file keep their default values.
+func ReadConfig(filename string) (*Config, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	config := DefaultConfig()
+	if err := yaml.UnmarshalStrict(contents, config); err != nil {
+		return nil, err
+	}
+
+	if config.Accounts != nil {
+		if err := validateAccounts(config.Accounts); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// Validate checks the settings which are not checked when they are used.
+func (c *Config) Validate() error {
+	switch c.Naming {
+	case "name", "id":
+	default:
+		return fmt.Errorf("unknown naming strategy %s, expected name or id", c.Naming)
+	}
+
+	switch c.Output.Layout {
+	case "type", "single":
+	default:
+		return fmt.Errorf("unknown output layout %s, expected type or single", c.Output.Layout)
+	}
+
+	switch c.Output.Format {
+	case "hcl", "json", "both":
+	default:
+		return fmt.Errorf("unknown output format %s, expected hcl, json or both", c.Output.Format)
+	}
+
+	switch c.StateFormat {
+	case "v3", "v4", "import":
+	default:
+		return fmt.Errorf("unknown state format %s", c.StateFormat)
+	}
+
+	if c.Concurrency.Parallelism < 1 || c.Concurrency.ServiceParallelism < 1 {
+		return fmt.Errorf("parallelism must be a positive integer")
+	}
+
+	for _, pattern := range append(c.Include, c.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid resource type pattern %s", pattern)
+		}
+	}
+	return nil
+}
+
+// SelectImporters returns the importers which are included and not excluded, configured with their options.
+func (c *Config) SelectImporters(importers map[string]core.Importer) (map[string]core.Importer, error) {
+	selected := make(map[string]core.Importer)
+	for _, pattern := range c.Include {
+		matched := false
+		for resourceType, importer := range importers {
+			if ok, _ := path.Match(pattern, resourceType); ok {
+				selected[resourceType] = importer
+				matched = true
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("no importer for %s", pattern)
+		}
+	}
+
+	if len(c.Include) == 0 {
+		for resourceType, importer := range importers {
+			selected[resourceType] = importer
+		}
+	}
+
+	return c.configure(selected)
+}
+
+// DependencyImporters returns the importers for every resource type which the included importers may reference,
+// unless that type is excluded. Returns nothing unless Dependencies is set.
+func (c *Config) DependencyImporters(importers map[string]core.Importer, included map[string]core.Importer, provider *schema.Provider) (map[string]core.Importer, error) {
+	dependencies := make(map[string]core.Importer)
+	if !c.Dependencies {
+		return dependencies, nil
+	}
+
+	for _, resourceType := range DependencyTypes(importers, included, provider) {
+		dependencies[resourceType] = importers[resourceType]
+	}
+	return c.configure(dependencies)
+}
+
+// Remove excluded importers, and pass options to those that remain.
+func (c *Config) configure(selected map[string]core.Importer) (map[string]core.Importer, error) {
+	for _, pattern := range c.Exclude {
+		for resourceType := range selected {
+			if ok, _ := path.Match(pattern, resourceType); ok {
+				delete(selected, resourceType)
+			}
+		}
+	}
+
+	resourceTypes := make([]string, 0, len(c.Importers))
+	for resourceType := range c.Importers {
+		resourceTypes = append(resourceTypes, resourceType)
+	}
+	sort.Strings(resourceTypes)
+
+	for _, resourceType := range resourceTypes {
+		importer, ok := selected[resourceType]
+		if !ok {
+			continue
+		}
+
+		configurable, ok := importer.(core.ConfigurableImporter)
+		if !ok {
+			return nil, fmt.Errorf("%s does not accept any options", resourceType)
+		}
+
+		if err := configurable.Configure(c.Importers[resourceType]); err != nil {
+			return nil, fmt.Errorf("invalid options for %s: %s", resourceType, err)
+		}
+	}
+
+	return selected, nil
+}
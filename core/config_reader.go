@@ -0,0 +1,684 @@
+package core
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	hcl1 "github.com/hashicorp/hcl"
+	hcl1ast "github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	hcl2json "github.com/hashicorp/hcl2/hcl/json"
+	"github.com/hashicorp/hil"
+	hilast "github.com/hashicorp/hil/ast"
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/config/configschema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// ConfigReader reads back configuration written by the Printer, so that it can be compared with the state it was
+// printed from.
+//
+// configschema can build a decoder spec for a block itself, but it is built from the copies of hcl2 and cty
+// vendored by the Terraform package, which cannot be used from outside of it. Bodies are instead decoded here by
+// walking the schema, converting attribute types in the same way as SchemaType.
+type ConfigReader struct {
+	Syntax Syntax
+
+	// Returns the schema of a resource or data source type, or nil if it is not known. Resources without a schema
+	// are not decoded.
+	Schema func(resourceType string, dataSource bool) *configschema.Block
+}
+
+// ConfigResource is a resource or data source read back from configuration.
+type ConfigResource struct {
+	Type       string
+	Name       string
+	DataSource bool
+
+	// The body of the resource decoded against its schema, in the same form as Terraform 0.11's raw configuration:
+	// blocks are lists of maps, numbers are ints or float64s, and values which refer to anything else (another
+	// resource, or a data source) are config.UnknownVariableValue. Meta-arguments such as provider are left out.
+	Config map[string]interface{}
+
+	// Why the body could not be decoded, if it could not
+	Err error
+}
+
+// Address returns the address of the resource, e.g. aws_vpc.main or data.aws_vpc.main
+func (r *ConfigResource) Address() string {
+	if r.DataSource {
+		return "data." + r.Type + "." + r.Name
+	}
+	return r.Type + "." + r.Name
+}
+
+// ResourceConfig returns the body of the resource as a ResourceConfig, as Terraform 0.11 would pass it to the
+// provider. Values which are unknown are listed in ComputedKeys.
+func (r *ConfigResource) ResourceConfig() *terraform.ResourceConfig {
+	return &terraform.ResourceConfig{
+		ComputedKeys: unknownKeys("", r.Config),
+		Raw:          r.Config,
+		Config:       r.Config,
+	}
+}
+
+func unknownKeys(path string, value interface{}) []string {
+	var keys []string
+	switch v := value.(type) {
+	case string:
+		if v == config.UnknownVariableValue {
+			keys = append(keys, path)
+		}
+	case []interface{}:
+		for i, element := range v {
+			keys = append(keys, unknownKeys(joinPath(path, strconv.Itoa(i)), element)...)
+		}
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			keys = append(keys, unknownKeys(joinPath(path, key), v[key])...)
+		}
+	}
+	return keys
+}
+
+// Arguments which Terraform handles itself, rather than passing to the provider
+var metaArguments = []string{"provider", "count", "depends_on", "lifecycle"}
+
+// Read parses a file, and decodes every resource and data source in it. Files whose name ends in .json are read as
+// Terraform's JSON syntax. An error is only returned if the file cannot be parsed at all.
+func (r *ConfigReader) Read(filename string, src []byte) ([]*ConfigResource, error) {
+	if r.Syntax == HCL2 {
+		return r.readHCL2(filename, src)
+	}
+	// The HCL1 parser reads JSON as well
+	return r.readHCL1(src)
+}
+
+func (r *ConfigReader) schema(resource *ConfigResource) *configschema.Block {
+	if r.Schema == nil {
+		return nil
+	}
+	return r.Schema(resource.Type, resource.DataSource)
+}
+
+func (r *ConfigReader) readHCL1(src []byte) ([]*ConfigResource, error) {
+	file, err := hcl1.ParseBytes(src)
+	if err != nil {
+		return nil, err
+	}
+
+	root, ok := file.Node.(*hcl1ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("configuration is not an object")
+	}
+
+	var resources []*ConfigResource
+	for _, keyword := range []string{"resource", "data"} {
+		for _, item := range root.Filter(keyword).Items {
+			if len(item.Keys) != 2 {
+				return nil, fmt.Errorf("%s block at %s must have a type and a name", keyword, item.Pos())
+			}
+
+			resource := &ConfigResource{
+				Type:       unquoteKey(item.Keys[0].Token.Text),
+				Name:       unquoteKey(item.Keys[1].Token.Text),
+				DataSource: keyword == "data",
+			}
+			resources = append(resources, resource)
+
+			schema := r.schema(resource)
+			if schema == nil {
+				continue
+			}
+
+			var raw map[string]interface{}
+			if err := hcl1.DecodeObject(&raw, item.Val); err != nil {
+				resource.Err = err
+				continue
+			}
+			for _, name := range metaArguments {
+				delete(raw, name)
+			}
+
+			interpolated, err := interpolateHIL(raw)
+			if err != nil {
+				resource.Err = err
+				continue
+			}
+			resource.Config, resource.Err = decodeHCL1Block("", interpolated.(map[string]interface{}), schema)
+		}
+	}
+	return resources, nil
+}
+
+func unquoteKey(key string) string {
+	if unquoted, err := strconv.Unquote(key); err == nil {
+		return unquoted
+	}
+	return key
+}
+
+// HIL reads every string in HCL1 configuration as a template, including map keys. Templates which refer to
+// anything (another resource, a variable or a data source) are unknown.
+func interpolateHIL(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return hilValue(v)
+	case []map[string]interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, element := range v {
+			interpolated, err := interpolateHIL(element)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, interpolated)
+		}
+		return list, nil
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, element := range v {
+			interpolated, err := interpolateHIL(element)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, interpolated)
+		}
+		return list, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for key, element := range v {
+			k, err := hilValue(key)
+			if err != nil {
+				return nil, err
+			}
+			interpolated, err := interpolateHIL(element)
+			if err != nil {
+				return nil, err
+			}
+			m[k.(string)] = interpolated
+		}
+		return m, nil
+	}
+	return value, nil
+}
+
+func hilValue(template string) (interface{}, error) {
+	root, err := hil.Parse(template)
+	if err != nil {
+		return nil, err
+	}
+
+	known := true
+	root.Accept(func(n hilast.Node) hilast.Node {
+		switch n.(type) {
+		case *hilast.VariableAccess, *hilast.Index, *hilast.Call:
+			known = false
+		}
+		return n
+	})
+	if !known {
+		return config.UnknownVariableValue, nil
+	}
+
+	result, err := hil.Eval(root, &hil.EvalConfig{GlobalScope: &hilast.BasicScope{}})
+	if err != nil {
+		return nil, err
+	}
+	return result.Value, nil
+}
+
+// HCL1 has no schema of its own, so every value is checked against the schema and converted to the type it
+// declares, much as helper/schema would. Blocks (and maps, which are written as blocks) are always decoded as
+// lists of maps.
+func decodeHCL1Block(path string, raw map[string]interface{}, schema *configschema.Block) (map[string]interface{}, error) {
+	decoded := make(map[string]interface{})
+	for _, key := range sortedKeys(raw) {
+		value := raw[key]
+		keyPath := joinPath(path, key)
+
+		if attribute, ok := schema.Attributes[key]; ok {
+			if attribute.Computed && !attribute.Optional {
+				return nil, fmt.Errorf("%s is computed and cannot be set", keyPath)
+			}
+
+			v, err := decodeHCL1Value(keyPath, value, MustSchemaType(attribute.Type))
+			if err != nil {
+				return nil, err
+			}
+			decoded[key] = v
+			continue
+		}
+
+		block, ok := schema.BlockTypes[key]
+		if !ok {
+			return nil, fmt.Errorf("%s is not in the schema", keyPath)
+		}
+
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must be a block", keyPath)
+		}
+
+		elements := make([]interface{}, 0, len(list))
+		for i, element := range list {
+			m, ok := element.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s.%d must be a block", keyPath, i)
+			}
+
+			e, err := decodeHCL1Block(keyPath+"."+strconv.Itoa(i), m, &block.Block)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, e)
+		}
+
+		if block.Nesting == configschema.NestingSingle {
+			if len(elements) != 1 {
+				return nil, fmt.Errorf("%s must be a single block", keyPath)
+			}
+			decoded[key] = elements[0]
+		} else {
+			decoded[key] = elements
+		}
+	}
+	return decoded, nil
+}
+
+func decodeHCL1Value(path string, value interface{}, t *SchemaType) (interface{}, error) {
+	if value == config.UnknownVariableValue {
+		return value, nil
+	}
+
+	switch t.Type {
+	case TypeString:
+		if s, ok := configString(value); ok {
+			return s, nil
+		}
+	case TypeFloat:
+		switch v := value.(type) {
+		case int, float64:
+			return v, nil
+		case string:
+			if i, err := strconv.Atoi(v); err == nil {
+				return i, nil
+			}
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f, nil
+			}
+		}
+	case TypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+	case TypeList, TypeSet:
+		if list, ok := value.([]interface{}); ok {
+			elements := make([]interface{}, 0, len(list))
+			for i, element := range list {
+				e, err := decodeHCL1Value(path+"."+strconv.Itoa(i), element, t.Elem)
+				if err != nil {
+					return nil, err
+				}
+				elements = append(elements, e)
+			}
+			return elements, nil
+		}
+	case TypeMap, TypeObject:
+		// Maps and objects written as blocks are decoded as a list holding one map
+		if list, ok := value.([]interface{}); ok && len(list) == 1 {
+			value = list[0]
+		}
+
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		decoded := make(map[string]interface{})
+		for _, key := range sortedKeys(m) {
+			elemType := t.Elem
+			if t.Type == TypeObject {
+				if elemType, ok = t.Attributes[key]; !ok {
+					return nil, fmt.Errorf("%s.%s is not in the schema", path, key)
+				}
+			}
+
+			v, err := decodeHCL1Value(path+"."+key, m[key], elemType)
+			if err != nil {
+				return nil, err
+			}
+			decoded[key] = v
+		}
+		return decoded, nil
+	}
+
+	return nil, fmt.Errorf("%s cannot hold %#v", path, value)
+}
+
+func (r *ConfigReader) readHCL2(filename string, src []byte) ([]*ConfigResource, error) {
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasSuffix(filename, ".json") {
+		file, diags = hcl2json.Parse(src, filename)
+	} else {
+		// Early HCL2 parsers require a newline after the last block in a file, which the Printer does not write
+		file, diags = hclsyntax.ParseConfig(append(src, '\n'), filename, hcl.Pos{Line: 1, Column: 1})
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	content, _, diags := file.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "resource", LabelNames: []string{"type", "name"}},
+			{Type: "data", LabelNames: []string{"type", "name"}},
+		},
+	})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var resources []*ConfigResource
+	for _, block := range content.Blocks {
+		resource := &ConfigResource{
+			Type:       block.Labels[0],
+			Name:       block.Labels[1],
+			DataSource: block.Type == "data",
+		}
+		resources = append(resources, resource)
+
+		schema := r.schema(resource)
+		if schema == nil {
+			continue
+		}
+
+		ctx := &hcl.EvalContext{
+			Variables: make(map[string]cty.Value),
+			Functions: map[string]function.Function{"jsonencode": jsonEncodeFunc},
+		}
+
+		config, diags := decodeHCL2Block(block.Body, schema, ctx, true)
+		if diags.HasErrors() {
+			resource.Err = diags
+			continue
+		}
+		resource.Config = config
+	}
+	return resources, nil
+}
+
+// Decode a block against its schema. Anything which is not in the schema is an error, other than meta-arguments
+// in the body of a resource, which are left out.
+//
+// hcldec cannot be used to do this, as the copy vendored by the Terraform package registers the same types with
+// gob, and the two cannot be linked into one binary.
+func decodeHCL2Block(body hcl.Body, schema *configschema.Block, ctx *hcl.EvalContext, resource bool) (map[string]interface{}, hcl.Diagnostics) {
+	bodySchema := &hcl.BodySchema{}
+	for name, attribute := range schema.Attributes {
+		// Computed attributes cannot be set in configuration
+		if !attribute.Computed || attribute.Optional {
+			bodySchema.Attributes = append(bodySchema.Attributes, hcl.AttributeSchema{Name: name})
+		}
+	}
+	for name, block := range schema.BlockTypes {
+		header := hcl.BlockHeaderSchema{Type: name}
+		if block.Nesting == configschema.NestingMap {
+			header.LabelNames = []string{"key"}
+		}
+		bodySchema.Blocks = append(bodySchema.Blocks, header)
+	}
+
+	if resource {
+		for _, name := range metaArguments {
+			if name == "lifecycle" {
+				bodySchema.Blocks = append(bodySchema.Blocks, hcl.BlockHeaderSchema{Type: name})
+			} else {
+				bodySchema.Attributes = append(bodySchema.Attributes, hcl.AttributeSchema{Name: name})
+			}
+		}
+	}
+
+	content, diags := body.Content(bodySchema)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	decoded := make(map[string]interface{})
+	for name, attribute := range content.Attributes {
+		a, ok := schema.Attributes[name]
+		if !ok {
+			continue
+		}
+
+		// Everything an attribute refers to is unknown, whatever it is
+		for _, traversal := range attribute.Expr.Variables() {
+			ctx.Variables[traversal.RootName()] = cty.DynamicVal
+		}
+
+		value, valueDiags := attribute.Expr.Value(ctx)
+		diags = append(diags, valueDiags...)
+		if valueDiags.HasErrors() {
+			continue
+		}
+
+		value, err := convertValue(value, ctyType(MustSchemaType(a.Type)))
+		if err != nil {
+			diags = append(diags, &hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Incorrect attribute value type",
+				Detail:   fmt.Sprintf("Inappropriate value for attribute %q: %s.", name, err),
+				Subject:  attribute.Expr.Range().Ptr(),
+			})
+			continue
+		}
+
+		if v := configValue(value); v != nil {
+			decoded[name] = v
+		}
+	}
+
+	for _, block := range content.Blocks {
+		nested, ok := schema.BlockTypes[block.Type]
+		if !ok {
+			continue
+		}
+
+		element, blockDiags := decodeHCL2Block(block.Body, &nested.Block, ctx, false)
+		diags = append(diags, blockDiags...)
+		if blockDiags.HasErrors() {
+			continue
+		}
+
+		switch nested.Nesting {
+		case configschema.NestingSingle:
+			decoded[block.Type] = element
+		case configschema.NestingMap:
+			m, _ := decoded[block.Type].(map[string]interface{})
+			if m == nil {
+				m = make(map[string]interface{})
+			}
+			m[block.Labels[0]] = element
+			decoded[block.Type] = m
+		default:
+			list, _ := decoded[block.Type].([]interface{})
+			decoded[block.Type] = append(list, element)
+		}
+	}
+	return decoded, diags
+}
+
+// The vendored version of cty cannot convert a tuple (e.g. ["a", "b"]) into a set, so the elements of sets are
+// converted one by one.
+func convertValue(value cty.Value, t cty.Type) (cty.Value, error) {
+	if !t.IsSetType() || !value.IsKnown() || value.IsNull() || !value.Type().IsTupleType() {
+		return convert.Convert(value, t)
+	}
+
+	if value.LengthInt() == 0 {
+		return cty.SetValEmpty(t.ElementType()), nil
+	}
+
+	var elements []cty.Value
+	for it := value.ElementIterator(); it.Next(); {
+		_, element := it.Element()
+		e, err := convertValue(element, t.ElementType())
+		if err != nil {
+			return cty.NilVal, err
+		}
+		elements = append(elements, e)
+	}
+	return cty.SetVal(elements), nil
+}
+
+func ctyType(t *SchemaType) cty.Type {
+	switch t.Type {
+	case TypeBool:
+		return cty.Bool
+	case TypeInt, TypeFloat:
+		return cty.Number
+	case TypeList:
+		return cty.List(ctyType(t.Elem))
+	case TypeSet:
+		return cty.Set(ctyType(t.Elem))
+	case TypeMap:
+		return cty.Map(ctyType(t.Elem))
+	case TypeObject:
+		attributes := make(map[string]cty.Type)
+		for name, attributeType := range t.Attributes {
+			attributes[name] = ctyType(attributeType)
+		}
+		return cty.Object(attributes)
+	}
+	return cty.String
+}
+
+// jsonencode, which is unknown if anything in its argument is unknown
+var jsonEncodeFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "val", Type: cty.DynamicPseudoType, AllowDynamicType: true, AllowUnknown: true},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		if !whollyKnown(args[0]) {
+			return cty.UnknownVal(cty.String), nil
+		}
+		return stdlib.JSONEncode(args[0])
+	},
+})
+
+func whollyKnown(value cty.Value) bool {
+	if !value.IsKnown() {
+		return false
+	}
+	if value.IsNull() || !value.CanIterateElements() {
+		return true
+	}
+
+	for it := value.ElementIterator(); it.Next(); {
+		if _, element := it.Element(); !whollyKnown(element) {
+			return false
+		}
+	}
+	return true
+}
+
+// Convert a decoded value into the form used by Terraform 0.11's raw configuration. Null values are left out of
+// objects, as they would not have been set at all in HCL1.
+func configValue(value cty.Value) interface{} {
+	if !value.IsKnown() {
+		return config.UnknownVariableValue
+	}
+	if value.IsNull() {
+		return nil
+	}
+
+	t := value.Type()
+	switch {
+	case t == cty.Bool:
+		return value.True()
+	case t == cty.String:
+		return value.AsString()
+	case t == cty.Number:
+		f := value.AsBigFloat()
+		if i, accuracy := f.Int64(); accuracy == big.Exact {
+			return int(i)
+		}
+		f64, _ := f.Float64()
+		return f64
+	case t.IsListType() || t.IsSetType() || t.IsTupleType():
+		list := make([]interface{}, 0, value.LengthInt())
+		for it := value.ElementIterator(); it.Next(); {
+			_, element := it.Element()
+			list = append(list, configValue(element))
+		}
+		return list
+	case t.IsMapType() || t.IsObjectType():
+		m := make(map[string]interface{})
+		for it := value.ElementIterator(); it.Next(); {
+			key, element := it.Element()
+			if !element.IsNull() {
+				m[key.AsString()] = configValue(element)
+			}
+		}
+		return m
+	}
+
+	panic(fmt.Sprintf("cannot convert %#v to a configuration value", value))
+}
+
+// The string form of a scalar value, as it would be held in state.
+func configString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// The string form of any configuration value, for reporting. Lists and maps are written in HCL2's syntax.
+func describeValue(value interface{}) string {
+	if s, ok := configString(value); ok {
+		return s
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		elements := make([]string, 0, len(v))
+		for _, element := range v {
+			elements = append(elements, strconv.Quote(describeValue(element)))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case map[string]interface{}:
+		entries := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			entries = append(entries, key+" = "+strconv.Quote(describeValue(v[key])))
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// Filter selects which instances are imported. An instance is imported if it satisfies every include rule which
+// is set, and none of the exclude rules.
+//
+// Names and IDs are known as soon as instances are described, so they are checked before the instance is imported.
+// Tags are checked at the same time if the importer saw them, and otherwise against the tags.* attributes of the
+// refreshed state.
+type Filter struct {
+	// The name of the instance must match one of these
+	Names []*regexp.Regexp
+
+	// The ID of the instance must be one of these
+	IDs []string
+
+	// The instance must have every one of these tags. An empty value matches any value.
+	Tags map[string]string
+
+	ExcludeNames []*regexp.Regexp
+	ExcludeIDs   []string
+
+	// Instances with any of these tags are excluded. An empty value matches any value.
+	ExcludeTags map[string]string
+}
+
+// MatchesInstance checks an instance before it is imported. A nil Filter matches everything.
+func (f *Filter) MatchesInstance(instance *Instance) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Names) > 0 && !anyMatch(f.Names, instance.Name) {
+		return false
+	}
+
+	if anyMatch(f.ExcludeNames, instance.Name) {
+		return false
+	}
+
+	if len(f.IDs) > 0 && !hasID(f.IDs, instance) {
+		return false
+	}
+
+	if hasID(f.ExcludeIDs, instance) {
+		return false
+	}
+
+	if instance.Tags != nil {
+		return f.matchesTags(instance.Tags)
+	}
+	return true
+}
+
+// MatchesState checks the tags of a refreshed instance, unless they were already checked by MatchesInstance.
+func (f *Filter) MatchesState(instance *Instance, state *terraform.InstanceState) bool {
+	if f == nil || instance.Tags != nil {
+		return true
+	}
+
+	tags := make(map[string]string)
+	for key, value := range state.Attributes {
+		if strings.HasPrefix(key, "tags.") && key != "tags.%" {
+			tags[strings.TrimPrefix(key, "tags.")] = value
+		}
+	}
+	return f.matchesTags(tags)
+}
+
+func (f *Filter) matchesTags(tags map[string]string) bool {
+	for key, value := range f.Tags {
+		if !hasTag(tags, key, value) {
+			return false
+		}
+	}
+
+	for key, value := range f.ExcludeTags {
+		if hasTag(tags, key, value) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTag(tags map[string]string, key string, value string) bool {
+	v, ok := tags[key]
+	return ok && (value == "" || v == value)
+}
+
+func anyMatch(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Instances with a composite ID are matched by their key, e.g. route_table_id=rtb-1234
+func hasID(ids []string, instance *Instance) bool {
+	for _, id := range ids {
+		if id == instance.ID || id == instance.Key() {
+			return true
+		}
+	}
+	return false
+}
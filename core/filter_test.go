@@ -0,0 +1,87 @@
+package core_test
+
+import (
+	"regexp"
+
+	. "github.com/jmcgill/formation/core"
+
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Filter", func() {
+	It("should match everything when nil", func() {
+		var filter *Filter
+		Expect(filter.MatchesInstance(&Instance{Name: "anything"})).To(BeTrue())
+	})
+
+	It("should filter instances by name", func() {
+		filter := &Filter{
+			Names:        []*regexp.Regexp{regexp.MustCompile("^prod-")},
+			ExcludeNames: []*regexp.Regexp{regexp.MustCompile("-old$")},
+		}
+
+		Expect(filter.MatchesInstance(&Instance{Name: "prod-web"})).To(BeTrue())
+		Expect(filter.MatchesInstance(&Instance{Name: "prod-web-old"})).To(BeFalse())
+		Expect(filter.MatchesInstance(&Instance{Name: "staging-web"})).To(BeFalse())
+	})
+
+	It("should filter instances by ID", func() {
+		filter := &Filter{
+			IDs: []string{"vpc-1234", "route_table_id=rtb-1234"},
+		}
+
+		Expect(filter.MatchesInstance(&Instance{ID: "vpc-1234"})).To(BeTrue())
+		Expect(filter.MatchesInstance(&Instance{ID: "vpc-5678"})).To(BeFalse())
+		Expect(filter.MatchesInstance(&Instance{
+			CompositeID: map[string]string{"route_table_id": "rtb-1234"},
+		})).To(BeTrue())
+	})
+
+	It("should filter instances by the tags seen when describing them", func() {
+		filter := &Filter{
+			Tags:        map[string]string{"team": "payments", "service": ""},
+			ExcludeTags: map[string]string{"environment": "test"},
+		}
+
+		Expect(filter.MatchesInstance(&Instance{
+			Tags: map[string]string{"team": "payments", "service": "api"},
+		})).To(BeTrue())
+		Expect(filter.MatchesInstance(&Instance{
+			Tags: map[string]string{"team": "payments"},
+		})).To(BeFalse())
+		Expect(filter.MatchesInstance(&Instance{
+			Tags: map[string]string{"team": "payments", "service": "api", "environment": "test"},
+		})).To(BeFalse())
+	})
+
+	It("should filter by refreshed tags when the importer did not see any", func() {
+		filter := &Filter{
+			Tags: map[string]string{"team": "payments"},
+		}
+		instance := &Instance{ID: "queue"}
+
+		Expect(filter.MatchesInstance(instance)).To(BeTrue())
+		Expect(filter.MatchesState(instance, &terraform.InstanceState{
+			Attributes: map[string]string{
+				"tags.%":    "1",
+				"tags.team": "payments",
+			},
+		})).To(BeTrue())
+		Expect(filter.MatchesState(instance, &terraform.InstanceState{
+			Attributes: map[string]string{},
+		})).To(BeFalse())
+	})
+
+	It("should not check refreshed tags twice", func() {
+		filter := &Filter{
+			Tags: map[string]string{"team": "payments"},
+		}
+		instance := &Instance{ID: "rtbassoc-1234", Tags: map[string]string{"team": "payments"}}
+
+		Expect(filter.MatchesState(instance, &terraform.InstanceState{
+			Attributes: map[string]string{},
+		})).To(BeTrue())
+	})
+})
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/config/configschema"
+)
+
+// Terraform 0.11 stores every attribute of an InstanceState as a flattened string (see DESIGNDOC.md). Later
+// versions of Terraform store typed, nested values instead. The functions in this file use the provider
+// schema to reconstruct those typed values from the flattened attributes.
+
+// AttributesFromFlatmap converts the flattened attributes of an InstanceState into nested values which
+// can be encoded as JSON. Strings, numbers and booleans are converted to their JSON equivalents, and
+// attributes which are not present in the flatmap are null.
+func AttributesFromFlatmap(attributes map[string]string, schema *configschema.Block) map[string]interface{} {
+	return blockFromFlatmap(attributes, "", schema)
+}
+
+func blockFromFlatmap(attributes map[string]string, prefix string, schema *configschema.Block) map[string]interface{} {
+	ret := make(map[string]interface{})
+
+	for name, attribute := range schema.Attributes {
+		ret[name] = valueFromFlatmap(attributes, prefix+name, MustSchemaType(attribute.Type))
+	}
+
+	for name, block := range schema.BlockTypes {
+		key := prefix + name
+		elements := make([]interface{}, 0)
+		for _, id := range elementKeys(attributes, key) {
+			elements = append(elements, blockFromFlatmap(attributes, key+"."+id+".", &block.Block))
+		}
+
+		switch block.Nesting {
+		case configschema.NestingSingle:
+			if len(elements) == 0 {
+				ret[name] = nil
+			} else {
+				ret[name] = elements[0]
+			}
+		case configschema.NestingMap:
+			m := make(map[string]interface{})
+			for _, id := range elementKeys(attributes, key) {
+				m[id] = blockFromFlatmap(attributes, key+"."+id+".", &block.Block)
+			}
+			ret[name] = m
+		default:
+			ret[name] = elements
+		}
+	}
+
+	return ret
+}
+
+func valueFromFlatmap(attributes map[string]string, key string, t *SchemaType) interface{} {
+	switch t.Type {
+	case TypeBool, TypeInt, TypeFloat, TypeString:
+		value, ok := attributes[key]
+		if !ok {
+			return nil
+		}
+		return primitiveFromFlatmap(value, t)
+
+	case TypeList, TypeSet:
+		if _, ok := attributes[key+".#"]; !ok {
+			return nil
+		}
+
+		elements := make([]interface{}, 0)
+		for _, id := range elementKeys(attributes, key) {
+			elements = append(elements, valueFromFlatmap(attributes, key+"."+id, t.Elem))
+		}
+		return elements
+
+	case TypeMap:
+		if _, ok := attributes[key+".%"]; !ok {
+			return nil
+		}
+
+		// Map keys may themselves contain dots, so only maps of primitives can be decoded reliably.
+		m := make(map[string]interface{})
+		for k, v := range attributes {
+			if !strings.HasPrefix(k, key+".") || k == key+".%" {
+				continue
+			}
+			m[strings.TrimPrefix(k, key+".")] = primitiveFromFlatmap(v, t.Elem)
+		}
+		return m
+
+	case TypeObject:
+		ret := make(map[string]interface{})
+		for name, attributeType := range t.Attributes {
+			ret[name] = valueFromFlatmap(attributes, key+"."+name, attributeType)
+		}
+		return ret
+	}
+
+	return nil
+}
+
+func primitiveFromFlatmap(value string, t *SchemaType) interface{} {
+	switch t.Type {
+	case TypeBool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+		return nil
+	case TypeInt, TypeFloat:
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+		return nil
+	}
+	return value
+}
+
+// Returns the unique index (for lists) or hash (for sets) of every element stored under key, in a stable
+// order.
+func elementKeys(attributes map[string]string, key string) []string {
+	seen := make(map[string]bool)
+	for k := range attributes {
+		if !strings.HasPrefix(k, key+".") {
+			continue
+		}
+
+		id := strings.SplitN(strings.TrimPrefix(k, key+"."), ".", 2)[0]
+		if id == "#" || id == "%" {
+			continue
+		}
+		seen[id] = true
+	}
+
+	ids := make([]string, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, aErr := strconv.Atoi(ids[i])
+		b, bErr := strconv.Atoi(ids[j])
+		if aErr == nil && bErr == nil {
+			return a < b
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
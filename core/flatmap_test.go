@@ -0,0 +1,86 @@
+package core_test
+
+import (
+	"encoding/json"
+
+	. "github.com/jmcgill/formation/core"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AttributesFromFlatmap", func() {
+	resource := &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"name":    {Type: schema.TypeString, Optional: true},
+			"count":   {Type: schema.TypeInt, Optional: true},
+			"enabled": {Type: schema.TypeBool, Optional: true},
+			"missing": {Type: schema.TypeString, Optional: true},
+			"cidr_blocks": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"tags": {
+				Type:     schema.TypeMap,
+				Optional: true,
+			},
+			"ingress": {
+				Type:     schema.TypeSet,
+				Optional: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"protocol":  {Type: schema.TypeString, Optional: true},
+						"from_port": {Type: schema.TypeInt, Optional: true},
+					},
+				},
+			},
+		},
+	}
+
+	It("should convert flattened attributes into typed values", func() {
+		attributes := map[string]string{
+			"name":                         "test",
+			"count":                        "3",
+			"enabled":                      "true",
+			"cidr_blocks.#":                "2",
+			"cidr_blocks.0":                "10.0.0.0/16",
+			"cidr_blocks.1":                "10.1.0.0/16",
+			"tags.%":                       "1",
+			"tags.I.Have.Dots":             "Hello",
+			"ingress.#":                    "1",
+			"ingress.2541437006.protocol":  "tcp",
+			"ingress.2541437006.from_port": "443",
+		}
+
+		Expect(AttributesFromFlatmap(attributes, resource.CoreConfigSchema())).To(Equal(map[string]interface{}{
+			"name":        "test",
+			"count":       json.Number("3"),
+			"enabled":     true,
+			"missing":     nil,
+			"cidr_blocks": []interface{}{"10.0.0.0/16", "10.1.0.0/16"},
+			"tags": map[string]interface{}{
+				"I.Have.Dots": "Hello",
+			},
+			"ingress": []interface{}{
+				map[string]interface{}{
+					"protocol":  "tcp",
+					"from_port": json.Number("443"),
+				},
+			},
+		}))
+	})
+
+	It("should represent absent blocks as empty lists and absent attributes as null", func() {
+		Expect(AttributesFromFlatmap(map[string]string{}, resource.CoreConfigSchema())).To(Equal(map[string]interface{}{
+			"name":        nil,
+			"count":       nil,
+			"enabled":     nil,
+			"missing":     nil,
+			"cidr_blocks": nil,
+			"tags":        nil,
+			"ingress":     []interface{}{},
+		}))
+	})
+})
@@ -3,6 +3,8 @@ package core
 import (
 	"github.com/hashicorp/terraform/terraform"
 	"github.com/hashicorp/terraform/config/configschema"
+	"sort"
+	"strings"
 )
 
 type Instance struct {
@@ -11,6 +13,24 @@ type Instance struct {
 	// One of ID or CompositeID must be set
 	ID          string
 	CompositeID map[string]string
+
+	// The tags of the instance, if the importer can see them when describing instances. Resources which have no
+	// tags of their own (e.g. associations) may carry the tags of the resource they belong to. Nil if unknown.
+	Tags map[string]string
+}
+
+// Key uniquely identifies an instance amongst all instances of the same resource type.
+func (i *Instance) Key() string {
+	if len(i.CompositeID) == 0 {
+		return i.ID
+	}
+
+	parts := make([]string, 0, len(i.CompositeID))
+	for k, v := range i.CompositeID {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
 }
 
 type Importer interface {
@@ -27,3 +47,22 @@ type PatchyImporter interface {
 	Clean(in *terraform.InstanceState, meta interface{}) *terraform.InstanceState
 	AdjustSchema(in *configschema.Block) *configschema.Block
 }
+
+// Importers which accept options from the Formation configuration file implement this interface. Configure is
+// called once, before Describe.
+type ConfigurableImporter interface {
+	Configure(options map[string]string) error
+}
+
+// Importers for resources with attributes that hold an IAM policy document implement this interface, so that those
+// documents can be written as aws_iam_policy_document data sources.
+type PolicyImporter interface {
+	PolicyAttributes() []string
+}
+
+// Importers for resources with attributes that always differ from configuration, or which cannot be reproduced
+// from the imported state (e.g. a deployment package which was uploaded from a local file), implement this
+// interface. Changes to these attributes are ignored, so that freshly imported configuration plans clean.
+type IgnoreChangesImporter interface {
+	IgnoreChanges() []string
+}
@@ -0,0 +1,27 @@
+package core_test
+
+import (
+	. "github.com/jmcgill/formation/core"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Instance", func() {
+	It("should be keyed by its ID", func() {
+		instance := Instance{Name: "test", ID: "vpc-1234"}
+		Expect(instance.Key()).To(Equal("vpc-1234"))
+	})
+
+	It("should be keyed by its composite ID in a stable order", func() {
+		instance := Instance{
+			Name: "test",
+			ID:   "unused",
+			CompositeID: map[string]string{
+				"role_name":  "admin",
+				"policy_arn": "arn:aws:iam::aws:policy/AdministratorAccess",
+			},
+		}
+		Expect(instance.Key()).To(Equal("policy_arn=arn:aws:iam::aws:policy/AdministratorAccess,role_name=admin"))
+	})
+})
@@ -1,271 +1,231 @@
 package core
 
 import (
-	"github.com/jmcgill/formation/terraform_helpers"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/hashicorp/terraform/config/configschema"
 	"github.com/hashicorp/terraform/terraform"
 )
 
-// HERE BE DRAGONS
-// Do not read this code - it needs a complete rewrite to be a top down parser and to better differentiate
-// between LISTS, SETS and MAPS.
-
-type ParentType int
-
-const (
-	PARENT_ROOT ParentType = iota
-	PARENT_MAP
-	PARENT_LIST
-	PARENT_NESTED
-)
-
-// We keep a queue of state as we traverse the resource, so that we can walk
-// up and down nested resources as required.
-type State struct {
-	parent            *InlineResource
-	parentType        ParentType
-	remainingChildren int
-	depth             int
-	prefix            string
-}
-
+// InstanceStateParser converts the flattened attributes of an InstanceState into a tree of Fields.
+//
+// Flattened attributes are ambiguous on their own (a map key may contain dots, and a list of objects looks
+// much like a map of maps), so the parser walks the provider schema for the resource and looks up each
+// attribute it describes:
+//
+//	# Scalar keys and values are nice and simple
+//	scalar_key = scalar_value
+//
+//	# Lists and sets contain an entry defining how many elements they hold (N) followed by N entries with
+//	# the values in that collection. Lists are keyed by index, sets by a hash of each element.
+//	scalar_set_key.# = 2
+//	scalar_set_key.1234 = scalar_set_value_1
+//	scalar_set_key.5678 = scalar_set_value_2
+//
+//	# Maps contain an entry defining how many keys are in that map (N) followed by N entries with the keys
+//	# and values.
+//	map_name.% = 2
+//	map_name.map_key_1 = map_value_1
+//	map_name.map_key_2 = map_value_2
+//
+//	# Nested blocks follow the same rules as lists and sets, with each element holding its own attributes.
+//	nested_block_key.# = 2
+//	nested_block_key.6666.nested_scalar_key = nested_scalar_value_1
+//	nested_block_key.8888.nested_scalar_key = nested_scalar_value_2
+//
+// Set hashes are meaningless outside of the provider which computed them, so elements of sets are given a
+// positional index in the Path of each Field instead. Attributes which are not part of the schema (other
+// than the id of the resource) are ignored, as are empty collections.
 type InstanceStateParser struct {
-	stateStack []*State
+	Schema *configschema.Block
 }
 
-func (p *InstanceStateParser) state() *State {
-	return p.stateStack[len(p.stateStack)-1]
-}
+func (p *InstanceStateParser) Parse(state *terraform.InstanceState) *Resource {
+	schema := p.Schema
+	if schema == nil {
+		schema = &configschema.Block{}
+	}
 
-func (p *InstanceStateParser) pushState(state *State) {
-	p.stateStack = append(p.stateStack, state)
-}
+	resource := &Resource{
+		Fields: p.parseBlock(state.Attributes, "", "", schema),
+	}
 
-func (p *InstanceStateParser) popState() *State {
-	s := p.stateStack[len(p.stateStack)-1]
-	p.stateStack = p.stateStack[:len(p.stateStack)-1]
-	return s
-}
+	// Every resource has a computed ID in the root resource, whether or not the schema declares it
+	if _, ok := schema.Attributes["id"]; !ok {
+		if id, ok := state.Attributes["id"]; ok {
+			resource.Fields.Append(p.scalar("id", "id", id, TypeString))
+			sortFields(resource.Fields)
+		}
+	}
 
-func (p *InstanceStateParser) currentResource() *InlineResource {
-	return p.state().parent
+	return resource
 }
 
-func (p *InstanceStateParser) Parse(state *terraform.InstanceState) *Resource {
-	resource := &Resource{}
-
-	// TODO(jimmy): Wrapping InstanceState like this is no longer valuable - convert to a helper
-	// method which returns a SortedInstanceState
-	var wrappedState terraform_helpers.InstanceState
-	wrappedState = terraform_helpers.InstanceState(*state)
-	sortedState := wrappedState.ToSorted()
-
-	s := State{
-		remainingChildren: 0,
-		parent:            new(InlineResource),
-		parentType:        PARENT_ROOT,
+// Parse the attributes and nested blocks of a single block. key is the prefix of this block in the flatmap,
+// and path is the same prefix with set hashes replaced by positional indexes.
+func (p *InstanceStateParser) parseBlock(attributes map[string]string, key string, path string, schema *configschema.Block) *InlineResource {
+	r := new(InlineResource)
+
+	for name, attribute := range schema.Attributes {
+		if field := p.parseValue(attributes, key+name, path+name, name, MustSchemaType(attribute.Type)); field != nil {
+			r.Append(field)
+		}
 	}
-	p.pushState(&s)
-	resource.Fields = s.parent
 
-	for _, a := range sortedState.Attributes {
-		p.parseAttribute(a.Key, a.Value)
+	for name, block := range schema.BlockTypes {
+		if field := p.parseNestedBlock(attributes, key+name, path+name, name, block); field != nil {
+			r.Append(field)
+		}
 	}
 
-	return resource
+	sortFields(r)
+	return r
 }
 
-//# Scalar keys and values are nice and simple
-//scalar_key = scalar_value
-//
-//# Arrays always contain an entry defining how entries are in the array (N) followed by
-//# N entries with the values in that array and a unique index for each value.
-//scalar_array_key.# = 2
-//scalar_array_key.1234 = scalar_array_value_1
-//scalar_array_key.5678 = scalar_array_value_2
-//
-//# Maps contain an entry definining how many keys are in that map (N) followed by N
-//# entries with the keys and values.
-//map_name.% = 2
-//map_name.map_key_1 = map_value_1
-//map_name.map_key_2 = map_value_2
-//
-//# Arrays can also nest objects. The semantics are the same as an array and scalar
-//# combined.
-//expanded_array_key.# = 2
-//expanded_array_key.6666.nested_scalar_key = nested_scalar_value_1
-//expanded_array_key.8888.nested_scalar_key = nested_scalar_value_2
-
-func (p *InstanceStateParser) parseAttribute(attribute string, value string) {
-	originalAttribute := attribute
-
-	// We cannot establish the prefix for a list item until we first encounter it.
-	if p.state().parentType == PARENT_LIST && p.state().prefix == "" {
-		// Determine whether this is a list of scalar objects or a list of nested objects.
-		parts := strings.Split(attribute, ".")
-
-		// For scalar lists this is just a unique key for this entry. For nested objects
-		// the first entry contains both that unique key _and_ the first nested field.
-		listPrefix := strings.Join(parts[p.state().depth-1:], ".")
-
-		if strings.ContainsRune(listPrefix, '.') {
-			// Create a new nested resource
-			field := &Field{
-				FieldType:   NESTED,
-				Key:         "",
-				NestedValue: new(InlineResource),
-			}
-			p.currentResource().Append(field)
-
-			// Push this entry onto the stack.
-			s := &State{
-				parent:            field.NestedValue,
-				remainingChildren: 0,
-				parentType:        PARENT_NESTED,
-				depth:             p.state().depth + 0,
-				prefix:            strings.Join(parts[:p.state().depth], ".") + ".",
-			}
-			p.pushState(s)
-		} else {
-			// This is a list of scalar objects
-			p.state().prefix = strings.Join(parts[:p.state().depth], ".")
+func (p *InstanceStateParser) parseValue(attributes map[string]string, key string, path string, name string, t *SchemaType) *Field {
+	switch t.Type {
+	case TypeBool, TypeInt, TypeFloat, TypeString:
+		value, ok := attributes[key]
+		if !ok {
+			return nil
+		}
+		return p.scalar(name, path, value, t.Type)
+
+	case TypeList, TypeSet:
+		field := &Field{
+			FieldType:   collectionFieldType(t.Type),
+			ValueType:   t.Type,
+			Key:         name,
+			Path:        path,
+			NestedValue: new(InlineResource),
 		}
-	}
 
-	if !strings.HasPrefix(attribute, p.state().prefix) {
-		for !strings.HasPrefix(attribute, p.state().prefix) {
-			// We should also pop if we've reached the end of key
-			// TODO(jimmy): Is this always safe?
-			if p.stateStack[len(p.stateStack)-2].parentType == PARENT_LIST {
-				_ = p.popState()
+		for i, id := range elementKeys(attributes, key) {
+			element := p.parseValue(attributes, key+"."+id, elementPath(path, id, i, t.Type), "", t.Elem)
+			if element != nil {
+				field.NestedValue.Append(element)
 			}
+		}
 
-			// This is a sign that we've either reached the end of a map, or the end of a single
-			// item in a list.
-			p.state().remainingChildren -= 1
-			if p.state().remainingChildren <= 0 {
-				// Pop an entry off the stack
-				_ = p.popState()
-			} else {
-				break
-			}
+		if len(field.NestedValue.Fields) == 0 {
+			return nil
+		}
+		return field
+
+	case TypeMap:
+		field := &Field{
+			FieldType:   MAP,
+			ValueType:   TypeMap,
+			Key:         name,
+			Path:        path,
+			NestedValue: new(InlineResource),
 		}
 
-		// If this is a list, we need to reset the matched prefix.
-		// TODO(jimmy): Factor this out into a single method
-		if p.state().parentType == PARENT_LIST {
-			// This is a bad thing to do, as it clears any previous nesting
-			// but it's OK because the next field we see will restore it.
-			// Determine whether this is a list of scalar objects or a list of nested objects.
-			parts := strings.Split(attribute, ".")
-
-			// For scalar lists this is just a unique key for this entry. For nested objects
-			// the first entry contains both that unique key _and_ the first nested field.
-			listPrefix := strings.Join(parts[p.state().depth-1:], ".")
-
-			if strings.ContainsRune(listPrefix, '.') {
-				// This is a list of nested resource
-				// Create a new nested resource
-				field := &Field{
-					FieldType:   NESTED,
-					Key:         "",
-					NestedValue: new(InlineResource),
-					Path:        originalAttribute,
-				}
-				p.currentResource().Append(field)
-
-				// Push this entry onto the stack.
-				s := &State{
-					parent:            field.NestedValue,
-					remainingChildren: 0,
-					parentType:        PARENT_NESTED,
-					depth:             p.state().depth + 0,
-					prefix:            strings.Join(parts[:p.state().depth], ".") + ".",
-				}
-				p.pushState(s)
-			} else {
-				// This is a list of scalar objects
-				p.state().prefix = strings.Join(parts[:p.state().depth], ".")
+		// Map keys may themselves contain dots, so everything after the name of the map is the key.
+		for k, v := range attributes {
+			if !strings.HasPrefix(k, key+".") || k == key+".%" {
+				continue
 			}
+
+			mapKey := strings.TrimPrefix(k, key+".")
+			field.NestedValue.Append(p.scalar(mapKey, path+"."+mapKey, v, t.Elem.Type))
 		}
-	}
-	attribute = strings.TrimPrefix(attribute, p.state().prefix)
 
-	if !strings.ContainsRune(attribute, '.') || p.state().parentType == PARENT_MAP {
-		if p.state().parentType == PARENT_MAP {
-			p.state().remainingChildren -= 1
+		if len(field.NestedValue.Fields) == 0 {
+			return nil
 		}
-		p.parseSimpleAttribute(attribute, originalAttribute, value)
-	} else {
-		parts := strings.Split(attribute, ".")
-		fieldName, parts := parts[0], parts[1:]
-
-		// Is this the beginning of a map?
-		if parts[0] == "%" {
-			children, _ := strconv.Atoi(value)
-			if children != 0 {
-				// Is this the map declaration?
-				field := &Field{
-					FieldType:   MAP,
-					Key:         fieldName,
-					NestedValue: new(InlineResource),
-					Path:        strings.Replace(originalAttribute, ".%", "", -1),
-				}
-				p.currentResource().Append(field)
-
-				// Push this entry onto the stack.
-				s := &State{
-					parent:            field.NestedValue,
-					remainingChildren: children,
-					parentType:        PARENT_MAP,
-					depth:             p.state().depth + 1,
-					prefix:            p.state().prefix + fieldName + ".",
-				}
-				p.pushState(s)
+		sortFields(field.NestedValue)
+		return field
+
+	case TypeObject:
+		nested := new(InlineResource)
+		for attributeName, attributeType := range t.Attributes {
+			if f := p.parseValue(attributes, key+"."+attributeName, path+"."+attributeName, attributeName, attributeType); f != nil {
+				nested.Append(f)
 			}
 		}
-
-		// Is this the beginning of a list?
-		if parts[0] == "#" {
-			children, _ := strconv.Atoi(value)
-			if children != 0 {
-				field := &Field{
-					FieldType:   LIST,
-					Key:         fieldName,
-					NestedValue: new(InlineResource),
-					Path:        strings.Replace(originalAttribute, ".#", "", -1),
-				}
-				p.currentResource().Append(field)
-
-				// Push this entry onto the stack.
-				s := &State{
-					parent:            field.NestedValue,
-					remainingChildren: children,
-					parentType:        PARENT_LIST,
-					depth:             p.state().depth + 2,
-					prefix:            "", //p.state().prefix + fieldName + ".",
-				}
-				p.pushState(s)
-			}
+		sortFields(nested)
+
+		return &Field{
+			FieldType:   NESTED,
+			ValueType:   TypeObject,
+			Key:         name,
+			Path:        path,
+			NestedValue: nested,
 		}
 	}
+
+	return nil
+}
+
+// Nested blocks are represented as a LIST or SET of NESTED fields, no matter how many elements the schema
+// allows.
+func (p *InstanceStateParser) parseNestedBlock(attributes map[string]string, key string, path string, name string, block *configschema.NestedBlock) *Field {
+	valueType := TypeList
+	if block.Nesting == configschema.NestingSet {
+		valueType = TypeSet
+	}
+
+	field := &Field{
+		FieldType:   collectionFieldType(valueType),
+		ValueType:   valueType,
+		Key:         name,
+		Path:        path,
+		NestedValue: new(InlineResource),
+	}
+
+	for i, id := range elementKeys(attributes, key) {
+		childPath := elementPath(path, id, i, valueType)
+		field.NestedValue.Append(&Field{
+			FieldType:   NESTED,
+			ValueType:   TypeObject,
+			Path:        childPath,
+			NestedValue: p.parseBlock(attributes, key+"."+id+".", childPath+".", &block.Block),
+		})
+	}
+
+	if len(field.NestedValue.Fields) == 0 {
+		return nil
+	}
+	return field
 }
 
-func (p *InstanceStateParser) parseSimpleAttribute(attribute string, path string, value string) {
-	fieldValue := ScalarValue{StringValue: value}
+func (p *InstanceStateParser) scalar(name string, path string, value string, valueType ValueType) *Field {
 	field := &Field{
 		FieldType:   SCALAR,
-		Key:         attribute,
-		ScalarValue: &fieldValue,
+		ValueType:   valueType,
+		Key:         name,
 		Path:        path,
+		ScalarValue: NewScalarValue(value, valueType),
 	}
 
-	// Every resource has a computed ID in the root resource
 	if path == "id" {
 		field.Computed = true
 	}
 
-	p.currentResource().Append(field)
+	return field
+}
+
+func collectionFieldType(valueType ValueType) FieldType {
+	if valueType == TypeSet {
+		return SET
+	}
+	return LIST
+}
+
+// The path of an element in a list is the same as its key in the flatmap. Set elements are keyed by a hash,
+// which is replaced with the position of the element.
+func elementPath(path string, id string, position int, valueType ValueType) string {
+	if valueType == TypeSet {
+		return path + "." + strconv.Itoa(position)
+	}
+	return path + "." + id
+}
+
+func sortFields(r *InlineResource) {
+	sort.SliceStable(r.Fields, func(i, j int) bool {
+		return r.Fields[i].Key < r.Fields[j].Key
+	})
 }
@@ -3,6 +3,8 @@ package core_test
 import (
 	. "github.com/jmcgill/formation/core"
 
+	"github.com/hashicorp/terraform/config/configschema"
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -20,13 +22,14 @@ var _ = Describe("InstanceStateParser", func() {
 			Fields: &InlineResource{},
 		}
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: &configschema.Block{}}
 		Expect((*parser.Parse(&state))).To(Equal(expectedResource))
 	})
 
 	It("should parse simple fields", func() {
 		state := terraform.InstanceState{
 			Attributes: map[string]string{
+				"id":           "i-1234",
 				"simple_field": "value",
 			},
 		}
@@ -38,20 +41,97 @@ var _ = Describe("InstanceStateParser", func() {
 				Fields: []*Field{
 					{
 						FieldType: SCALAR,
+						ValueType: TypeString,
+						Key:       "id",
+						Path:      "id",
+						Computed:  true,
+						ScalarValue: &ScalarValue{
+							StringValue: "i-1234",
+							Kind:        TypeString,
+						},
+					},
+					{
+						FieldType: SCALAR,
+						ValueType: TypeString,
 						Key:       "simple_field",
 						Path:      "simple_field",
 						ScalarValue: &ScalarValue{
 							StringValue: "value",
+							Kind:        TypeString,
 						},
 					},
 				},
 			},
 		}
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"simple_field": optionalString,
+		})}
 		Expect(*parser.Parse(&state)).To(Equal(expectedResource))
 	})
 
+	It("should ignore attributes which are not in the schema", func() {
+		state := terraform.InstanceState{
+			Attributes: map[string]string{
+				"simple_field":  "value",
+				"unknown_field": "value",
+			},
+		}
+
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"simple_field": optionalString,
+		})}
+		resource := parser.Parse(&state)
+		Expect(resource.Fields.Fields).To(HaveLen(1))
+		Expect(resource.Fields.Fields[0].Key).To(Equal("simple_field"))
+	})
+
+	It("should type numbers and booleans from the schema", func() {
+		state := terraform.InstanceState{
+			Attributes: map[string]string{
+				"count":   "3",
+				"enabled": "true",
+			},
+		}
+
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"count":   optionalInt,
+			"enabled": optionalBool,
+		})}
+		resource := parser.Parse(&state)
+		Expect(resource.Fields.Fields).To(HaveLen(2))
+		Expect(resource.Fields.Fields[0].ValueType).To(Equal(TypeFloat))
+		Expect(*resource.Fields.Fields[0].ScalarValue).To(Equal(ScalarValue{
+			StringValue: "3",
+			Kind:        TypeInt,
+			IntValue:    3,
+		}))
+		Expect(resource.Fields.Fields[1].ValueType).To(Equal(TypeBool))
+		Expect(*resource.Fields.Fields[1].ScalarValue).To(Equal(ScalarValue{
+			StringValue: "true",
+			Kind:        TypeBool,
+			BoolValue:   true,
+		}))
+	})
+
+	It("should keep numbers which cannot be parsed as strings", func() {
+		state := terraform.InstanceState{
+			Attributes: map[string]string{
+				"ratio":  "0.5",
+				"weight": "",
+			},
+		}
+
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"ratio":  {Type: schema.TypeFloat, Optional: true},
+			"weight": optionalInt,
+		})}
+		resource := parser.Parse(&state)
+		Expect(resource.Fields.Fields[0].ScalarValue.Kind).To(Equal(TypeFloat))
+		Expect(resource.Fields.Fields[0].ScalarValue.FloatValue).To(Equal(0.5))
+		Expect(resource.Fields.Fields[1].ScalarValue.Kind).To(Equal(TypeString))
+	})
+
 	It("should parse a map with multiple keys", func() {
 		state := terraform.InstanceState{
 			Attributes: map[string]string{
@@ -68,24 +148,29 @@ var _ = Describe("InstanceStateParser", func() {
 				Fields: []*Field{
 					{
 						FieldType: MAP,
+						ValueType: TypeMap,
 						Key:       "map_name",
 						Path:      "map_name",
 						NestedValue: &InlineResource{
 							Fields: []*Field{
 								{
 									FieldType: SCALAR,
+									ValueType: TypeString,
 									Key:       "map_key_1",
 									Path:      "map_name.map_key_1",
 									ScalarValue: &ScalarValue{
 										StringValue: "map_value_1",
+										Kind:        TypeString,
 									},
 								},
 								{
 									FieldType: SCALAR,
+									ValueType: TypeString,
 									Key:       "map_key_2",
 									Path:      "map_name.map_key_2",
 									ScalarValue: &ScalarValue{
 										StringValue: "map_value_2",
+										Kind:        TypeString,
 									},
 								},
 							},
@@ -95,17 +180,19 @@ var _ = Describe("InstanceStateParser", func() {
 			},
 		}
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"map_name": optionalMap,
+		})}
 		Expect(*parser.Parse(&state)).To(Equal(expectedResource))
 	})
 
-	It("should parse a list with multiple scalar entries", func() {
+	It("should parse a set with multiple scalar entries", func() {
 		state := terraform.InstanceState{
 			Attributes: map[string]string{
-				"list_key.#": "2",
-				// List prefix is this whole key
-				"list_key.1234": "list_value_1",
-				"list_key.1235": "list_value_2",
+				"set_key.#": "2",
+				// Set elements are keyed by a hash of their value
+				"set_key.1234": "set_value_1",
+				"set_key.1235": "set_value_2",
 			},
 		}
 
@@ -115,25 +202,30 @@ var _ = Describe("InstanceStateParser", func() {
 			Fields: &InlineResource{
 				Fields: []*Field{
 					{
-						FieldType: LIST,
-						Key:       "list_key",
-						Path:      "list_key",
+						FieldType: SET,
+						ValueType: TypeSet,
+						Key:       "set_key",
+						Path:      "set_key",
 						NestedValue: &InlineResource{
 							Fields: []*Field{
 								{
 									FieldType: SCALAR,
+									ValueType: TypeString,
 									Key:       "",
-									Path:      "list_key.1234",
+									Path:      "set_key.0",
 									ScalarValue: &ScalarValue{
-										StringValue: "list_value_1",
+										StringValue: "set_value_1",
+										Kind:        TypeString,
 									},
 								},
 								{
 									FieldType: SCALAR,
+									ValueType: TypeString,
 									Key:       "",
-									Path:      "list_key.1235",
+									Path:      "set_key.1",
 									ScalarValue: &ScalarValue{
-										StringValue: "list_value_2",
+										StringValue: "set_value_2",
+										Kind:        TypeString,
 									},
 								},
 							},
@@ -143,16 +235,18 @@ var _ = Describe("InstanceStateParser", func() {
 			},
 		}
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"set_key": optionalSet(optionalString),
+		})}
 		Expect(*parser.Parse(&state)).To(Equal(expectedResource))
 	})
 
 	It("should parse a list with a nested entry", func() {
 		state := terraform.InstanceState{
 			Attributes: map[string]string{
-				"list_key.#":                        "1",
-				"list_key.1234.nested_scalar_key_1": "value_1",
-				"list_key.1234.nested_scalar_key_2": "value_2",
+				"list_key.#":                     "1",
+				"list_key.0.nested_scalar_key_1": "value_1",
+				"list_key.0.nested_scalar_key_2": "value_2",
 			},
 		}
 
@@ -170,29 +264,36 @@ var _ = Describe("InstanceStateParser", func() {
 				Fields: []*Field{
 					{
 						FieldType: LIST,
+						ValueType: TypeList,
 						Key:       "list_key",
 						Path:      "list_key",
 						NestedValue: &InlineResource{
 							Fields: []*Field{
 								{
 									FieldType: NESTED,
+									ValueType: TypeObject,
 									Key:       "",
+									Path:      "list_key.0",
 									NestedValue: &InlineResource{
 										Fields: []*Field{
 											{
 												FieldType: SCALAR,
+												ValueType: TypeString,
 												Key:       "nested_scalar_key_1",
-												Path:      "list_key.1234.nested_scalar_key_1",
+												Path:      "list_key.0.nested_scalar_key_1",
 												ScalarValue: &ScalarValue{
 													StringValue: "value_1",
+													Kind:        TypeString,
 												},
 											},
 											{
 												FieldType: SCALAR,
+												ValueType: TypeString,
 												Key:       "nested_scalar_key_2",
-												Path:      "list_key.1234.nested_scalar_key_2",
+												Path:      "list_key.0.nested_scalar_key_2",
 												ScalarValue: &ScalarValue{
 													StringValue: "value_2",
+													Kind:        TypeString,
 												},
 											},
 										},
@@ -205,8 +306,43 @@ var _ = Describe("InstanceStateParser", func() {
 			},
 		}
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"list_key": optionalList(nestedResource(map[string]*schema.Schema{
+				"nested_scalar_key_1": optionalString,
+				"nested_scalar_key_2": optionalString,
+			})),
+		})}
 		x := *parser.Parse(&state)
 		Expect(x).To(Equal(expectedResource))
 	})
+
+	It("should parse maps inside lists and omit empty collections", func() {
+		state := terraform.InstanceState{
+			Attributes: map[string]string{
+				"empty_list.#":           "0",
+				"list_key.#":             "1",
+				"list_key.0.tags.%":      "1",
+				"list_key.0.tags.a.b.c":  "dotted",
+				"list_key.0.empty_set.#": "0",
+			},
+		}
+
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"empty_list": optionalList(optionalString),
+			"list_key": optionalList(nestedResource(map[string]*schema.Schema{
+				"empty_set": optionalSet(optionalString),
+				"tags":      optionalMap,
+			})),
+		})}
+		resource := parser.Parse(&state)
+		Expect(resource.Fields.Fields).To(HaveLen(1))
+
+		element := resource.Fields.Fields[0].NestedValue.Fields[0]
+		Expect(element.NestedValue.Fields).To(HaveLen(1))
+
+		tags := element.NestedValue.Fields[0]
+		Expect(tags.FieldType).To(Equal(MAP))
+		Expect(tags.NestedValue.Fields[0].Key).To(Equal("a.b.c"))
+		Expect(tags.NestedValue.Fields[0].Path).To(Equal("list_key.0.tags.a.b.c"))
+	})
 })
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// JSONConfig is configuration in Terraform's JSON syntax (a .tf.json file), built from the same Resource tree as
+// the Printer. Unlike the Printer, every value is written with encoding/json, so any string survives exactly.
+// Resources, data sources, providers and import blocks are added to it, and it is then written as one JSON object.
+type JSONConfig struct {
+	// The syntax of the Terraform version which will read the configuration. Terraform interpolates ${ in every
+	// JSON string, and from HCL2 onwards %{ as well, so these are escaped in values.
+	Syntax Syntax
+
+	root jsonObject
+}
+
+// AddResource adds a resource or data source, making substitutions in its values.
+func (c *JSONConfig) AddResource(resource *Resource, substitutions []*Substitution) {
+	keyword := "resource"
+	if resource.DataSource {
+		keyword = "data"
+	}
+
+	body := &jsonObject{}
+	if resource.Provider != "" {
+		body.set("provider", resource.Provider)
+	}
+	c.addFields(body, resource.Fields, substitutions)
+	if len(resource.IgnoreChanges) > 0 {
+		body.object("lifecycle").set("ignore_changes", resource.IgnoreChanges)
+	}
+
+	c.root.object(keyword).object(resource.Type).set(resource.Name, body)
+}
+
+// AddProvider adds a provider configuration. Each provider may be configured more than once, e.g. for each region.
+func (c *JSONConfig) AddProvider(name string, fields *InlineResource) {
+	body := &jsonObject{}
+	c.addFields(body, fields, nil)
+
+	providers := c.root.object("provider")
+	configurations, _ := providers.get(name).([]interface{})
+	providers.set(name, append(configurations, body))
+}
+
+// AddImport adds an import block (Terraform 1.5+) for resource.
+func (c *JSONConfig) AddImport(resource *Resource, id string) {
+	body := &jsonObject{}
+	body.set("to", resource.Address())
+	body.set("id", c.escape(id))
+	if resource.Provider != "" {
+		body.set("provider", resource.Provider)
+	}
+
+	imports, _ := c.root.get("import").([]interface{})
+	c.root.set("import", append(imports, body))
+}
+
+// Empty returns true if nothing has been added.
+func (c *JSONConfig) Empty() bool {
+	return len(c.root.keys) == 0
+}
+
+func (c *JSONConfig) Print() string {
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", strings.Repeat(" ", INDENT))
+
+	// Nothing in a configuration can fail to encode
+	if err := encoder.Encode(&c.root); err != nil {
+		panic(err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func (c *JSONConfig) PrintToFile(file *os.File) error {
+	_, err := file.WriteString(c.Print() + "\n")
+	return err
+}
+
+// Add every field of r to object. Fields are left out in the same cases as the Printer leaves them out.
+func (c *JSONConfig) addFields(object *jsonObject, r *InlineResource, substitutions []*Substitution) {
+	if r == nil {
+		return
+	}
+
+	for _, field := range r.Fields {
+		if field.Computed {
+			continue
+		}
+
+		if field.FieldType == SCALAR && field.Link == "" && field.ScalarValue.Kind == TypeString &&
+			field.ScalarValue.StringValue == "" {
+			continue
+		}
+
+		object.set(field.Key, c.value(field, substitutions))
+	}
+}
+
+func (c *JSONConfig) value(field *Field, substitutions []*Substitution) interface{} {
+	if field.Link != "" {
+		return "${" + field.Link + "}"
+	}
+
+	switch field.FieldType {
+	case SCALAR:
+		return c.scalar(field.ScalarValue, substitutions)
+	case MAP, NESTED:
+		object := &jsonObject{}
+		c.addFields(object, field.NestedValue, substitutions)
+		return object
+	}
+
+	// Lists and sets hold either scalars or nested resources, both of which are written as arrays. Blocks are
+	// written as an array of objects, in the same way as attributes holding a list of objects.
+	values := make([]interface{}, 0, len(field.NestedValue.Fields))
+	for _, element := range field.NestedValue.Fields {
+		values = append(values, c.value(element, substitutions))
+	}
+	return values
+}
+
+func (c *JSONConfig) scalar(value *ScalarValue, substitutions []*Substitution) interface{} {
+	switch value.Kind {
+	case TypeBool:
+		return value.BoolValue
+	case TypeInt:
+		return value.IntValue
+	case TypeFloat:
+		return value.FloatValue
+	}
+	return substitute(value.StringValue, substitutions, c.escape)
+}
+
+// Escape the template sequences which Terraform would interpolate.
+func (c *JSONConfig) escape(value string) string {
+	value = strings.Replace(value, "${", "$${", -1)
+	if c.Syntax == HCL2 {
+		value = strings.Replace(value, "%{", "%%{", -1)
+	}
+	return value
+}
+
+// A JSON object which keeps its keys in the order they were added, so that fields are written in the same order
+// as they are by the Printer.
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *jsonObject) get(key string) interface{} {
+	return o.values[key]
+}
+
+func (o *jsonObject) set(key string, value interface{}) {
+	if o.values == nil {
+		o.values = make(map[string]interface{})
+	}
+
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+// The object stored under key, which is created the first time it is needed.
+func (o *jsonObject) object(key string) *jsonObject {
+	if object, ok := o.get(key).(*jsonObject); ok {
+		return object
+	}
+
+	object := &jsonObject{}
+	o.set(key, object)
+	return object
+}
+
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	buf.WriteString("{")
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		if err := encoder.Encode(key); err != nil {
+			return nil, err
+		}
+		buf.WriteString(":")
+		if err := encoder.Encode(o.values[key]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,196 @@
+package core_test
+
+import (
+	"encoding/json"
+
+	. "github.com/jmcgill/formation/core"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JSONConfig", func() {
+	resource := func() *Resource {
+		return &Resource{
+			Name:     "test",
+			Type:     "aws_s3_bucket",
+			Provider: "aws.use1",
+			Fields: &InlineResource{
+				Fields: []*Field{
+					{
+						FieldType:   SCALAR,
+						Key:         "bucket",
+						ScalarValue: NewScalarValue("logs-123456789012", TypeString),
+					},
+					{
+						FieldType:   SCALAR,
+						Key:         "policy",
+						ScalarValue: NewScalarValue("{\n  \"Resource\": \"arn:aws:s3:::logs/${aws:username}/*\"\n}", TypeString),
+					},
+					{
+						FieldType:   SCALAR,
+						Key:         "acl",
+						ScalarValue: NewScalarValue("", TypeString),
+					},
+					{
+						FieldType:   SCALAR,
+						Key:         "force_destroy",
+						ScalarValue: NewScalarValue("true", TypeBool),
+					},
+					{
+						FieldType: SCALAR,
+						Key:       "arn",
+						Computed:  true,
+					},
+					{
+						FieldType: SCALAR,
+						Key:       "kms_key_id",
+						Link:      "aws_kms_key.logs.arn",
+					},
+					{
+						FieldType: MAP,
+						Key:       "tags",
+						NestedValue: &InlineResource{
+							Fields: []*Field{
+								{
+									FieldType:   SCALAR,
+									Key:         "team:name",
+									ScalarValue: NewScalarValue("a \"quoted\" \\ value with %{directive}", TypeString),
+								},
+							},
+						},
+					},
+					{
+						FieldType: LIST,
+						Key:       "lifecycle_rule",
+						NestedValue: &InlineResource{
+							Fields: []*Field{
+								{
+									FieldType: NESTED,
+									NestedValue: &InlineResource{
+										Fields: []*Field{
+											{
+												FieldType:   SCALAR,
+												Key:         "expiration_days",
+												ScalarValue: NewScalarValue("30", TypeInt),
+											},
+											{
+												FieldType: LIST,
+												Key:       "prefixes",
+												NestedValue: &InlineResource{
+													Fields: []*Field{
+														{
+															FieldType:   SCALAR,
+															ScalarValue: NewScalarValue("tmp/", TypeString),
+														},
+														{
+															FieldType: SCALAR,
+															Link:      "aws_s3_bucket.other.id",
+														},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	It("should write a resource", func() {
+		config := JSONConfig{Syntax: HCL2}
+		config.AddResource(resource(), nil)
+		Expect(config.Print()).To(Equal(ContentsOf("json_config.json")))
+	})
+
+	It("should keep every value exactly", func() {
+		config := JSONConfig{Syntax: HCL2}
+		config.AddResource(resource(), nil)
+
+		var decoded map[string]map[string]map[string]map[string]interface{}
+		Expect(json.Unmarshal([]byte(config.Print()), &decoded)).ShouldNot(HaveOccurred())
+
+		body := decoded["resource"]["aws_s3_bucket"]["test"]
+		Expect(body["policy"]).To(Equal("{\n  \"Resource\": \"arn:aws:s3:::logs/$${aws:username}/*\"\n}"))
+		Expect(body["tags"]).To(Equal(map[string]interface{}{"team:name": "a \"quoted\" \\ value with %%{directive}"}))
+		Expect(body["force_destroy"]).To(Equal(true))
+		Expect(body).ToNot(HaveKey("acl"))
+		Expect(body).ToNot(HaveKey("arn"))
+	})
+
+	It("should ignore changes in a lifecycle block", func() {
+		r := resource()
+		r.IgnoreChanges = []string{"policy"}
+
+		config := JSONConfig{Syntax: HCL2}
+		config.AddResource(r, nil)
+
+		var decoded map[string]map[string]map[string]map[string]interface{}
+		Expect(json.Unmarshal([]byte(config.Print()), &decoded)).ShouldNot(HaveOccurred())
+
+		body := decoded["resource"]["aws_s3_bucket"]["test"]
+		Expect(body["lifecycle"]).To(Equal(map[string]interface{}{"ignore_changes": []interface{}{"policy"}}))
+	})
+
+	It("should only escape directives from HCL2 onwards", func() {
+		config := JSONConfig{Syntax: HCL1}
+		config.AddResource(resource(), nil)
+
+		var decoded map[string]map[string]map[string]map[string]interface{}
+		Expect(json.Unmarshal([]byte(config.Print()), &decoded)).ShouldNot(HaveOccurred())
+		Expect(decoded["resource"]["aws_s3_bucket"]["test"]["tags"]).To(Equal(map[string]interface{}{"team:name": "a \"quoted\" \\ value with %{directive}"}))
+	})
+
+	It("should make substitutions", func() {
+		substitutions := []*Substitution{
+			{Literal: "123456789012", Expression: "data.aws_caller_identity.current.account_id"},
+		}
+
+		config := JSONConfig{Syntax: HCL2}
+		config.AddResource(resource(), substitutions)
+
+		var decoded map[string]map[string]map[string]map[string]interface{}
+		Expect(json.Unmarshal([]byte(config.Print()), &decoded)).ShouldNot(HaveOccurred())
+		Expect(decoded["resource"]["aws_s3_bucket"]["test"]["bucket"]).To(Equal("logs-${data.aws_caller_identity.current.account_id}"))
+	})
+
+	It("should write providers, data sources and import blocks", func() {
+		provider := func(alias string, region string) *InlineResource {
+			return &InlineResource{
+				Fields: []*Field{
+					{FieldType: SCALAR, Key: "alias", ScalarValue: NewScalarValue(alias, TypeString)},
+					{FieldType: SCALAR, Key: "region", ScalarValue: NewScalarValue(region, TypeString)},
+				},
+			}
+		}
+
+		vpc := &Resource{
+			Name:       "vpc-1234",
+			Type:       "aws_vpc",
+			DataSource: true,
+			Fields: &InlineResource{
+				Fields: []*Field{
+					{FieldType: SCALAR, Key: "id", ScalarValue: NewScalarValue("vpc-1234", TypeString)},
+				},
+			},
+		}
+
+		config := JSONConfig{Syntax: HCL2}
+		config.AddProvider("aws", provider("use1", "us-east-1"))
+		config.AddProvider("aws", provider("euw1", "eu-west-1"))
+		config.AddResource(vpc, nil)
+		config.AddImport(&Resource{Name: "test", Type: "aws_s3_bucket"}, "my-${bucket}")
+		Expect(config.Print()).To(Equal(ContentsOf("json_config_blocks.json")))
+	})
+
+	It("should be empty until something is added", func() {
+		config := JSONConfig{}
+		Expect(config.Empty()).To(BeTrue())
+		config.AddResource(&Resource{Name: "test", Type: "aws_vpc"}, nil)
+		Expect(config.Empty()).To(BeFalse())
+	})
+})
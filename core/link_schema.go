@@ -13,6 +13,7 @@ const (
 	TypeMap
 	TypeSet
 	TypeLink
+	TypeObject
 )
 
 type LinkResource struct {
@@ -0,0 +1,244 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// String values are written as templates, so as well as quotes and backslashes, anything Terraform would interpolate
+// must be escaped. In HCL1 (Terraform 0.11) strings are unquoted by HCL and then interpolated by HIL, and each has
+// its own rules. In HCL2 both happen at once.
+
+// HCL1 identifiers may also contain dots, e.g. a tag named I.Have.Dots
+var hcl1IdentifierPattern = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_.-]*$")
+
+// Object keys which would be read as something other than a string if they were not quoted
+var keywords = map[string]bool{"true": true, "false": true, "null": true, "for": true}
+
+// Quote a string as a template in the syntax being printed, making any substitutions.
+func (p *Printer) quote(value string) string {
+	if p.Syntax == HCL2 {
+		return "\"" + p.template(value, escapeHCL2) + "\""
+	}
+	return "\"" + p.template(value, escapeHCL1) + "\""
+}
+
+// A string value, written as a heredoc if it is made up of whole lines, and otherwise quoted.
+func (p *Printer) literal(value string) string {
+	delimiter, ok := heredocDelimiter(value)
+	if !ok {
+		return p.quote(value)
+	}
+
+	// Nothing is unquoted in a heredoc, but it is still a template
+	if p.Syntax == HCL1 {
+		return "<<" + delimiter + "\n" + p.template(value, escapeHIL) + delimiter
+	}
+
+	// Early HCL2 parsers take the newline after the delimiter to be part of the heredoc, so another is needed to end
+	// the attribute
+	return "<<" + delimiter + "\n" + p.template(value, escapeTemplate) + delimiter + "\n"
+}
+
+// Keys which are not identifiers (e.g. map keys containing colons) must be quoted, as must map keys which are
+// keywords.
+func (p *Printer) key(key string) string {
+	pattern := hcl1IdentifierPattern
+	if p.Syntax == HCL2 {
+		pattern = identifierPattern
+	}
+
+	if pattern.MatchString(key) && !(p.inMap && keywords[key]) {
+		return key
+	}
+
+	if p.Syntax == HCL2 {
+		return quoteHCL2(key)
+	}
+	return "\"" + escapeHCL1(key) + "\""
+}
+
+// Heredocs can only hold whole lines of text without control characters. HCL1 ends a heredoc at the first line
+// which ends with its delimiter, and HCL2 at the first line which is only the delimiter, so a delimiter is chosen
+// which does neither.
+func heredocDelimiter(value string) (string, bool) {
+	if !strings.HasSuffix(value, "\n") || !utf8.ValidString(value) {
+		return "", false
+	}
+
+	for _, r := range value {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return "", false
+		}
+	}
+
+	// Early HCL2 parsers read a $ or % at the end of a line together with the newline
+	lines := strings.Split(value, "\n")
+	for _, line := range lines {
+		if strings.HasSuffix(line, "$") || strings.HasSuffix(line, "%") {
+			return "", false
+		}
+	}
+
+	delimiter := "EOF"
+	for i := 2; endsHeredoc(lines, delimiter); i++ {
+		delimiter = "EOF" + strconv.Itoa(i)
+	}
+	return delimiter, true
+}
+
+func endsHeredoc(lines []string, delimiter string) bool {
+	for _, line := range lines {
+		if strings.HasSuffix(strings.TrimSpace(line), delimiter) {
+			return true
+		}
+	}
+	return false
+}
+
+// Quote a string as an HCL2 template literal, escaping anything that would otherwise be interpreted
+// as an escape or template sequence.
+func quoteHCL2(value string) string {
+	return "\"" + escapeHCL2(value) + "\""
+}
+
+func escapeHCL2(value string) string {
+	return escapeRuns(escapeTemplate(escapeQuoted(value)))
+}
+
+// Early HCL2 parsers read a $ or % together with the byte after it, whatever that is. A run of them before a brace
+// is read in pairs, so if the run has an odd length its first $ or % is written as an escape sequence. Before an
+// escape sequence, another $ or %, a multi-byte character or the end of value (the closing quote, or an
+// interpolation) the last would swallow what follows it however long the run is, so the whole run is written as
+// escape sequences. A backslash at the end of value is also written as an escape sequence, as it would otherwise be
+// read as escaping the closing quote.
+func escapeRuns(value string) string {
+	buf := bytes.Buffer{}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '$' || c == '%' {
+			n := 1
+			for i+n < len(value) && value[i+n] == c {
+				n++
+			}
+
+			escaped := 0
+			if i+n < len(value) && value[i+n] == '{' {
+				escaped = n % 2
+			} else if i+n == len(value) || value[i+n] >= utf8.RuneSelf || strings.IndexByte("\\$%", value[i+n]) != -1 {
+				escaped = n
+			}
+
+			buf.WriteString(strings.Repeat(fmt.Sprintf("\\u%04x", c), escaped))
+			buf.WriteString(value[i+escaped : i+n])
+			i += n - 1
+			continue
+		}
+
+		if c == '\\' && i == len(value)-2 && value[i+1] == '\\' {
+			buf.WriteString("\\u005c")
+			break
+		}
+		buf.WriteByte(c)
+
+		// Skip the character escaped by a backslash, so that an escaped backslash is not read as the start of another
+		if c == '\\' && i+1 < len(value) {
+			buf.WriteByte(value[i+1])
+			i++
+		}
+	}
+	return buf.String()
+}
+
+// HCL2 reads $${ as ${ and %%{ as %{.
+func escapeTemplate(value string) string {
+	r := strings.NewReplacer(
+		"${", "$${",
+		"%{", "%%{",
+	)
+	return r.Replace(value)
+}
+
+func escapeHCL1(value string) string {
+	return escapeHCL1Braces(escapeQuoted(escapeHIL(value)))
+}
+
+// HIL reads $$ as $, so a $ is doubled wherever it would otherwise start an interpolation or an escape. A $ at the
+// end of value is also doubled, in case value is followed by an interpolation.
+func escapeHIL(value string) string {
+	buf := bytes.Buffer{}
+	for i := 0; i < len(value); i++ {
+		buf.WriteByte(value[i])
+		if value[i] == '$' && (i == len(value)-1 || value[i+1] == '$' || value[i+1] == '{') {
+			buf.WriteByte('$')
+		}
+	}
+	return buf.String()
+}
+
+// HCL1 copies everything from ${ to the matching } without unquoting it, even when the $ is escaped for HIL. The {
+// is written as an escape sequence unless what it encloses reads the same either way.
+func escapeHCL1Braces(value string) string {
+	buf := bytes.Buffer{}
+	for i := 0; i < len(value); i++ {
+		buf.WriteByte(value[i])
+		if value[i] != '$' || i+1 == len(value) || value[i+1] != '{' {
+			continue
+		}
+
+		end := matchingBrace(value, i+1)
+		if end == -1 || strings.ContainsAny(value[i+1:end], "\\\"") {
+			buf.WriteString("\\u007b")
+			i++
+		}
+	}
+	return buf.String()
+}
+
+// The index of the } which closes the { at open, or -1.
+func matchingBrace(value string, open int) int {
+	depth := 0
+	for i := open; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Escape quotes, backslashes and control characters, which both syntaxes write in the same way.
+func escapeQuoted(value string) string {
+	buf := bytes.Buffer{}
+	for _, r := range value {
+		switch r {
+		case '\\':
+			buf.WriteString("\\\\")
+		case '"':
+			buf.WriteString("\\\"")
+		case '\n':
+			buf.WriteString("\\n")
+		case '\r':
+			buf.WriteString("\\r")
+		case '\t':
+			buf.WriteString("\\t")
+		default:
+			if unicode.IsControl(r) {
+				fmt.Fprintf(&buf, "\\u%04x", r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	return buf.String()
+}
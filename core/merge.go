@@ -0,0 +1,155 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// MergePolicy decides what happens when an imported resource is already in the state being merged into.
+type MergePolicy int
+
+const (
+	// Keep the existing state of the resource, and discard the imported state
+	KeepExisting MergePolicy = iota
+
+	// Replace the existing state of the resource with the imported state
+	Overwrite
+
+	// Refuse to merge
+	FailOnConflict
+)
+
+func ParseMergePolicy(name string) (MergePolicy, error) {
+	switch name {
+	case "keep-existing":
+		return KeepExisting, nil
+	case "overwrite":
+		return Overwrite, nil
+	case "fail":
+		return FailOnConflict, nil
+	}
+	return 0, fmt.Errorf("unknown merge policy %s, expected keep-existing, overwrite or fail", name)
+}
+
+// MergeEntry identifies a resource in a state file by its address (Type and Name) and its primary ID.
+type MergeEntry struct {
+	Type string
+	Name string
+	ID   string
+
+	// The alias of the provider which manages the resource, if any. Resources in different regions may have the
+	// same ID.
+	ProviderAlias string
+
+	// Set by PlanMerge for imported resources. Whether the imported state should be written.
+	WriteState bool
+}
+
+func (e *MergeEntry) address() string {
+	return e.Type + "." + e.Name
+}
+
+func (e *MergeEntry) key() string {
+	return e.Type + "." + e.ProviderAlias + "." + e.ID
+}
+
+// MergeConflict describes an imported resource which was already in the existing state.
+type MergeConflict struct {
+	Type string
+	ID   string
+
+	// The name of the resource in the existing state, which is kept
+	ExistingName string
+
+	// The name the resource would have been given had it not been in the existing state
+	ImportedName string
+
+	Policy MergePolicy
+}
+
+func (c *MergeConflict) String() string {
+	var resolution string
+	switch c.Policy {
+	case KeepExisting:
+		resolution = "keeping existing state"
+	case Overwrite:
+		resolution = "overwriting existing state"
+	default:
+		resolution = "refusing to merge"
+	}
+	return fmt.Sprintf("%s %s is already in state as %s.%s (imported as %s), %s", c.Type, c.ID, c.Type, c.ExistingName, c.ImportedName, resolution)
+}
+
+// PlanMerge decides how imported resources are merged into existing state. Imported resources are matched to
+// existing resources by type, provider and ID, rather than by address, and take the name of the resource they
+// match so that references to that resource stay intact. Every match is a conflict, which is resolved according
+// to policy. Imported resources which do not match are renamed if their address is already taken by another
+// resource.
+//
+// The Name and WriteState of every imported entry are updated in place.
+func PlanMerge(existing []*MergeEntry, imported []*MergeEntry, policy MergePolicy) []*MergeConflict {
+	byID := make(map[string]*MergeEntry)
+	taken := make(map[string]bool)
+	for _, e := range existing {
+		taken[e.address()] = true
+		if e.ID != "" {
+			byID[e.key()] = e
+		}
+	}
+
+	var conflicts []*MergeConflict
+	var unmatched []*MergeEntry
+	for _, e := range imported {
+		match, ok := byID[e.key()]
+		if !ok || e.ID == "" {
+			e.WriteState = true
+			unmatched = append(unmatched, e)
+			continue
+		}
+
+		conflicts = append(conflicts, &MergeConflict{
+			Type:         e.Type,
+			ID:           e.ID,
+			ExistingName: match.Name,
+			ImportedName: e.Name,
+			Policy:       policy,
+		})
+		e.Name = match.Name
+		e.WriteState = policy == Overwrite
+
+		// The same resource may only be imported once
+		delete(byID, e.key())
+	}
+
+	// Resources which are new to the state keep their name, unless another resource already has that address
+	reserveNames(taken, unmatched)
+
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		if conflicts[i].Type != conflicts[j].Type {
+			return conflicts[i].Type < conflicts[j].Type
+		}
+		return conflicts[i].ExistingName < conflicts[j].ExistingName
+	})
+	return conflicts
+}
+
+// ReserveNames renames imported resources whose address is already used by one of the resources in taken.
+func ReserveNames(taken []*MergeEntry, imported []*MergeEntry) {
+	addresses := make(map[string]bool)
+	for _, e := range taken {
+		addresses[e.address()] = true
+	}
+	reserveNames(addresses, imported)
+}
+
+func reserveNames(taken map[string]bool, imported []*MergeEntry) {
+	for _, e := range imported {
+		name := e.Name
+		for i := 2; taken[e.Type+"."+name]; i++ {
+			name = e.Name + "-" + strconv.Itoa(i)
+		}
+		e.Name = name
+		taken[e.address()] = true
+	}
+}
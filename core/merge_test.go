@@ -0,0 +1,97 @@
+package core_test
+
+import (
+	. "github.com/jmcgill/formation/core"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PlanMerge", func() {
+	var existing []*MergeEntry
+
+	BeforeEach(func() {
+		existing = []*MergeEntry{
+			{Type: "aws_iam_role", Name: "deploy", ID: "deploy-role"},
+			{Type: "aws_iam_role_policy", Name: "deploy", ID: "deploy-role:policy"},
+			{Type: "aws_vpc", Name: "main", ID: "vpc-1234"},
+		}
+	})
+
+	It("should keep the existing name of a resource which is already in state", func() {
+		imported := []*MergeEntry{
+			{Type: "aws_iam_role", Name: "deploy_role", ID: "deploy-role"},
+		}
+
+		conflicts := PlanMerge(existing, imported, Overwrite)
+		Expect(imported[0].Name).To(Equal("deploy"))
+		Expect(imported[0].WriteState).To(BeTrue())
+		Expect(conflicts).To(HaveLen(1))
+		Expect(conflicts[0].String()).To(Equal("aws_iam_role deploy-role is already in state as aws_iam_role.deploy (imported as deploy_role), overwriting existing state"))
+	})
+
+	It("should keep the existing state when asked to", func() {
+		imported := []*MergeEntry{
+			{Type: "aws_vpc", Name: "vpc-1234", ID: "vpc-1234"},
+		}
+
+		conflicts := PlanMerge(existing, imported, KeepExisting)
+		Expect(imported[0].Name).To(Equal("main"))
+		Expect(imported[0].WriteState).To(BeFalse())
+		Expect(conflicts).To(HaveLen(1))
+	})
+
+	It("should only match resources of the same type", func() {
+		imported := []*MergeEntry{
+			{Type: "aws_iam_role_policy", Name: "deploy", ID: "deploy-role"},
+		}
+
+		conflicts := PlanMerge(existing, imported, FailOnConflict)
+		Expect(conflicts).To(BeEmpty())
+		Expect(imported[0].WriteState).To(BeTrue())
+
+		// The address is taken by a different resource, so the imported resource is renamed
+		Expect(imported[0].Name).To(Equal("deploy-2"))
+	})
+
+	It("should not give a new resource the name of a matched resource", func() {
+		imported := []*MergeEntry{
+			{Type: "aws_vpc", Name: "main", ID: "vpc-5678"},
+			{Type: "aws_vpc", Name: "default", ID: "vpc-1234"},
+		}
+
+		PlanMerge(existing, imported, Overwrite)
+		Expect(imported[0].Name).To(Equal("main-2"))
+		Expect(imported[1].Name).To(Equal("main"))
+	})
+
+	It("should match resources managed by the same provider", func() {
+		existing = append(existing, &MergeEntry{Type: "aws_vpc", Name: "main-euw1", ID: "vpc-1234", ProviderAlias: "euw1"})
+		imported := []*MergeEntry{
+			{Type: "aws_vpc", Name: "main", ID: "vpc-1234", ProviderAlias: "euw1"},
+		}
+
+		PlanMerge(existing, imported, Overwrite)
+		Expect(imported[0].Name).To(Equal("main-euw1"))
+	})
+
+	It("should not reuse reserved names", func() {
+		imported := []*MergeEntry{
+			{Type: "aws_vpc", Name: "main", ID: "vpc-5678"},
+			{Type: "aws_subnet", Name: "main", ID: "subnet-1234"},
+		}
+
+		ReserveNames(existing, imported)
+		Expect(imported[0].Name).To(Equal("main-2"))
+		Expect(imported[1].Name).To(Equal("main"))
+	})
+
+	It("should reject unknown policies", func() {
+		_, err := ParseMergePolicy("merge")
+		Expect(err).To(HaveOccurred())
+
+		policy, err := ParseMergePolicy("keep-existing")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy).To(Equal(KeepExisting))
+	})
+})
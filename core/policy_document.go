@@ -0,0 +1,304 @@
+package core
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// IAM policies are stored as JSON strings. ParsePolicyDocument converts them into the arguments of an
+// aws_iam_policy_document data source, with a statement block for each statement, so that the policy can be
+// written as configuration and its principals and resources can link to other resources.
+
+type policyDocument struct {
+	Version   string
+	Id        string
+	Statement json.RawMessage
+}
+
+type policyStatement struct {
+	Sid          string
+	Effect       string
+	Action       interface{}
+	NotAction    interface{}
+	Resource     interface{}
+	NotResource  interface{}
+	Principal    interface{}
+	NotPrincipal interface{}
+	Condition    map[string]map[string]interface{}
+}
+
+// The only policy language version aws_iam_policy_document can write
+const policyVersion = "2012-10-17"
+
+// ParsePolicyDocument returns the arguments of an aws_iam_policy_document data source equivalent to policy, or
+// false if policy is not an IAM policy or uses anything that the data source cannot express.
+func ParsePolicyDocument(policy string) (*InlineResource, bool) {
+	document := &policyDocument{}
+	if !decodeStrict(policy, document) {
+		return nil, false
+	}
+
+	if document.Version != "" && document.Version != policyVersion {
+		return nil, false
+	}
+
+	// Statement may be a single statement or a list of statements
+	var statements []*policyStatement
+	if !decodeStrict(string(document.Statement), &statements) {
+		statement := &policyStatement{}
+		if !decodeStrict(string(document.Statement), statement) {
+			return nil, false
+		}
+		statements = []*policyStatement{statement}
+	}
+
+	if len(statements) == 0 {
+		return nil, false
+	}
+
+	fields := &InlineResource{}
+	if document.Id != "" {
+		fields.Append(policyField("policy_id", document.Id))
+	}
+
+	blocks := make([]*InlineResource, 0, len(statements))
+	for _, statement := range statements {
+		block, ok := statementFields(statement)
+		if !ok {
+			return nil, false
+		}
+		blocks = append(blocks, block)
+	}
+	fields.Append(blockField("statement", blocks))
+
+	return fields, true
+}
+
+// Decode JSON into v, failing on any key that v does not have.
+func decodeStrict(value string, v interface{}) bool {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v) == nil && !decoder.More()
+}
+
+func statementFields(statement *policyStatement) (*InlineResource, bool) {
+	fields := &InlineResource{}
+	if statement.Sid != "" {
+		fields.Append(policyField("sid", statement.Sid))
+	}
+	if statement.Effect != "" {
+		fields.Append(policyField("effect", statement.Effect))
+	}
+
+	lists := []struct {
+		key   string
+		value interface{}
+	}{
+		{"actions", statement.Action},
+		{"not_actions", statement.NotAction},
+		{"resources", statement.Resource},
+		{"not_resources", statement.NotResource},
+	}
+	for _, list := range lists {
+		values, ok := stringList(list.value)
+		if !ok {
+			return nil, false
+		}
+		if len(values) > 0 {
+			fields.Append(listField(list.key, values))
+		}
+	}
+
+	principals := []struct {
+		key   string
+		value interface{}
+	}{
+		{"principals", statement.Principal},
+		{"not_principals", statement.NotPrincipal},
+	}
+	for _, principal := range principals {
+		blocks, ok := principalBlocks(principal.value)
+		if !ok {
+			return nil, false
+		}
+		if len(blocks) > 0 {
+			fields.Append(blockField(principal.key, blocks))
+		}
+	}
+
+	conditions, ok := conditionBlocks(statement.Condition)
+	if !ok {
+		return nil, false
+	}
+	if len(conditions) > 0 {
+		fields.Append(blockField("condition", conditions))
+	}
+
+	return fields, true
+}
+
+// Principals are either "*" (anyone) or map principal types to one or more identifiers.
+func principalBlocks(value interface{}) ([]*InlineResource, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, true
+	case string:
+		if v != "*" {
+			return nil, false
+		}
+		// IAM considers "*" to be equivalent to {"AWS": "*"}
+		return []*InlineResource{principalBlock("AWS", []string{"*"})}, true
+	case map[string]interface{}:
+		var blocks []*InlineResource
+		for _, principalType := range sortedKeys(v) {
+			identifiers, ok := stringList(v[principalType])
+			if !ok || len(identifiers) == 0 {
+				return nil, false
+			}
+			blocks = append(blocks, principalBlock(principalType, identifiers))
+		}
+		return blocks, true
+	}
+	return nil, false
+}
+
+func principalBlock(principalType string, identifiers []string) *InlineResource {
+	block := &InlineResource{}
+	block.Append(policyField("type", principalType))
+	block.Append(listField("identifiers", identifiers))
+	return block
+}
+
+// Conditions map a test (e.g. StringEquals) to variables, each of which has one or more values.
+func conditionBlocks(conditions map[string]map[string]interface{}) ([]*InlineResource, bool) {
+	tests := make([]string, 0, len(conditions))
+	for test := range conditions {
+		tests = append(tests, test)
+	}
+	sort.Strings(tests)
+
+	var blocks []*InlineResource
+	for _, test := range tests {
+		variables := make([]string, 0, len(conditions[test]))
+		for variable := range conditions[test] {
+			variables = append(variables, variable)
+		}
+		sort.Strings(variables)
+
+		for _, variable := range variables {
+			values, ok := stringList(conditions[test][variable])
+			if !ok || len(values) == 0 {
+				return nil, false
+			}
+
+			block := &InlineResource{}
+			block.Append(policyField("test", test))
+			block.Append(policyField("variable", variable))
+			block.Append(listField("values", values))
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, true
+}
+
+// Most policy elements may be either a single value or a list of values. Condition values may also be numbers or
+// booleans, which IAM compares as strings.
+func stringList(value interface{}) ([]string, bool) {
+	switch v := value.(type) {
+	case nil:
+		return nil, true
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, e := range v {
+			s, ok := scalarString(e)
+			if !ok {
+				return nil, false
+			}
+			values = append(values, s)
+		}
+		return values, true
+	}
+
+	s, ok := scalarString(value)
+	if !ok {
+		return nil, false
+	}
+	return []string{s}, true
+}
+
+func scalarString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		if v {
+			return "true", true
+		}
+		return "false", true
+	}
+	return "", false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Policy variables such as ${aws:username} are written as &{aws:username}, which aws_iam_policy_document converts
+// back, so that Terraform does not try to interpolate them.
+func policyValue(value string) string {
+	return strings.Replace(value, "${", "&{", -1)
+}
+
+func policyField(key string, value string) *Field {
+	return &Field{
+		FieldType:   SCALAR,
+		ValueType:   TypeString,
+		Key:         key,
+		Path:        key,
+		ScalarValue: NewScalarValue(policyValue(value), TypeString),
+	}
+}
+
+func listField(key string, values []string) *Field {
+	list := &InlineResource{}
+	for _, value := range values {
+		list.Append(&Field{
+			FieldType:   SCALAR,
+			ValueType:   TypeString,
+			ScalarValue: NewScalarValue(policyValue(value), TypeString),
+		})
+	}
+
+	return &Field{
+		FieldType:   LIST,
+		ValueType:   TypeList,
+		Key:         key,
+		NestedValue: list,
+	}
+}
+
+func blockField(key string, blocks []*InlineResource) *Field {
+	list := &InlineResource{}
+	for _, block := range blocks {
+		list.Append(&Field{
+			FieldType:   NESTED,
+			NestedValue: block,
+		})
+	}
+
+	return &Field{
+		FieldType:   LIST,
+		ValueType:   TypeList,
+		Key:         key,
+		NestedValue: list,
+	}
+}
@@ -0,0 +1,61 @@
+package core_test
+
+import (
+	. "github.com/jmcgill/formation/core"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PolicyDocument", func() {
+	It("should convert a policy into statement blocks", func() {
+		policy := `{
+			"Version": "2012-10-17",
+			"Statement": [
+				{
+					"Sid": "Read",
+					"Effect": "Allow",
+					"Principal": {"AWS": ["arn:aws:iam::123456789012:role/reader"], "Service": "ec2.amazonaws.com"},
+					"Action": ["s3:GetObject", "s3:ListBucket"],
+					"Resource": "arn:aws:s3:::bucket/${aws:username}/*",
+					"Condition": {"Bool": {"aws:SecureTransport": true}}
+				},
+				{
+					"Effect": "Deny",
+					"Principal": "*",
+					"NotAction": "s3:*"
+				}
+			]
+		}`
+
+		fields, ok := ParsePolicyDocument(policy)
+		Expect(ok).To(BeTrue())
+
+		resource := Resource{Name: "test", Type: "aws_iam_policy_document", DataSource: true, Fields: fields}
+		printer := Printer{Syntax: HCL2}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("policy_document.hcl")))
+	})
+
+	It("should accept a single statement", func() {
+		fields, ok := ParsePolicyDocument(`{"Statement": {"Effect": "Allow", "Action": "sqs:*", "Resource": "*"}}`)
+		Expect(ok).To(BeTrue())
+		Expect(fields.Fields).To(HaveLen(1))
+		Expect(fields.Fields[0].Key).To(Equal("statement"))
+		Expect(fields.Fields[0].NestedValue.Fields).To(HaveLen(1))
+	})
+
+	It("should reject policies which cannot be expressed as a data source", func() {
+		policies := []string{
+			`not a policy`,
+			`{"Version": "2008-10-17", "Statement": [{"Effect": "Allow", "Action": "*", "Resource": "*"}]}`,
+			`{"Statement": [{"Effect": "Allow", "Action": "*", "Resource": "*", "Unknown": "value"}]}`,
+			`{"Statement": [{"Effect": "Allow", "Principal": "arn:aws:iam::123456789012:root", "Action": "*"}]}`,
+			`{"Statement": []}`,
+		}
+
+		for _, policy := range policies {
+			_, ok := ParsePolicyDocument(policy)
+			Expect(ok).To(BeFalse(), policy)
+		}
+	})
+})
@@ -2,18 +2,63 @@ package core
 
 import (
 	"bytes"
-	//"encoding/json"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/hashicorp/terraform/config/configschema"
 )
 
 const INDENT = 4
 
+// Syntax is the configuration language version that the Printer emits.
+type Syntax int
+
+const (
+	// Terraform 0.11 and earlier - every reference is an interpolation string and every
+	// nested value is written as a block.
+	HCL1 Syntax = iota
+
+	// Terraform 0.12 and later - bare references, attribute syntax for maps and block
+	// syntax only where the provider schema declares a nested block.
+	HCL2
+)
+
+// ParseSyntax converts the name of a syntax, as supplied on the command line, into a Syntax.
+func ParseSyntax(name string) (Syntax, error) {
+	switch name {
+	case "hcl1", "0.11":
+		return HCL1, nil
+	case "hcl2", "0.12":
+		return HCL2, nil
+	}
+	return HCL1, fmt.Errorf("unknown syntax %q, expected hcl1 or hcl2", name)
+}
+
+var identifierPattern = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_-]*$")
+
 type Printer struct {
+	// The syntax to emit. Defaults to HCL1.
+	Syntax Syntax
+
+	// The provider schema for the resource being printed. This is only used when printing HCL2,
+	// to decide whether a nested list should be written as blocks or as an attribute. If no schema
+	// is provided every nested list is written as blocks.
+	Schema *configschema.Block
+
+	// Substrings of string values to replace with references, e.g. an account ID. Links take precedence.
+	Substitutions []*Substitution
+
 	output        *io.Writer
 	currentIndent int
+
+	// True while printing the entries of a map, whose keys are quoted if they are keywords
+	inMap bool
 }
 
 func (p *Printer) write(format string, a ...interface{}) {
@@ -29,7 +74,7 @@ func (p *Printer) unindent() {
 	p.currentIndent -= INDENT
 }
 
-func (p *Printer) printInlineResource(resource *InlineResource) {
+func (p *Printer) printInlineResource(resource *InlineResource, schema *configschema.Block) {
 	if resource == nil {
 		return
 	}
@@ -37,19 +82,26 @@ func (p *Printer) printInlineResource(resource *InlineResource) {
 	p.indent()
 
 	for _, v := range resource.Fields {
-		p.printField(v)
+		p.printField(v, schema)
 	}
 
 	p.unindent()
 }
 
 func (p *Printer) printMap(key string, resource *InlineResource) {
-	p.write("%s {\n", key)
+	if p.Syntax == HCL2 {
+		p.write("%s = {\n", key)
+	} else {
+		p.write("%s {\n", key)
+	}
 	p.indent()
 
+	inMap := p.inMap
+	p.inMap = true
 	for _, field := range resource.Fields {
-		p.printField(field)
+		p.printField(field, nil)
 	}
+	p.inMap = inMap
 
 	p.unindent()
 	p.write("}\n")
@@ -60,17 +112,25 @@ func (p *Printer) printSimpleList(key string, resource *InlineResource) {
 	p.indent()
 
 	for _, v := range resource.Fields {
-		p.write("\"%s\",\n", v.ScalarValue.StringValue)
+		if v.Link != "" && p.Syntax == HCL2 {
+			p.write("%s,\n", v.Link)
+		} else if v.Link != "" {
+			p.write("\"${%s}\",\n", v.Link)
+		} else if literal, ok := typedLiteral(v.ScalarValue); ok {
+			p.write("%s,\n", literal)
+		} else {
+			p.write("%s,\n", p.quote(v.ScalarValue.StringValue))
+		}
 	}
 
 	p.unindent()
 	p.write("]\n")
 }
 
-func (p *Printer) printRichList(key string, resource *InlineResource) {
+func (p *Printer) printRichList(key string, resource *InlineResource, schema *configschema.Block) {
 	for i, v := range resource.Fields {
 		p.write("%s {\n", key)
-		p.printInlineResource(v.NestedValue)
+		p.printInlineResource(v.NestedValue, schema)
 
 		// Place an empty line between successive nested fields, because it looks better.
 		if i == (len(resource.Fields) - 1) {
@@ -81,29 +141,57 @@ func (p *Printer) printRichList(key string, resource *InlineResource) {
 	}
 }
 
-func (p *Printer) printList(key string, resource *InlineResource) {
+// HCL2 distinguishes between nested blocks and attributes which happen to hold a list of objects. The
+// latter are written as a tuple of object constructors.
+func (p *Printer) printObjectList(key string, resource *InlineResource) {
+	p.write("%s = [\n", key)
+	p.indent()
+
+	for _, v := range resource.Fields {
+		p.write("{\n")
+
+		// Nothing inside an attribute can be a block, so use an empty schema for all children.
+		p.printInlineResource(v.NestedValue, &configschema.Block{})
+		p.write("},\n")
+	}
+
+	p.unindent()
+	p.write("]\n")
+}
+
+func (p *Printer) printList(key string, resource *InlineResource, schema *configschema.Block) {
 	// Lists can either contain a set of scalar objects, or a set of nested resources.
 	if resource.Fields[0].FieldType == SCALAR {
 		p.printSimpleList(key, resource)
+		return
+	}
+
+	if p.Syntax != HCL2 || schema == nil {
+		p.printRichList(key, resource, nil)
+		return
+	}
+
+	if block, ok := schema.BlockTypes[key]; ok {
+		p.printRichList(key, resource, &block.Block)
 	} else {
-		p.printRichList(key, resource)
+		p.printObjectList(key, resource)
 	}
 }
 
-func (p *Printer) printField(field *Field) {
+func (p *Printer) printField(field *Field, schema *configschema.Block) {
 	if field.Computed == true {
 		return
 	}
 
 	if field.Link != "" {
-		p.write("%s = \"${%s}\"\n", field.Key, field.Link)
+		if p.Syntax == HCL2 {
+			p.write("%s = %s\n", p.key(field.Key), field.Link)
+		} else {
+			p.write("%s = \"${%s}\"\n", p.key(field.Key), field.Link)
+		}
 	} else if field.FieldType == SCALAR {
-		if field.ScalarValue.IsBool {
-			if field.ScalarValue.StringValue == "true" {
-				p.write("%s = true\n", field.Key)
-			} else {
-				p.write("%s = false\n", field.Key)
-			}
+		if literal, ok := typedLiteral(field.ScalarValue); ok {
+			p.write("%s = %s\n", p.key(field.Key), literal)
 		} else {
 			if p.printJSON(field) {
 				return
@@ -113,21 +201,28 @@ func (p *Printer) printField(field *Field) {
 				return
 			}
 
-			// TODO(jimmy): Make this anything except valid key characters
-			if strings.Contains(field.Key, "/") {
-				p.write("\"%s\" = \"%s\"\n", field.Key, strings.Replace(field.ScalarValue.StringValue, "\"", "\\\"", -1))
-			} else {
-				p.write("%s = \"%s\"\n", field.Key, strings.Replace(field.ScalarValue.StringValue, "\"", "\\\"", -1))
-			}
-
+			p.write("%s = %s\n", p.key(field.Key), p.literal(field.ScalarValue.StringValue))
 		}
 	} else if field.FieldType == MAP {
 		p.printMap(field.Key, field.NestedValue)
-	} else if field.FieldType == LIST {
-		p.printList(field.Key, field.NestedValue)
+	} else if field.FieldType == LIST || field.FieldType == SET {
+		p.printList(field.Key, field.NestedValue, schema)
 	}
 }
 
+// Numbers and booleans are written without quotes, in the same way as they would be written by hand.
+func typedLiteral(value *ScalarValue) (string, bool) {
+	switch value.Kind {
+	case TypeBool:
+		return strconv.FormatBool(value.BoolValue), true
+	case TypeInt:
+		return strconv.FormatInt(value.IntValue, 10), true
+	case TypeFloat:
+		return strconv.FormatFloat(value.FloatValue, 'f', -1, 64), true
+	}
+	return "", false
+}
+
 func (p *Printer) printJSON(field *Field) bool {
 	if field.ScalarValue.StringValue == "" {
 		return false
@@ -137,29 +232,149 @@ func (p *Printer) printJSON(field *Field) bool {
 		return false
 	}
 
-	// ${} references in Policy documents conflict with Terraform. Use &{} instead
-	//var d map[string]interface{}
-	//err := json.Unmarshal([]byte(field.ScalarValue.StringValue), &d)
-	//if err != nil {
-	//	fmt.Printf("This doesn't appear to be JSON\n")
-	//	return false
-	//}
-	//
-	//s, _ := json.MarshalIndent(d, "", "    ")
+	if p.Syntax == HCL2 {
+		return p.printJSONEncode(field)
+	}
+
+	// Documents are spread over several lines, so that they can be written as a heredoc. Policy variables such as
+	// ${aws:username} are escaped, so that Terraform does not try to interpolate them.
+	buf := bytes.Buffer{}
+	if err := json.Indent(&buf, []byte(field.ScalarValue.StringValue), "", strings.Repeat(" ", INDENT)); err != nil {
+		return false
+	}
+	buf.WriteString("\n")
+
+	p.write("%s = %s\n", p.key(field.Key), p.literal(buf.String()))
+	return true
+}
+
+// HCL2 can express JSON documents natively, so rather than embedding a string we re-encode the
+// document as an HCL2 object and wrap it in jsonencode(). Policy variables such as ${aws:username}
+// survive unchanged because template sequences are escaped.
+func (p *Printer) printJSONEncode(field *Field) bool {
+	// Only the first value is decoded, so anything after it must be ruled out first
+	if !json.Valid([]byte(field.ScalarValue.StringValue)) {
+		return false
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(field.ScalarValue.StringValue))
+	decoder.UseNumber()
+
+	var d interface{}
+	if err := decoder.Decode(&d); err != nil {
+		return false
+	}
 
-	fixed := strings.Replace(string(field.ScalarValue.StringValue), "${", "&{", -1)
-	p.write("%s = <<EOF\n%sEOF\n", field.Key, fixed)
+	p.write("%s = jsonencode(%s)\n", p.key(field.Key), hcl2Literal(d, p.currentIndent, p.quote))
 	return true
 }
 
+// Render a decoded JSON value as an HCL2 expression. Nested lines are indented relative to indent, and strings are
+// quoted with quote.
+func hcl2Literal(value interface{}, indent int, quote func(string) string) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return "{}"
+		}
+
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf := bytes.Buffer{}
+		buf.WriteString("{\n")
+		for _, k := range keys {
+			key := k
+			if !identifierPattern.MatchString(k) || keywords[k] {
+				key = quoteHCL2(k)
+			}
+			buf.WriteString(strings.Repeat(" ", indent+INDENT))
+			buf.WriteString(key + " = " + hcl2Literal(v[k], indent+INDENT, quote) + "\n")
+		}
+		buf.WriteString(strings.Repeat(" ", indent) + "}")
+		return buf.String()
+	case []interface{}:
+		if len(v) == 0 {
+			return "[]"
+		}
+
+		buf := bytes.Buffer{}
+		buf.WriteString("[\n")
+		for _, e := range v {
+			buf.WriteString(strings.Repeat(" ", indent+INDENT))
+			buf.WriteString(hcl2Literal(e, indent+INDENT, quote) + ",\n")
+		}
+		buf.WriteString(strings.Repeat(" ", indent) + "]")
+		return buf.String()
+	case string:
+		return quote(v)
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return "null"
+}
+
+func (p *Printer) printResource(resource *Resource) {
+	keyword := "resource"
+	if resource.DataSource {
+		keyword = "data"
+	}
+	p.write("%s \"%s\" \"%s\" {\n", keyword, resource.Type, resource.Name)
+
+	if resource.Provider != "" {
+		p.indent()
+		p.printProviderReference(resource.Provider)
+		p.unindent()
+	}
+
+	p.printInlineResource(resource.Fields, p.Schema)
+
+	if len(resource.IgnoreChanges) > 0 {
+		p.indent()
+		p.printLifecycle(resource.IgnoreChanges)
+		p.unindent()
+	}
+	p.write("}")
+}
+
+// Terraform 0.11 names the attributes to ignore with strings, and Terraform 0.12 and later with bare references.
+func (p *Printer) printLifecycle(ignoreChanges []string) {
+	p.write("lifecycle {\n")
+	p.indent()
+	p.write("ignore_changes = [\n")
+	p.indent()
+	for _, attribute := range ignoreChanges {
+		if p.Syntax == HCL2 {
+			p.write("%s,\n", attribute)
+		} else {
+			p.write("\"%s\",\n", attribute)
+		}
+	}
+	p.unindent()
+	p.write("]\n")
+	p.unindent()
+	p.write("}\n")
+}
+
+func (p *Printer) printProviderReference(provider string) {
+	if p.Syntax == HCL2 {
+		p.write("provider = %s\n", provider)
+	} else {
+		p.write("provider = \"%s\"\n", provider)
+	}
+}
+
 func (p *Printer) Print(resource *Resource) string {
 	buf := bytes.Buffer{}
 	writer := io.Writer(&buf)
 
 	p.output = &writer
-	p.write("resource \"%s\" \"%s\" {\n", resource.Type, resource.Name)
-	p.printInlineResource(resource.Fields)
-	p.write("}")
+	p.printResource(resource)
 
 	return buf.String()
 }
@@ -168,7 +383,60 @@ func (p *Printer) PrintToFile(file *os.File, resource *Resource) {
 	writer := io.Writer(file)
 	p.output = &writer
 
-	p.write("resource \"%s\" \"%s\" {\n", resource.Type, resource.Name)
-	p.printInlineResource(resource.Fields)
+	p.printResource(resource)
+}
+
+// Provider blocks configure a provider, e.g. to select the region of an aliased AWS provider.
+func (p *Printer) printProvider(name string, fields *InlineResource) {
+	p.write("provider \"%s\" {\n", name)
+	p.printInlineResource(fields, nil)
+	p.write("}")
+}
+
+func (p *Printer) PrintProvider(name string, fields *InlineResource) string {
+	buf := bytes.Buffer{}
+	writer := io.Writer(&buf)
+
+	p.output = &writer
+	p.printProvider(name, fields)
+
+	return buf.String()
+}
+
+func (p *Printer) PrintProviderToFile(file *os.File, name string, fields *InlineResource) {
+	writer := io.Writer(file)
+	p.output = &writer
+
+	p.printProvider(name, fields)
+}
+
+// Import blocks (Terraform 1.5+) let Terraform adopt existing infrastructure during plan, rather than
+// relying on a tfstate file written by Formation.
+func (p *Printer) printImport(resource *Resource, id string) {
+	p.write("import {\n")
+	p.indent()
+	p.write("to = %s.%s\n", resource.Type, resource.Name)
+	p.write("id = %s\n", quoteHCL2(id))
+	if resource.Provider != "" {
+		p.write("provider = %s\n", resource.Provider)
+	}
+	p.unindent()
 	p.write("}")
 }
+
+func (p *Printer) PrintImport(resource *Resource, id string) string {
+	buf := bytes.Buffer{}
+	writer := io.Writer(&buf)
+
+	p.output = &writer
+	p.printImport(resource, id)
+
+	return buf.String()
+}
+
+func (p *Printer) PrintImportToFile(file *os.File, resource *Resource, id string) {
+	writer := io.Writer(file)
+	p.output = &writer
+
+	p.printImport(resource, id)
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 
+	"github.com/hashicorp/terraform/config/configschema"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -139,7 +140,8 @@ var _ = Describe("Printer", func() {
 						Key:       "scalar_field",
 						ScalarValue: &ScalarValue{
 							StringValue: "true",
-							IsBool:      true,
+							Kind:        TypeBool,
+							BoolValue:   true,
 						},
 					},
 				},
@@ -162,7 +164,7 @@ var _ = Describe("Printer", func() {
 						Key:       "scalar_field",
 						ScalarValue: &ScalarValue{
 							StringValue: "false",
-							IsBool:      true,
+							Kind:        TypeBool,
 						},
 					},
 				},
@@ -174,6 +176,47 @@ var _ = Describe("Printer", func() {
 		Expect(printer.Print(&resource)).To(Equal(ContentsOf("false_boolean_resource.hcl")))
 	})
 
+	It("should render numbers without quotes", func() {
+		resource := Resource{
+			Name: "test",
+			Type: "simple_resource",
+			Fields: &InlineResource{
+				Fields: []*Field{
+					{
+						FieldType:   SCALAR,
+						Key:         "float_field",
+						ScalarValue: NewScalarValue("0.5", TypeFloat),
+					},
+					{
+						FieldType:   SCALAR,
+						Key:         "int_field",
+						ScalarValue: NewScalarValue("3", TypeInt),
+					},
+					{
+						FieldType: LIST,
+						Key:       "list_field",
+						NestedValue: &InlineResource{
+							Fields: []*Field{
+								{
+									FieldType:   SCALAR,
+									ScalarValue: NewScalarValue("80", TypeFloat),
+								},
+								{
+									FieldType:   SCALAR,
+									ScalarValue: NewScalarValue("443", TypeFloat),
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		printer := Printer{}
+
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("number_resource.hcl")))
+	})
+
 	It("should render JSON as a multi-line value", func() {
 		resource := Resource{
 			Name: "test",
@@ -356,3 +399,312 @@ var _ = Describe("Printer", func() {
 		Expect(printer.Print(&resource)).To(Equal(ContentsOf("rich_list_field.hcl")))
 	})
 })
+
+var _ = Describe("Printer with HCL2 syntax", func() {
+	It("should render links as bare references", func() {
+		resource := Resource{
+			Name: "test",
+			Type: "simple_resource",
+			Fields: &InlineResource{
+				Fields: []*Field{
+					{
+						FieldType: SCALAR,
+						Key:       "scalar_field",
+						Link:      "aws_s3_bucket.name.id",
+						ScalarValue: &ScalarValue{
+							StringValue: "scalar_value",
+						},
+					},
+				},
+			},
+		}
+
+		printer := Printer{Syntax: HCL2}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("hcl2_linked_resource.hcl")))
+	})
+
+	It("should render links inside lists of scalars", func() {
+		resource := Resource{
+			Name: "test",
+			Type: "simple_resource",
+			Fields: &InlineResource{
+				Fields: []*Field{
+					{
+						FieldType: SET,
+						Key:       "security_group_ids",
+						NestedValue: &InlineResource{
+							Fields: []*Field{
+								{
+									FieldType: SCALAR,
+									Link:      "aws_security_group.web.id",
+									ScalarValue: &ScalarValue{
+										StringValue: "sg-1234",
+									},
+								},
+								{
+									FieldType: SCALAR,
+									ScalarValue: &ScalarValue{
+										StringValue: "sg-5678",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		printer := Printer{Syntax: HCL2}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("hcl2_linked_list_field.hcl")))
+	})
+
+	It("should render maps using attribute syntax", func() {
+		resource := Resource{
+			Name: "test",
+			Type: "simple_resource",
+			Fields: &InlineResource{
+				Fields: []*Field{
+					{
+						FieldType: MAP,
+						Key:       "tags",
+						NestedValue: &InlineResource{
+							Fields: []*Field{
+								{
+									FieldType: SCALAR,
+									Key:       "Name",
+									ScalarValue: &ScalarValue{
+										StringValue: "Jimmy",
+									},
+								},
+								{
+									FieldType: SCALAR,
+									Key:       "I.Have.Dots",
+									ScalarValue: &ScalarValue{
+										StringValue: "${not_interpolated}",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		printer := Printer{Syntax: HCL2}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("hcl2_map_field.hcl")))
+	})
+
+	It("should render JSON using jsonencode", func() {
+		resource := Resource{
+			Name: "test",
+			Type: "simple_resource",
+			Fields: &InlineResource{
+				Fields: []*Field{
+					{
+						FieldType: SCALAR,
+						Key:       "policy",
+						ScalarValue: &ScalarValue{
+							StringValue: `{"Version": "2012-10-17", "Statement": [{"Effect": "Allow", "Resource": "arn:aws:s3:::bucket/${aws:username}"}]}`,
+						},
+					},
+				},
+			},
+		}
+
+		printer := Printer{Syntax: HCL2}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("hcl2_json_resource.hcl")))
+	})
+
+	It("should only use block syntax where the schema declares a nested block", func() {
+		nested := func(value string) *Field {
+			return &Field{
+				FieldType: NESTED,
+				NestedValue: &InlineResource{
+					Fields: []*Field{
+						{
+							FieldType: SCALAR,
+							Key:       "nested_field",
+							ScalarValue: &ScalarValue{
+								StringValue: value,
+							},
+						},
+					},
+				},
+			}
+		}
+
+		resource := Resource{
+			Name: "test",
+			Type: "simple_resource",
+			Fields: &InlineResource{
+				Fields: []*Field{
+					{
+						FieldType: LIST,
+						Key:       "attribute_list",
+						NestedValue: &InlineResource{
+							Fields: []*Field{nested("One"), nested("Two")},
+						},
+					},
+					{
+						FieldType: LIST,
+						Key:       "block_list",
+						NestedValue: &InlineResource{
+							Fields: []*Field{nested("Three"), nested("Four")},
+						},
+					},
+				},
+			},
+		}
+
+		schema := &configschema.Block{
+			BlockTypes: map[string]*configschema.NestedBlock{
+				"block_list": {
+					Nesting: configschema.NestingList,
+				},
+			},
+		}
+
+		printer := Printer{Syntax: HCL2, Schema: schema}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("hcl2_nested_list_field.hcl")))
+	})
+})
+
+var _ = Describe("Printer import blocks", func() {
+	It("should print an import block", func() {
+		resource := Resource{Name: "test", Type: "aws_s3_bucket"}
+		printer := Printer{}
+
+		Expect(printer.PrintImport(&resource, "my-\"bucket\"")).To(Equal(ContentsOf("import_block.hcl")))
+	})
+})
+
+var _ = Describe("Printer data sources", func() {
+	It("should print a data source", func() {
+		resource := Resource{
+			Name:       "vpc-1234",
+			Type:       "aws_vpc",
+			DataSource: true,
+			Fields: &InlineResource{
+				Fields: []*Field{
+					{
+						FieldType:   SCALAR,
+						Key:         "id",
+						ScalarValue: NewScalarValue("vpc-1234", TypeString),
+					},
+				},
+			},
+		}
+
+		printer := Printer{}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("data_source.hcl")))
+		Expect(resource.Address()).To(Equal("data.aws_vpc.vpc-1234"))
+	})
+})
+
+var _ = Describe("Printer substitutions", func() {
+	substitutions := []*Substitution{
+		{Literal: "123456789012", Expression: "data.aws_caller_identity.current.account_id"},
+		{Literal: "us-east-1", Expression: "data.aws_region.current.name"},
+		{Prefix: "arn:", Literal: "aws", Suffix: ":", Expression: "data.aws_partition.current.partition"},
+	}
+
+	resource := Resource{
+		Name: "test",
+		Type: "simple_resource",
+		Fields: &InlineResource{
+			Fields: []*Field{
+				{
+					FieldType:   SCALAR,
+					Key:         "role_arn",
+					ScalarValue: NewScalarValue("arn:aws:iam::123456789012:role/aws-${role}", TypeString),
+				},
+				{
+					FieldType: SCALAR,
+					Key:       "policy",
+					ScalarValue: &ScalarValue{
+						StringValue: `{"Resource": "arn:aws:sqs:us-east-1:123456789012:queue"}`,
+					},
+				},
+			},
+		},
+	}
+
+	It("should substitute references into HCL1 strings", func() {
+		printer := Printer{Substitutions: substitutions}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("substitutions.hcl")))
+	})
+
+	It("should substitute references into HCL2 strings without escaping them", func() {
+		printer := Printer{Syntax: HCL2, Substitutions: substitutions}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("hcl2_substitutions.hcl")))
+	})
+})
+
+var _ = Describe("Printer providers", func() {
+	It("should reference an aliased provider", func() {
+		resource := Resource{
+			Name:     "test",
+			Type:     "simple_resource",
+			Provider: "aws.use1",
+			Fields: &InlineResource{
+				Fields: []*Field{
+					{
+						FieldType:   SCALAR,
+						Key:         "scalar_field",
+						ScalarValue: NewScalarValue("scalar_value", TypeString),
+					},
+				},
+			},
+		}
+
+		printer := Printer{Syntax: HCL2}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("hcl2_provider_reference.hcl")))
+	})
+
+	It("should print a provider block", func() {
+		fields := &InlineResource{
+			Fields: []*Field{
+				{
+					FieldType:   SCALAR,
+					Key:         "alias",
+					ScalarValue: NewScalarValue("use1", TypeString),
+				},
+				{
+					FieldType:   SCALAR,
+					Key:         "region",
+					ScalarValue: NewScalarValue("us-east-1", TypeString),
+				},
+			},
+		}
+
+		printer := Printer{Syntax: HCL2}
+		Expect(printer.PrintProvider("aws", fields)).To(Equal(ContentsOf("provider_block.hcl")))
+	})
+})
+
+var _ = Describe("Printer lifecycle", func() {
+	resource := Resource{
+		Name:          "test",
+		Type:          "simple_resource",
+		IgnoreChanges: []string{"user_data", "desired_capacity"},
+		Fields: &InlineResource{
+			Fields: []*Field{
+				{
+					FieldType:   SCALAR,
+					Key:         "scalar_field",
+					ScalarValue: NewScalarValue("scalar_value", TypeString),
+				},
+			},
+		},
+	}
+
+	It("should ignore changes to attributes named as strings in HCL1", func() {
+		printer := Printer{}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("hcl1_ignore_changes.hcl")))
+	})
+
+	It("should ignore changes to attributes named as references in HCL2", func() {
+		printer := Printer{Syntax: HCL2}
+		Expect(printer.Print(&resource)).To(Equal(ContentsOf("hcl2_ignore_changes.hcl")))
+	})
+})
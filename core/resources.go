@@ -1,5 +1,7 @@
 package core
 
+import "strconv"
+
 type FieldType int
 
 const (
@@ -7,6 +9,7 @@ const (
 	MAP
 	LIST
 	NESTED
+	SET
 )
 
 type InlineResource struct {
@@ -18,17 +21,55 @@ func (r *InlineResource) Append(field *Field) {
 }
 
 type ScalarValue struct {
-	StringValue  string
-	IntegerValue int32
-	IsBool       bool
+	// The value exactly as it appears in the InstanceState. This is always filled in, whatever the Kind.
+	StringValue string
+
+	// One of TypeString, TypeInt, TypeFloat or TypeBool. Values which were built without a Kind are strings.
+	Kind ValueType
+
+	IntValue   int64
+	FloatValue float64
+	BoolValue  bool
+}
+
+// NewScalarValue converts a flattened value into a ScalarValue of the given schema type. The schema does not
+// distinguish between integers and floats, so whole numbers are always treated as integers. Values which
+// cannot be converted (such as an unset number, stored as an empty string) are kept as strings.
+func NewScalarValue(value string, valueType ValueType) *ScalarValue {
+	v := &ScalarValue{
+		StringValue: value,
+		Kind:        TypeString,
+	}
+
+	switch valueType {
+	case TypeBool:
+		if b, err := strconv.ParseBool(value); err == nil {
+			v.Kind = TypeBool
+			v.BoolValue = b
+		}
+	case TypeInt, TypeFloat:
+		if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+			v.Kind = TypeInt
+			v.IntValue = i
+		} else if f, err := strconv.ParseFloat(value, 64); err == nil {
+			v.Kind = TypeFloat
+			v.FloatValue = f
+		}
+	}
+
+	return v
 }
 
 type Field struct {
 	FieldType FieldType
-	Key       string
-	Computed  bool
-	Link      string
-	Path      string
+
+	// The type of this value in the provider schema
+	ValueType ValueType
+
+	Key      string
+	Computed bool
+	Link     string
+	Path     string
 
 	// Only one of these may be filled in
 	ScalarValue *ScalarValue
@@ -36,7 +77,26 @@ type Field struct {
 }
 
 type Resource struct {
-	Type   string
-	Name   string
+	Type string
+	Name string
+
+	// The provider configuration which manages this resource, e.g. aws.use1. Empty for the default provider.
+	Provider string
+
+	// Data sources are read by Terraform, rather than managed by it
+	DataSource bool
+
+	// Attributes whose changes Terraform should not plan, written as lifecycle { ignore_changes = [...] }
+	IgnoreChanges []string
+
 	Fields *InlineResource
 }
+
+// Address returns the address other resources use to refer to this resource, e.g. aws_vpc.main or
+// data.aws_vpc.main
+func (r *Resource) Address() string {
+	if r.DataSource {
+		return "data." + r.Type + "." + r.Name
+	}
+	return r.Type + "." + r.Name
+}
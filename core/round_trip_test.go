@@ -1,13 +1,27 @@
 package core_test
 
 import (
+	"encoding/json"
 	"fmt"
 	. "github.com/jmcgill/formation/core"
+	"math/rand"
+	"reflect"
 	"strings"
 
+	hcl1 "github.com/hashicorp/hcl"
+	hcl1ast "github.com/hashicorp/hcl/hcl/ast"
+	hcl2 "github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/hashicorp/hil"
+	hilast "github.com/hashicorp/hil/ast"
+	"github.com/hashicorp/terraform/config/configschema"
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
 )
 
 func countLeadingTabs(line string) int {
@@ -41,7 +55,75 @@ func cleanMultiline(x string) string {
 	return strings.Join(output, "\n")
 }
 
+// Build the configschema for a resource from its helper/schema definition, in the same way as the AWS provider.
+func coreSchema(attributes map[string]*schema.Schema) *configschema.Block {
+	return (&schema.Resource{Schema: attributes}).CoreConfigSchema()
+}
+
+func nestedResource(attributes map[string]*schema.Schema) *schema.Resource {
+	return &schema.Resource{Schema: attributes}
+}
+
+var (
+	optionalString = &schema.Schema{Type: schema.TypeString, Optional: true}
+	optionalInt    = &schema.Schema{Type: schema.TypeInt, Optional: true}
+	optionalBool   = &schema.Schema{Type: schema.TypeBool, Optional: true}
+	optionalMap    = &schema.Schema{Type: schema.TypeMap, Optional: true}
+)
+
+func optionalList(elem interface{}) *schema.Schema {
+	return &schema.Schema{Type: schema.TypeList, Optional: true, Elem: elem}
+}
+
+func optionalSet(elem interface{}) *schema.Schema {
+	return &schema.Schema{Type: schema.TypeSet, Optional: true, Elem: elem}
+}
+
 var _ = Describe("RoundTripInstanceStateToHCL", func() {
+	s3BucketSchema := coreSchema(map[string]*schema.Schema{
+		"acceleration_status": optionalString,
+		"arn":                 optionalString,
+		"bucket":              optionalString,
+		"bucket_domain_name":  optionalString,
+		"hosted_zone_id":      optionalString,
+		"logging": optionalSet(nestedResource(map[string]*schema.Schema{
+			"target_bucket": optionalString,
+			"target_prefix": optionalString,
+		})),
+		"region":        optionalString,
+		"request_payer": optionalString,
+		"server_side_encryption_configuration": optionalList(nestedResource(map[string]*schema.Schema{
+			"item": optionalString,
+			"rule": optionalList(nestedResource(map[string]*schema.Schema{
+				"apply_server_side_encryption_by_default": optionalList(nestedResource(map[string]*schema.Schema{
+					"kms_master_key_id": optionalString,
+					"sse_algorithm":     optionalString,
+				})),
+			})),
+		})),
+		"tags": optionalMap,
+		"versioning": optionalList(nestedResource(map[string]*schema.Schema{
+			"enabled":    optionalBool,
+			"mfa_delete": optionalBool,
+		})),
+		"website": optionalList(nestedResource(map[string]*schema.Schema{
+			"index_document": optionalString,
+		})),
+	})
+
+	securityGroupRule := nestedResource(map[string]*schema.Schema{
+		"cidr_blocks":      optionalList(optionalString),
+		"description":      optionalString,
+		"ipv6_cidr_blocks": optionalList(optionalString),
+		"protocol":         optionalString,
+		"security_groups":  optionalSet(optionalString),
+	})
+
+	securityGroupSchema := coreSchema(map[string]*schema.Schema{
+		"egress":  optionalSet(securityGroupRule),
+		"ingress": optionalSet(securityGroupRule),
+	})
+
 	It("should round trip an empty instance state", func() {
 		state := terraform.InstanceState{
 			Attributes: map[string]string{},
@@ -51,7 +133,7 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		resource "" "" {
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: &configschema.Block{}}
 		printer := Printer{}
 		Expect(printer.Print(parser.Parse(&state))).To(Equal(expected))
 	})
@@ -68,7 +150,9 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		    simple_field = "value"
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"simple_field": optionalString,
+		})}
 		printer := Printer{}
 		Expect(printer.Print(parser.Parse(&state))).To(Equal(expected))
 	})
@@ -91,7 +175,9 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		    }
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"map_name": optionalMap,
+		})}
 		printer := Printer{}
 		Expect(printer.Print(parser.Parse(&state))).To(Equal(expected))
 	})
@@ -110,17 +196,22 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		expected := cleanMultiline(`
 		resource "" "" {
 		    list_key {
-		        age = "32"
+		        age = 32
 		        name = "Jimmy"
 		    }
 
 		    list_key {
-		        age = "33"
+		        age = 33
 		        name = "Alice"
 		    }
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"list_key": optionalList(nestedResource(map[string]*schema.Schema{
+				"age":  optionalInt,
+				"name": optionalString,
+			})),
+		})}
 		printer := Printer{}
 		Expect(printer.Print(parser.Parse(&state))).To(Equal(expected))
 	})
@@ -149,19 +240,35 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		expected := cleanMultiline(`
 		resource "" "" {
 		    alias {
-		        evaluate_target_health = "false"
+		        evaluate_target_health = false
 		        name = "s3-website-us-west-2.amazonaws.com"
 		        zone_id = "Z3BJ6K6RIION7M"
 		    }
 		    fqdn = "mikeball.me"
 		    name = "mikeball.me"
-		    ttl = "0"
+		    ttl = 0
 		    type = "A"
-		    weight = "-1"
+		    weight = -1
 		    zone_id = "Z2OIQETM3FU6D"
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"alias": optionalSet(nestedResource(map[string]*schema.Schema{
+				"evaluate_target_health": optionalBool,
+				"name":                   optionalString,
+				"zone_id":                optionalString,
+			})),
+			"failover":        optionalString,
+			"fqdn":            optionalString,
+			"health_check_id": optionalString,
+			"name":            optionalString,
+			"records":         optionalSet(optionalString),
+			"set_identifier":  optionalString,
+			"ttl":             optionalInt,
+			"type":            optionalString,
+			"weight":          optionalInt,
+			"zone_id":         optionalString,
+		})}
 		printer := Printer{}
 		Expect(printer.Print(parser.Parse(&state))).To(Equal(expected))
 	})
@@ -181,16 +288,25 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		expected := cleanMultiline(`
 		resource "" "" {
 		    alias {
-		        evaluate_target_health = "false"
+		        evaluate_target_health = false
 		        name = "s3-website-us-west-2.amazonaws.com"
 		        nested {
-		            age = "31"
+		            age = 31
 		            name = "Jimmy"
 		        }
 		    }
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"alias": optionalSet(nestedResource(map[string]*schema.Schema{
+				"evaluate_target_health": optionalBool,
+				"name":                   optionalString,
+				"nested": optionalList(nestedResource(map[string]*schema.Schema{
+					"age":  optionalInt,
+					"name": optionalString,
+				})),
+			})),
+		})}
 		printer := Printer{}
 		Expect(printer.Print(parser.Parse(&state))).To(Equal(expected))
 	})
@@ -248,12 +364,12 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		        environment = "production"
 		    }
 		    versioning {
-		        enabled = "true"
-		        mfa_delete = "false"
+		        enabled = true
+		        mfa_delete = false
 		    }
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: s3BucketSchema}
 		printer := Printer{}
 
 		Expect(printer.Print(parser.Parse(&state))).To(Equal(expected))
@@ -296,12 +412,12 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		    region = "us-east-2"
 		    request_payer = "BucketOwner"
 		    versioning {
-		        enabled = "false"
-		        mfa_delete = "false"
+		        enabled = false
+		        mfa_delete = false
 		    }
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: s3BucketSchema}
 		printer := Printer{}
 
 		Expect(printer.Print(parser.Parse(&state))).To(Equal(expected))
@@ -327,12 +443,12 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		        Stack-Id = "Stack-Id"
 		    }
 		    versioning {
-		        enabled = "false"
-		        mfa_delete = "false"
+		        enabled = false
+		        mfa_delete = false
 		    }
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: s3BucketSchema}
 		printer := Printer{}
 
 		x := printer.Print(parser.Parse(&state))
@@ -358,7 +474,9 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		    }
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"tags": optionalMap,
+		})}
 		printer := Printer{}
 
 		x := printer.Print(parser.Parse(&state))
@@ -388,7 +506,7 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		    }
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: securityGroupSchema}
 		printer := Printer{}
 
 		Expect(printer.Print(parser.Parse(&state))).To(Equal(expected))
@@ -415,7 +533,11 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		    }
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: coreSchema(map[string]*schema.Schema{
+			"item": optionalList(nestedResource(map[string]*schema.Schema{
+				"name": optionalString,
+			})),
+		})}
 		printer := Printer{}
 		x := printer.Print(parser.Parse(&state))
 		fmt.Printf(x)
@@ -449,7 +571,7 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 		    }
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: securityGroupSchema}
 		printer := Printer{}
 		Expect(printer.Print(parser.Parse(&state))).To(Equal(expected))
 	})
@@ -485,23 +607,229 @@ var _ = Describe("RoundTripInstanceStateToHCL", func() {
 
 		expected := cleanMultiline(`
 		resource "" "" {
-		    egress {
-		        security_groups = [
-		            "sg-def",
-		        ]
-		    }
-
-		    egress {
-		        security_groups = [
-		            "sg-abc",
+		    ingress {
+		        cidr_blocks = [
+		            "52.6.1.1/32",
+		            "208.82.15.122/32",
+		            "10.20.0.0/16",
+		            "104.7.13.39/32",
+		            "209.122.233.114/32",
+		            "172.56.38.153/32",
+		            "47.208.191.203/32",
+		            "73.70.34.243/32",
+		            "69.127.178.225/32",
+		            "66.65.93.66/32",
+		            "10.30.0.0/15",
+		            "76.175.104.150/32",
+		            "54.68.30.98/32",
+		            "54.68.45.3/32",
+		            "54.164.204.122/32",
+		            "54.172.100.146/32",
+		            "73.222.147.41/32",
+		            "24.5.151.60/32",
+		            "24.5.150.186/32",
 		        ]
+		        description = "hello"
 		    }
 		}`)
 
-		parser := InstanceStateParser{}
+		parser := InstanceStateParser{Schema: securityGroupSchema}
 		printer := Printer{}
 		x := printer.Print(parser.Parse(&state))
 		fmt.Println(x)
 		Expect(x).To(Equal(expected))
 	})
 })
+
+// Strings which have broken the printer, or which are likely to
+var literalCorpus = []string{
+	"plain",
+	"a \"quoted\" value",
+	"C:\\Windows\\",
+	"line one\nline two",
+	"ends with a newline\n",
+	"#!/bin/bash\necho \"${HOME}\" > /tmp/home\n",
+	"${var.region}",
+	"$${already.escaped}",
+	"%{ if true }yes%{ endif }",
+	"100%",
+	"costs $5",
+	"$",
+	"$$",
+	"ends with $",
+	"${",
+	"${unclosed",
+	"}{",
+	"${a\"b}",
+	"${a\\b}",
+	"${\"nested ${x}\"}",
+	"tab\tseparated\n",
+	"windows\r\nline endings\r\n",
+	"bell \a and null \x00",
+	"unicode: h\u00e9llo, \u65e5\u672c\u8a9e, \U0001f680",
+	"line\u2028separator",
+	"EOF\n",
+	"EOF\nEOF2\n",
+	"  EOF  \n",
+	"ends with EOF\n",
+	"v=spf1 include:_spf.google.com ~all",
+	"arn:aws:s3:::bucket/${aws:username}/*",
+	"{\"Version\": \"2012-10-17\", \"Statement\": [{\"Resource\": \"arn:aws:s3:::b/${aws:username}\"}]}",
+	"{not json",
+	"true",
+	"null",
+	"for",
+}
+
+// Pieces from which random strings are built, chosen to combine into escape and template sequences
+var literalPieces = []string{
+	"$", "{", "}", "%", "\\", "\"", "\n", "\r", "\t", "\x01", "EOF", "a", " ", "-", ".", ":", "\u00e9",
+}
+
+func randomLiterals(n int) []string {
+	random := rand.New(rand.NewSource(1))
+	literals := make([]string, n)
+	for i := range literals {
+		pieces := make([]string, 1+random.Intn(12))
+		for j := range pieces {
+			pieces[j] = literalPieces[random.Intn(len(literalPieces))]
+		}
+		literals[i] = strings.Join(pieces, "")
+	}
+	return literals
+}
+
+// A resource with value as an attribute, as an element of a list and as both the key and value of a map entry.
+func literalResource(value string) *Resource {
+	scalar := func(key string) *Field {
+		return &Field{FieldType: SCALAR, Key: key, ScalarValue: NewScalarValue(value, TypeString)}
+	}
+
+	return &Resource{
+		Type: "simple_resource",
+		Name: "test",
+		Fields: &InlineResource{
+			Fields: []*Field{
+				scalar("value"),
+				{FieldType: LIST, Key: "list", NestedValue: &InlineResource{Fields: []*Field{scalar("")}}},
+				{FieldType: MAP, Key: "map", NestedValue: &InlineResource{Fields: []*Field{scalar(value)}}},
+			},
+		},
+	}
+}
+
+// The value, list element, map key and map value of a resource printed by literalResource, as read by Terraform
+// 0.11: unquoted by HCL, then interpolated by HIL.
+func readHCL1(src string) ([]string, error) {
+	file, err := hcl1.ParseString(src)
+	if err != nil {
+		return nil, err
+	}
+
+	resource := file.Node.(*hcl1ast.ObjectList).Filter("resource", "simple_resource", "test").Items[0]
+	body := resource.Val.(*hcl1ast.ObjectType).List
+	value := body.Filter("value").Items[0].Val.(*hcl1ast.LiteralType)
+	element := body.Filter("list").Items[0].Val.(*hcl1ast.ListType).List[0].(*hcl1ast.LiteralType)
+	entry := body.Filter("map").Items[0].Val.(*hcl1ast.ObjectType).List.Items[0]
+
+	var values []string
+	for _, s := range []string{
+		value.Token.Value().(string),
+		element.Token.Value().(string),
+		entry.Keys[0].Token.Value().(string),
+		entry.Val.(*hcl1ast.LiteralType).Token.Value().(string),
+	} {
+		node, err := hil.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+
+		literal, ok := node.(*hilast.LiteralNode)
+		if !ok {
+			return nil, fmt.Errorf("%q is interpolated", s)
+		}
+		values = append(values, literal.Value.(string))
+	}
+	return values, nil
+}
+
+// As readHCL1, for Terraform 0.12 and later.
+func readHCL2(src string) ([]string, error) {
+	file, diags := hclsyntax.ParseConfig([]byte(src+"\n"), "test.tf", hcl2.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	ctx := &hcl2.EvalContext{
+		Functions: map[string]function.Function{"jsonencode": stdlib.JSONEncodeFunc},
+	}
+
+	body := file.Body.(*hclsyntax.Body).Blocks[0].Body
+	var values []string
+	for _, name := range []string{"value", "list", "map"} {
+		v, diags := body.Attributes[name].Expr.Value(ctx)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+
+		switch name {
+		case "list":
+			v = v.Index(cty.NumberIntVal(0))
+		case "map":
+			it := v.ElementIterator()
+			it.Next()
+			key, element := it.Element()
+			values = append(values, key.AsString())
+			v = element
+		}
+		values = append(values, v.AsString())
+	}
+	return values, nil
+}
+
+// JSON documents may be reformatted, but must decode to the same value.
+func sameLiteral(expected string, actual string) bool {
+	if expected == actual {
+		return true
+	}
+
+	var e, a interface{}
+	if json.Unmarshal([]byte(expected), &e) != nil || json.Unmarshal([]byte(actual), &a) != nil {
+		return false
+	}
+	return reflect.DeepEqual(e, a)
+}
+
+var _ = Describe("RoundTripLiterals", func() {
+	literals := append(literalCorpus, randomLiterals(500)...)
+
+	roundTrip := func(syntax Syntax, read func(string) ([]string, error)) {
+		for _, literal := range literals {
+			// Empty values are left out
+			if literal == "" {
+				continue
+			}
+
+			printer := Printer{Syntax: syntax}
+			src := printer.Print(literalResource(literal))
+
+			values, err := read(src)
+			Expect(err).ShouldNot(HaveOccurred(), "%q printed as\n%s", literal, src)
+			Expect(values).To(HaveLen(4))
+
+			// List elements and keys are never written as JSON
+			Expect(values[1:3]).To(Equal([]string{literal, literal}), "%q printed as\n%s", literal, src)
+			for _, value := range []string{values[0], values[3]} {
+				Expect(sameLiteral(literal, value)).To(BeTrue(), "%q printed as\n%s\nread as %q", literal, src, value)
+			}
+		}
+	}
+
+	It("should read back every string printed as HCL1", func() {
+		roundTrip(HCL1, readHCL1)
+	})
+
+	It("should read back every string printed as HCL2", func() {
+		roundTrip(HCL2, readHCL2)
+	})
+})
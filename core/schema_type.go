@@ -0,0 +1,93 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaType describes the type of an attribute in a provider schema.
+//
+// configschema describes attribute types using cty.Type. The Terraform package vendors its own copy of cty,
+// which cannot be referenced from outside of that package, so types are converted via their JSON encoding
+// into this simpler representation.
+type SchemaType struct {
+	// One of TypeBool, TypeFloat, TypeString, TypeList, TypeSet, TypeMap or TypeObject. configschema does not
+	// distinguish between integers and floats, so all numbers are TypeFloat.
+	Type ValueType
+
+	// Set for TypeList, TypeSet and TypeMap
+	Elem *SchemaType
+
+	// Set for TypeObject
+	Attributes map[string]*SchemaType
+}
+
+// NewSchemaType converts a cty.Type, as found in configschema.Attribute, into a SchemaType.
+func NewSchemaType(t json.Marshaler) (*SchemaType, error) {
+	encoded, err := t.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(encoded, &raw); err != nil {
+		return nil, err
+	}
+	return schemaTypeFromJSON(raw)
+}
+
+// MustSchemaType is like NewSchemaType, but panics if the type cannot be converted. Types from a valid
+// provider schema can always be converted.
+func MustSchemaType(t json.Marshaler) *SchemaType {
+	s, err := NewSchemaType(t)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func schemaTypeFromJSON(raw interface{}) (*SchemaType, error) {
+	switch v := raw.(type) {
+	case string:
+		switch v {
+		case "string":
+			return &SchemaType{Type: TypeString}, nil
+		case "number":
+			return &SchemaType{Type: TypeFloat}, nil
+		case "bool":
+			return &SchemaType{Type: TypeBool}, nil
+		}
+	case []interface{}:
+		if len(v) != 2 {
+			break
+		}
+
+		switch v[0] {
+		case "list", "set", "map":
+			elem, err := schemaTypeFromJSON(v[1])
+			if err != nil {
+				return nil, err
+			}
+
+			t := map[interface{}]ValueType{"list": TypeList, "set": TypeSet, "map": TypeMap}[v[0]]
+			return &SchemaType{Type: t, Elem: elem}, nil
+		case "object":
+			attributes, ok := v[1].(map[string]interface{})
+			if !ok {
+				break
+			}
+
+			s := &SchemaType{Type: TypeObject, Attributes: make(map[string]*SchemaType)}
+			for name, a := range attributes {
+				attributeType, err := schemaTypeFromJSON(a)
+				if err != nil {
+					return nil, err
+				}
+				s.Attributes[name] = attributeType
+			}
+			return s, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported schema type %v", raw)
+}
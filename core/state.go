@@ -0,0 +1,73 @@
+package core
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/hashicorp/go-uuid"
+)
+
+// Terraform 0.12 replaced the module based tfstate format (version 3, terraform.State) with a flat list of
+// resources whose attributes are stored as typed values. Terraform does not export its own implementation of
+// this format, so the subset of it which Formation needs to write is described here.
+
+type StateV4 struct {
+	Version          int                        `json:"version"`
+	TerraformVersion string                     `json:"terraform_version"`
+	Serial           uint64                     `json:"serial"`
+	Lineage          string                     `json:"lineage"`
+	Outputs          map[string]json.RawMessage `json:"outputs"`
+	Resources        []*ResourceStateV4         `json:"resources"`
+
+	// Written by newer versions of Terraform. Preserved untouched when merging.
+	CheckResults json.RawMessage `json:"check_results,omitempty"`
+}
+
+type ResourceStateV4 struct {
+	Module    string             `json:"module,omitempty"`
+	Mode      string             `json:"mode"`
+	Type      string             `json:"type"`
+	Name      string             `json:"name"`
+	EachMode  string             `json:"each,omitempty"`
+	Provider  string             `json:"provider"`
+	Instances []*InstanceStateV4 `json:"instances"`
+}
+
+type InstanceStateV4 struct {
+	IndexKey            interface{}            `json:"index_key,omitempty"`
+	Status              string                 `json:"status,omitempty"`
+	Deposed             string                 `json:"deposed,omitempty"`
+	SchemaVersion       uint64                 `json:"schema_version"`
+	Attributes          map[string]interface{} `json:"attributes"`
+	SensitiveAttributes json.RawMessage        `json:"sensitive_attributes,omitempty"`
+	Private             []byte                 `json:"private,omitempty"`
+	Dependencies        []string               `json:"dependencies,omitempty"`
+	CreateBeforeDestroy bool                   `json:"create_before_destroy,omitempty"`
+}
+
+// NewLineage returns a random lineage for a new state file. Terraform refuses to push a state file over
+// remote state with a different lineage, so this must only be used for state which has never existed before.
+func NewLineage() string {
+	lineage, err := uuid.GenerateUUID()
+	if err != nil {
+		panic(err)
+	}
+	return lineage
+}
+
+// SortResources orders resources by address, so that state files are stable between runs.
+func (s *StateV4) SortResources() {
+	sort.SliceStable(s.Resources, func(i, j int) bool {
+		a, b := s.Resources[i], s.Resources[j]
+		if a.Module != b.Module {
+			return a.Module < b.Module
+		}
+		if a.Mode != b.Mode {
+			return a.Mode < b.Mode
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+}
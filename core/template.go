@@ -0,0 +1,61 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Substitution replaces a literal substring of string values, such as an account ID, with a reference to the
+// value of an expression (e.g. data.aws_caller_identity.current.account_id), so that configuration does not
+// depend on the account or region it was imported from.
+//
+// The literal is only replaced where it is immediately preceded by Prefix and followed by Suffix, which are kept.
+// This allows short values such as the partition (aws) to be replaced only inside an ARN.
+type Substitution struct {
+	Prefix     string
+	Literal    string
+	Suffix     string
+	Expression string
+}
+
+// Contains returns true if value has at least one substring which s would replace.
+func (s *Substitution) Contains(value string) bool {
+	return strings.Contains(value, s.Prefix+s.Literal+s.Suffix)
+}
+
+func (p *Printer) template(value string, escape func(string) string) string {
+	return substitute(value, p.Substitutions, escape)
+}
+
+// Make every substitution in value, escaping the text around them with escape. Substitutions are tried in order
+// at each position, and the first one that matches wins.
+func substitute(value string, substitutions []*Substitution, escape func(string) string) string {
+	if len(substitutions) == 0 {
+		return escape(value)
+	}
+
+	buf := bytes.Buffer{}
+	start := 0
+	for i := 0; i < len(value); {
+		matched := false
+		for _, s := range substitutions {
+			if s.Literal == "" || !strings.HasPrefix(value[i:], s.Prefix+s.Literal+s.Suffix) {
+				continue
+			}
+
+			// The suffix is left in place, so that it can also be the prefix of the next substitution
+			buf.WriteString(escape(value[start : i+len(s.Prefix)]))
+			buf.WriteString("${" + s.Expression + "}")
+			i += len(s.Prefix) + len(s.Literal)
+			start = i
+			matched = true
+			break
+		}
+
+		if !matched {
+			i++
+		}
+	}
+	buf.WriteString(escape(value[start:]))
+	return buf.String()
+}
@@ -0,0 +1,3 @@
+data "aws_vpc" "vpc-1234" {
+    id = "vpc-1234"
+}
\ No newline at end of file
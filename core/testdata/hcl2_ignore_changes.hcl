@@ -0,0 +1,9 @@
+resource "simple_resource" "test" {
+    scalar_field = "scalar_value"
+    lifecycle {
+        ignore_changes = [
+            user_data,
+            desired_capacity,
+        ]
+    }
+}
\ No newline at end of file
@@ -0,0 +1,11 @@
+resource "simple_resource" "test" {
+    policy = jsonencode({
+        Statement = [
+            {
+                Effect = "Allow"
+                Resource = "arn:aws:s3:::bucket/$${aws:username}"
+            },
+        ]
+        Version = "2012-10-17"
+    })
+}
\ No newline at end of file
@@ -0,0 +1,6 @@
+resource "simple_resource" "test" {
+    security_group_ids = [
+        aws_security_group.web.id,
+        "sg-5678",
+    ]
+}
\ No newline at end of file
@@ -0,0 +1,3 @@
+resource "simple_resource" "test" {
+    scalar_field = aws_s3_bucket.name.id
+}
\ No newline at end of file
@@ -0,0 +1,6 @@
+resource "simple_resource" "test" {
+    tags = {
+        Name = "Jimmy"
+        "I.Have.Dots" = "$${not_interpolated}"
+    }
+}
\ No newline at end of file
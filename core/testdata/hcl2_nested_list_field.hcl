@@ -0,0 +1,17 @@
+resource "simple_resource" "test" {
+    attribute_list = [
+        {
+            nested_field = "One"
+        },
+        {
+            nested_field = "Two"
+        },
+    ]
+    block_list {
+        nested_field = "Three"
+    }
+
+    block_list {
+        nested_field = "Four"
+    }
+}
\ No newline at end of file
@@ -0,0 +1,4 @@
+resource "simple_resource" "test" {
+    provider = aws.use1
+    scalar_field = "scalar_value"
+}
\ No newline at end of file
@@ -0,0 +1,4 @@
+import {
+    to = aws_s3_bucket.test
+    id = "my-\"bucket\""
+}
\ No newline at end of file
@@ -0,0 +1,8 @@
+resource "simple_resource" "test" {
+    float_field = 0.5
+    int_field = 3
+    list_field = [
+        80,
+        443,
+    ]
+}
\ No newline at end of file
@@ -0,0 +1,46 @@
+data "aws_iam_policy_document" "test" {
+    statement {
+        sid = "Read"
+        effect = "Allow"
+        actions = [
+            "s3:GetObject",
+            "s3:ListBucket",
+        ]
+        resources = [
+            "arn:aws:s3:::bucket/&{aws:username}/*",
+        ]
+        principals {
+            type = "AWS"
+            identifiers = [
+                "arn:aws:iam::123456789012:role/reader",
+            ]
+        }
+
+        principals {
+            type = "Service"
+            identifiers = [
+                "ec2.amazonaws.com",
+            ]
+        }
+        condition {
+            test = "Bool"
+            variable = "aws:SecureTransport"
+            values = [
+                "true",
+            ]
+        }
+    }
+
+    statement {
+        effect = "Deny"
+        not_actions = [
+            "s3:*",
+        ]
+        principals {
+            type = "AWS"
+            identifiers = [
+                "*",
+            ]
+        }
+    }
+}
\ No newline at end of file
@@ -0,0 +1,4 @@
+provider "aws" {
+    alias = "use1"
+    region = "us-east-1"
+}
\ No newline at end of file
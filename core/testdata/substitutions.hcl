@@ -0,0 +1,8 @@
+resource "simple_resource" "test" {
+    role_arn = "arn:${data.aws_partition.current.partition}:iam::${data.aws_caller_identity.current.account_id}:role/aws-$${role}"
+    policy = <<EOF
+{
+    "Resource": "arn:${data.aws_partition.current.partition}:sqs:${data.aws_region.current.name}:${data.aws_caller_identity.current.account_id}:queue"
+}
+EOF
+}
\ No newline at end of file
@@ -0,0 +1,256 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/config/configschema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// Difference is an attribute whose value read back from configuration is not its value in state.
+type Difference struct {
+	// The path of the attribute, e.g. ingress.0.cidr_blocks.1. Elements of sets are numbered by their position.
+	Path string
+
+	// The value in state and in configuration. Either is empty if the attribute is not set there.
+	State  string
+	Config string
+}
+
+func (d *Difference) String() string {
+	switch {
+	case d.Config == "":
+		return fmt.Sprintf("%s is %q in state but is not set in configuration", d.Path, d.State)
+	case d.State == "":
+		return fmt.Sprintf("%s is not set in state but is %q in configuration", d.Path, d.Config)
+	}
+	return fmt.Sprintf("%s is %q in state but %q in configuration", d.Path, d.State, d.Config)
+}
+
+// Verify compares a resource read back from configuration with the state it was printed from, and returns every
+// attribute which differs.
+//
+// Computed attributes are never printed, so are not compared. Values which refer to something else are unknown,
+// and are assumed to match. Strings holding JSON match if they hold the same document, however it is formatted.
+func Verify(resource *ConfigResource, state *terraform.InstanceState, schema *configschema.Block) []*Difference {
+	parser := InstanceStateParser{Schema: schema}
+	fields := parser.Parse(state).Fields
+
+	v := &verifier{}
+	v.block("", fields, resource.Config, schema)
+	return v.differences
+}
+
+type verifier struct {
+	differences []*Difference
+}
+
+func (v *verifier) differ(path string, state string, config string) {
+	v.differences = append(v.differences, &Difference{Path: path, State: state, Config: config})
+}
+
+// Compare the fields of a block (or of a map, or an object) with its configuration. Anything in the configuration
+// which is not in state must be empty.
+func (v *verifier) block(path string, fields *InlineResource, configuration map[string]interface{}, schema *configschema.Block) {
+	if schema == nil {
+		schema = &configschema.Block{}
+	}
+
+	compared := make(map[string]bool)
+	for _, field := range fields.Fields {
+		compared[field.Key] = true
+
+		if attribute, ok := schema.Attributes[field.Key]; field.Computed || (ok && attribute.Computed) {
+			continue
+		}
+
+		var nested *configschema.Block
+		if block, ok := schema.BlockTypes[field.Key]; ok {
+			nested = &block.Block
+		}
+		v.value(joinPath(path, field.Key), field, configuration[field.Key], nested)
+	}
+
+	for _, key := range sortedKeys(configuration) {
+		if !compared[key] && !emptyValue(configuration[key]) {
+			v.differ(joinPath(path, key), "", describeValue(configuration[key]))
+		}
+	}
+}
+
+func (v *verifier) value(path string, field *Field, configuration interface{}, schema *configschema.Block) {
+	if configuration == config.UnknownVariableValue {
+		return
+	}
+
+	switch field.FieldType {
+	case SCALAR:
+		v.scalar(path, field.ScalarValue, configuration)
+	case MAP, NESTED:
+		v.block(path, field.NestedValue, configMap(configuration), schema)
+	case LIST:
+		v.list(path, field.NestedValue.Fields, configList(configuration), schema)
+	case SET:
+		v.set(path, field.NestedValue.Fields, configList(configuration), schema)
+	}
+}
+
+func (v *verifier) scalar(path string, value *ScalarValue, configuration interface{}) {
+	if emptyValue(configuration) {
+		if value.StringValue != "" {
+			v.differ(path, value.StringValue, "")
+		}
+		return
+	}
+
+	s, ok := configString(configuration)
+	if !ok || !sameScalar(value, s) {
+		v.differ(path, value.StringValue, describeValue(configuration))
+	}
+}
+
+func (v *verifier) list(path string, elements []*Field, configuration []interface{}, schema *configschema.Block) {
+	for i, element := range elements {
+		elementPath := path + "." + strconv.Itoa(i)
+		if i < len(configuration) {
+			v.value(elementPath, element, configuration[i], schema)
+		} else {
+			v.differ(elementPath, describeValue(fieldValue(element)), "")
+		}
+	}
+
+	for i := len(elements); i < len(configuration); i++ {
+		v.differ(path+"."+strconv.Itoa(i), "", describeValue(configuration[i]))
+	}
+}
+
+// Sets are unordered, so each element in state is matched with any element of the configuration which has the
+// same value. Elements which match nothing are compared with the configuration which is left over, in order.
+func (v *verifier) set(path string, elements []*Field, configuration []interface{}, schema *configschema.Block) {
+	used := make([]bool, len(configuration))
+	var unmatched []int
+
+	for i, element := range elements {
+		matched := false
+		for j, c := range configuration {
+			if used[j] {
+				continue
+			}
+
+			candidate := &verifier{}
+			candidate.value(path, element, c, schema)
+			if len(candidate.differences) == 0 {
+				used[j], matched = true, true
+				break
+			}
+		}
+
+		if !matched {
+			unmatched = append(unmatched, i)
+		}
+	}
+
+	var left []interface{}
+	for j, c := range configuration {
+		if !used[j] {
+			left = append(left, c)
+		}
+	}
+
+	for n, i := range unmatched {
+		elementPath := path + "." + strconv.Itoa(i)
+		if n < len(left) {
+			v.value(elementPath, elements[i], left[n], schema)
+		} else {
+			v.differ(elementPath, describeValue(fieldValue(elements[i])), "")
+		}
+	}
+
+	for n := len(unmatched); n < len(left); n++ {
+		v.differ(path+"."+strconv.Itoa(len(elements)+n-len(unmatched)), "", describeValue(left[n]))
+	}
+}
+
+// Numbers and booleans may be written differently to the way they are held in state, e.g. 1.50 as 1.5. Strings
+// match if they are equal, or if they hold the same JSON document.
+func sameScalar(value *ScalarValue, configuration string) bool {
+	if value.StringValue == configuration {
+		return true
+	}
+
+	switch value.Kind {
+	case TypeInt, TypeFloat:
+		f, err := strconv.ParseFloat(configuration, 64)
+		if err != nil {
+			return false
+		}
+		if value.Kind == TypeInt {
+			return f == float64(value.IntValue)
+		}
+		return f == value.FloatValue
+	case TypeBool:
+		b, err := strconv.ParseBool(configuration)
+		return err == nil && b == value.BoolValue
+	}
+
+	var expected, actual interface{}
+	if json.Unmarshal([]byte(value.StringValue), &expected) != nil || json.Unmarshal([]byte(configuration), &actual) != nil {
+		return false
+	}
+	return reflect.DeepEqual(expected, actual)
+}
+
+// Empty strings and collections are never printed, so are the same as a value which is not set.
+func emptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// Single nested blocks are decoded as a map, rather than a list holding one map.
+func configList(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		return []interface{}{v}
+	}
+	return nil
+}
+
+func configMap(value interface{}) map[string]interface{} {
+	m, _ := value.(map[string]interface{})
+	return m
+}
+
+// The value of a field in the same form as a configuration value, for reporting.
+func fieldValue(field *Field) interface{} {
+	switch field.FieldType {
+	case SCALAR:
+		return field.ScalarValue.StringValue
+	case MAP, NESTED:
+		m := make(map[string]interface{})
+		for _, f := range field.NestedValue.Fields {
+			m[f.Key] = fieldValue(f)
+		}
+		return m
+	}
+
+	list := make([]interface{}, 0, len(field.NestedValue.Fields))
+	for _, f := range field.NestedValue.Fields {
+		list = append(list, fieldValue(f))
+	}
+	return list
+}
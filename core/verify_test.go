@@ -0,0 +1,203 @@
+package core_test
+
+import (
+	"strings"
+
+	. "github.com/jmcgill/formation/core"
+
+	"github.com/hashicorp/terraform/config/configschema"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Verify", func() {
+	rule := nestedResource(map[string]*schema.Schema{
+		"cidr_blocks": optionalList(optionalString),
+		"from_port":   optionalInt,
+		"protocol":    optionalString,
+	})
+
+	resourceSchema := coreSchema(map[string]*schema.Schema{
+		"description": optionalString,
+		"enabled":     optionalBool,
+		"ingress":     optionalSet(rule),
+		"names":       optionalSet(optionalString),
+		"policy":      optionalString,
+		"tags":        optionalMap,
+		"vpc_id":      optionalString,
+	})
+
+	state := &terraform.InstanceState{
+		ID: "sg-1234",
+		Attributes: map[string]string{
+			"id":                            "sg-1234",
+			"description":                   "Line one\nline \"two\" with ${braces}\n",
+			"enabled":                       "true",
+			"ingress.#":                     "2",
+			"ingress.1111.cidr_blocks.#":    "2",
+			"ingress.1111.cidr_blocks.0":    "10.0.0.0/16",
+			"ingress.1111.cidr_blocks.1":    "10.1.0.0/16",
+			"ingress.1111.from_port":        "443",
+			"ingress.1111.protocol":         "tcp",
+			"ingress.2222.cidr_blocks.#":    "1",
+			"ingress.2222.cidr_blocks.0":    "0.0.0.0/0",
+			"ingress.2222.from_port":        "80",
+			"ingress.2222.protocol":         "tcp",
+			"names.#":                       "2",
+			"names.3333":                    "b",
+			"names.4444":                    "a",
+			"policy":                        `{"Version": "2012-10-17", "Statement": [{"Resource": "${aws:username}"}]}`,
+			"tags.%":                        "2",
+			"tags.Name":                     "example",
+			"tags.kubernetes.io/cluster/ab": "owned",
+			"vpc_id":                        "vpc-1234",
+		},
+	}
+
+	// Print the resource described by state, optionally editing the configuration, and read it back
+	read := func(syntax Syntax, edit func(string) string) *ConfigResource {
+		parser := InstanceStateParser{Schema: resourceSchema}
+		resource := parser.Parse(state)
+		resource.Type = "aws_security_group"
+		resource.Name = "example"
+
+		printer := Printer{Syntax: syntax, Schema: resourceSchema}
+		src := printer.Print(resource)
+		if edit != nil {
+			src = edit(src)
+		}
+
+		reader := ConfigReader{
+			Syntax: syntax,
+			Schema: func(string, bool) *configschema.Block { return resourceSchema },
+		}
+		resources, err := reader.Read("aws_security_group.tf", []byte(src))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(resources).To(HaveLen(1))
+		Expect(resources[0].Address()).To(Equal("aws_security_group.example"))
+		return resources[0]
+	}
+
+	// As read, but printing the resource in Terraform's JSON syntax
+	readJSON := func(syntax Syntax, edit func(string) string) *ConfigResource {
+		parser := InstanceStateParser{Schema: resourceSchema}
+		resource := parser.Parse(state)
+		resource.Type = "aws_security_group"
+		resource.Name = "example"
+
+		config := JSONConfig{Syntax: syntax}
+		config.AddResource(resource, nil)
+		src := config.Print()
+		if edit != nil {
+			src = edit(src)
+		}
+
+		reader := ConfigReader{
+			Syntax: syntax,
+			Schema: func(string, bool) *configschema.Block { return resourceSchema },
+		}
+		resources, err := reader.Read("aws_security_group.tf.json", []byte(src))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(resources).To(HaveLen(1))
+		Expect(resources[0].Address()).To(Equal("aws_security_group.example"))
+		return resources[0]
+	}
+
+	for _, syntaxName := range []string{"HCL1", "HCL2"} {
+		syntax, name := HCL1, syntaxName
+		if name == "HCL2" {
+			syntax = HCL2
+		}
+
+		It("should read back every attribute printed as "+name, func() {
+			resource := read(syntax, nil)
+			Expect(resource.Err).ShouldNot(HaveOccurred())
+			Expect(Verify(resource, state, resourceSchema)).To(BeEmpty())
+		})
+
+		It("should report the path of an attribute which differs in "+name, func() {
+			resource := read(syntax, func(src string) string {
+				return strings.Replace(src, "10.1.0.0/16", "10.2.0.0/16", 1)
+			})
+			Expect(resource.Err).ShouldNot(HaveOccurred())
+
+			differences := Verify(resource, state, resourceSchema)
+			Expect(differences).To(HaveLen(1))
+			Expect(differences[0].Path).To(Equal("ingress.0.cidr_blocks.1"))
+			Expect(differences[0].State).To(Equal("10.1.0.0/16"))
+			Expect(differences[0].Config).To(Equal("10.2.0.0/16"))
+		})
+
+		It("should report attributes which are missing from "+name, func() {
+			resource := read(syntax, func(src string) string {
+				return strings.Replace(src, "enabled = true\n", "", 1)
+			})
+			Expect(resource.Err).ShouldNot(HaveOccurred())
+
+			differences := Verify(resource, state, resourceSchema)
+			Expect(differences).To(HaveLen(1))
+			Expect(differences[0].String()).To(Equal(`enabled is "true" in state but is not set in configuration`))
+		})
+
+		It("should not compare references in "+name, func() {
+			resource := read(syntax, func(src string) string {
+				if syntax == HCL2 {
+					return strings.Replace(src, `"vpc-1234"`, "aws_vpc.main.id", 1)
+				}
+				return strings.Replace(src, `"vpc-1234"`, `"${aws_vpc.main.id}"`, 1)
+			})
+			Expect(resource.Err).ShouldNot(HaveOccurred())
+			Expect(Verify(resource, state, resourceSchema)).To(BeEmpty())
+		})
+
+		It("should list references as computed keys when read from "+name, func() {
+			resource := read(syntax, func(src string) string {
+				if syntax == HCL2 {
+					return strings.Replace(src, `"vpc-1234"`, "aws_vpc.main.id", 1)
+				}
+				return strings.Replace(src, `"vpc-1234"`, `"${aws_vpc.main.id}"`, 1)
+			})
+			Expect(resource.Err).ShouldNot(HaveOccurred())
+
+			c := resource.ResourceConfig()
+			Expect(c.ComputedKeys).To(Equal([]string{"vpc_id"}))
+			Expect(c.IsComputed("vpc_id")).To(BeTrue())
+			Expect(c.IsComputed("description")).To(BeFalse())
+		})
+
+		It("should fail to decode attributes which are not in the schema in "+name, func() {
+			resource := read(syntax, func(src string) string {
+				return strings.Replace(src, "enabled = true", "enabled = true\n    unknown = true", 1)
+			})
+			Expect(resource.Err).Should(HaveOccurred())
+		})
+
+		It("should read back every attribute printed as JSON for "+name, func() {
+			resource := readJSON(syntax, nil)
+			Expect(resource.Err).ShouldNot(HaveOccurred())
+			Expect(Verify(resource, state, resourceSchema)).To(BeEmpty())
+		})
+
+		It("should report the path of an attribute which differs in JSON for "+name, func() {
+			resource := readJSON(syntax, func(src string) string {
+				return strings.Replace(src, "10.1.0.0/16", "10.2.0.0/16", 1)
+			})
+			Expect(resource.Err).ShouldNot(HaveOccurred())
+
+			differences := Verify(resource, state, resourceSchema)
+			Expect(differences).To(HaveLen(1))
+			Expect(differences[0].Path).To(Equal("ingress.0.cidr_blocks.1"))
+		})
+
+		It("should not compare references in JSON for "+name, func() {
+			resource := readJSON(syntax, func(src string) string {
+				return strings.Replace(src, `"vpc-1234"`, `"${aws_vpc.main.id}"`, 1)
+			})
+			Expect(resource.Err).ShouldNot(HaveOccurred())
+			Expect(resource.ResourceConfig().ComputedKeys).To(Equal([]string{"vpc_id"}))
+			Expect(Verify(resource, state, resourceSchema)).To(BeEmpty())
+		})
+	}
+})
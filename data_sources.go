@@ -0,0 +1,279 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmcgill/formation/aws"
+	"github.com/jmcgill/formation/core"
+)
+
+// A field which refers to something that was not imported (an AMI, the default VPC, an AWS managed IAM policy) is
+// left holding the raw ID or ARN once linking is done. With -data-sources, each of those values is looked up with a
+// data source instead, and the field links to that data source. AMIs and VPCs are described while importing, so
+// that their data sources search by owner and name, or for the default VPC, rather than by ID, and configuration
+// can be applied to other accounts. The ID is only used when a value could not be described.
+
+// A kind of value which a data source can look up.
+type dataSourceKind struct {
+	// The type of the data source, e.g. aws_vpc
+	resourceType string
+
+	// The attribute of the data source which holds the value, e.g. id
+	attribute string
+
+	// Returns true if value, held by the attribute key, is something this data source can look up
+	matches func(key string, value string) bool
+
+	// Optional. Returns the attributes of the thing value identifies, which arguments searches by in place of value
+	describe func(meta interface{}, value string) (map[string]string, error)
+
+	// The name to give the data source which looks up value. attributes is nil if value was not described.
+	name func(value string, attributes map[string]string) string
+
+	// The arguments of the data source which looks up value. attributes is nil if value was not described.
+	arguments func(value string, attributes map[string]string) []*core.Field
+}
+
+var (
+	amiID = regexp.MustCompile(`^ami-[0-9a-f]{8,17}$`)
+	vpcID = regexp.MustCompile(`^vpc-[0-9a-f]{8,17}$`)
+)
+
+var dataSourceKinds = []*dataSourceKind{
+	{
+		resourceType: "aws_iam_policy",
+		attribute:    "arn",
+		matches: func(key string, value string) bool {
+			return isAWSManagedPolicyARN(value)
+		},
+		name: func(value string, attributes map[string]string) string {
+			return value[strings.LastIndex(value, "/")+1:]
+		},
+		arguments: func(value string, attributes map[string]string) []*core.Field {
+			return []*core.Field{stringField("arn", value)}
+		},
+	},
+	{
+		resourceType: "aws_ami",
+		attribute:    "id",
+		matches: func(key string, value string) bool {
+			return (key == "ami" || strings.HasSuffix(key, "_ami") || strings.HasSuffix(key, "image_id")) && amiID.MatchString(value)
+		},
+		describe: aws.DescribeImage,
+		name: func(value string, attributes map[string]string) string {
+			if attributes["name"] != "" {
+				return attributes["name"]
+			}
+			return value
+		},
+		arguments: func(value string, attributes map[string]string) []*core.Field {
+			if attributes == nil {
+				return []*core.Field{filterBlock("image-id", value)}
+			}
+
+			// Aliases such as amazon are the same in every account
+			owner := attributes["image_owner_alias"]
+			if owner == "" {
+				owner = attributes["owner_id"]
+			}
+			return []*core.Field{
+				{
+					FieldType:   core.LIST,
+					Key:         "owners",
+					NestedValue: &core.InlineResource{Fields: []*core.Field{stringField("", owner)}},
+				},
+				filterBlock("name", attributes["name"]),
+			}
+		},
+	},
+	{
+		resourceType: "aws_vpc",
+		attribute:    "id",
+		matches: func(key string, value string) bool {
+			return (strings.HasSuffix(key, "vpc_id") || strings.HasSuffix(key, "vpc_ids")) && vpcID.MatchString(value)
+		},
+		describe: aws.DescribeVpc,
+		name: func(value string, attributes map[string]string) string {
+			if attributes["default"] == "true" {
+				return "default"
+			}
+			if attributes["tags.Name"] != "" {
+				return attributes["tags.Name"]
+			}
+			return value
+		},
+		arguments: func(value string, attributes map[string]string) []*core.Field {
+			if attributes == nil {
+				return []*core.Field{stringField("id", value)}
+			}
+
+			if attributes["default"] == "true" {
+				return []*core.Field{
+					{
+						FieldType:   core.SCALAR,
+						Key:         "default",
+						ScalarValue: core.NewScalarValue("true", core.TypeBool),
+					},
+				}
+			}
+
+			arguments := []*core.Field{stringField("cidr_block", attributes["cidr_block"])}
+			if attributes["tags.Name"] != "" {
+				arguments = append(arguments, &core.Field{
+					FieldType:   core.MAP,
+					Key:         "tags",
+					NestedValue: &core.InlineResource{Fields: []*core.Field{stringField("Name", attributes["tags.Name"])}},
+				})
+			}
+			return arguments
+		},
+	},
+}
+
+// Policies managed by AWS have ARNs of the form arn:aws:iam::aws:policy/AdministratorAccess
+func isAWSManagedPolicyARN(value string) bool {
+	parts := strings.SplitN(value, ":", 6)
+	return len(parts) == 6 && parts[0] == "arn" && parts[2] == "iam" && parts[4] == "aws" && strings.HasPrefix(parts[5], "policy/")
+}
+
+// A filter block, as used by data sources which search EC2
+func filterBlock(name string, values ...string) *core.Field {
+	valueList := &core.InlineResource{}
+	for _, value := range values {
+		valueList.Append(stringField("", value))
+	}
+
+	filter := &core.InlineResource{}
+	filter.Append(stringField("name", name))
+	filter.Append(&core.Field{
+		FieldType:   core.LIST,
+		Key:         "values",
+		NestedValue: valueList,
+	})
+
+	return &core.Field{
+		FieldType: core.LIST,
+		Key:       "filter",
+		NestedValue: &core.InlineResource{
+			Fields: []*core.Field{
+				{
+					FieldType:   core.NESTED,
+					NestedValue: filter,
+				},
+			},
+		},
+	}
+}
+
+// GenerateDataSources creates a data source for every value which was left unlinked and which one of
+// dataSourceKinds can look up, and links those values to it. Links to imported resources must already have been
+// resolved. Data sources are returned in a stable order.
+func GenerateDataSources(allResources map[string][]*ImportedResource) []*core.Resource {
+	g := &dataSourceGenerator{
+		byValue: make(map[string]*core.Resource),
+		names:   make(map[string]bool),
+	}
+
+	for _, resourceType := range SortedTypes(allResources) {
+		for _, importedResource := range allResources[resourceType] {
+			g.link(importedResource, importedResource.resource.Fields, "")
+			for _, document := range importedResource.policyDocuments {
+				g.link(importedResource, document.Fields, "")
+			}
+		}
+	}
+
+	sort.SliceStable(g.dataSources, func(i, j int) bool {
+		if g.dataSources[i].Type != g.dataSources[j].Type {
+			return g.dataSources[i].Type < g.dataSources[j].Type
+		}
+		return g.dataSources[i].Name < g.dataSources[j].Name
+	})
+	return g.dataSources
+}
+
+type dataSourceGenerator struct {
+	// Keyed by data source type, value and (for regional data sources) provider
+	byValue map[string]*core.Resource
+
+	// The addresses which have already been given to a data source
+	names map[string]bool
+
+	dataSources []*core.Resource
+}
+
+func (g *dataSourceGenerator) link(importedResource *ImportedResource, r *core.InlineResource, parentKey string) {
+	walkDataSourceValues(importedResource, r, parentKey, func(f *core.Field, kind *dataSourceKind) {
+		value := f.ScalarValue.StringValue
+		f.Link = g.dataSource(kind, importedResource, value).Address() + "." + kind.attribute
+	})
+}
+
+// Call visit for every unlinked scalar in r which one of dataSourceKinds can look up. The elements of a list or set
+// have no key of their own, so they are matched by the key of the list which holds them.
+func walkDataSourceValues(importedResource *ImportedResource, r *core.InlineResource, parentKey string, visit func(*core.Field, *dataSourceKind)) {
+	root := importedResource.resource
+	for _, f := range r.Fields {
+		key := f.Key
+		if key == "" {
+			key = parentKey
+		}
+
+		switch f.FieldType {
+		case core.SCALAR:
+			if f.Link != "" || f.ScalarValue == nil || f.ScalarValue.StringValue == "" {
+				continue
+			}
+
+			value := f.ScalarValue.StringValue
+			for _, kind := range dataSourceKinds {
+				// A resource never looks itself up
+				if !kind.matches(key, value) || (root.Type == kind.resourceType && value == importedResource.state.ID) {
+					continue
+				}
+
+				visit(f, kind)
+				break
+			}
+
+		case core.LIST, core.SET, core.NESTED:
+			walkDataSourceValues(importedResource, f.NestedValue, key, visit)
+		}
+	}
+}
+
+// The data source which looks up value for resources managed by the same provider as root, which is created the
+// first time it is needed.
+func (g *dataSourceGenerator) dataSource(kind *dataSourceKind, importedResource *ImportedResource, value string) *core.Resource {
+	root := importedResource.resource
+	key := kind.resourceType + "." + value
+	if !aws.IsGlobal(kind.resourceType) {
+		key += "." + root.Provider
+	}
+
+	if dataSource, ok := g.byValue[key]; ok {
+		return dataSource
+	}
+
+	attributes := importedResource.lookups[value]
+	base := core.Format(kind.name(value, attributes))
+	name := base
+	for i := 2; g.names[kind.resourceType+"."+name]; i++ {
+		name = base + "-" + strconv.Itoa(i)
+	}
+	g.names[kind.resourceType+"."+name] = true
+
+	dataSource := &core.Resource{
+		Type:       kind.resourceType,
+		Name:       name,
+		Provider:   root.Provider,
+		DataSource: true,
+		Fields:     &core.InlineResource{Fields: kind.arguments(value, attributes)},
+	}
+	g.byValue[key] = dataSource
+	g.dataSources = append(g.dataSources, dataSource)
+	return dataSource
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/jmcgill/formation/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GenerateDataSources", func() {
+	imported := func(resource *core.Resource, id string) *ImportedResource {
+		return &ImportedResource{resource: resource, state: &terraform.InstanceState{ID: id}}
+	}
+
+	// The link held by the field with key
+	link := func(resource *core.Resource, key string) string {
+		for _, f := range resource.Fields.Fields {
+			if f.Key == key {
+				return f.Link
+			}
+		}
+		return ""
+	}
+
+	// The scalar arguments of a data source, and the values of its lists and filter blocks
+	arguments := func(dataSource *core.Resource) map[string][]string {
+		arguments := make(map[string][]string)
+		for _, f := range dataSource.Fields.Fields {
+			switch f.FieldType {
+			case core.SCALAR:
+				arguments[f.Key] = []string{f.ScalarValue.StringValue}
+			case core.MAP:
+				for _, element := range f.NestedValue.Fields {
+					arguments[f.Key+"."+element.Key] = []string{element.ScalarValue.StringValue}
+				}
+			case core.LIST:
+				for _, element := range f.NestedValue.Fields {
+					if element.FieldType == core.SCALAR {
+						arguments[f.Key] = append(arguments[f.Key], element.ScalarValue.StringValue)
+						continue
+					}
+
+					// A filter block holds a name and a list of values
+					name := element.NestedValue.Fields[0].ScalarValue.StringValue
+					for _, value := range element.NestedValue.Fields[1].NestedValue.Fields {
+						arguments[f.Key+"."+name] = append(arguments[f.Key+"."+name], value.ScalarValue.StringValue)
+					}
+				}
+			}
+		}
+		return arguments
+	}
+
+	It("should only replace attributes which hold that kind of ID", func() {
+		group := testResource("aws_security_group", "endpoints", map[string]string{
+			"name":   "vpc-endpoints-sg",
+			"vpc_id": "vpc-0123abcd",
+		})
+		instance := testResource("aws_instance", "web", map[string]string{
+			"ami":         "ami-0123abcd",
+			"description": "ami-0123abcd",
+		})
+
+		dataSources := GenerateDataSources(map[string][]*ImportedResource{
+			"aws_security_group": {imported(group, "sg-1234")},
+			"aws_instance":       {imported(instance, "i-1234")},
+		})
+
+		Expect(dataSources).To(HaveLen(2))
+		Expect(link(group, "name")).To(BeEmpty())
+		Expect(link(group, "vpc_id")).To(Equal("data.aws_vpc.vpc-0123abcd.id"))
+		Expect(link(instance, "ami")).To(Equal("data.aws_ami.ami-0123abcd.id"))
+		Expect(link(instance, "description")).To(BeEmpty())
+	})
+
+	It("should only replace values in the format of the ID", func() {
+		group := testResource("aws_security_group", "web", map[string]string{"vpc_id": "vpc-main"})
+
+		Expect(GenerateDataSources(map[string][]*ImportedResource{"aws_security_group": {imported(group, "sg-1234")}})).To(BeEmpty())
+		Expect(link(group, "vpc_id")).To(BeEmpty())
+	})
+
+	It("should match the elements of a list by the key of the list", func() {
+		endpoint := testResource("aws_vpc_peering_connection", "peer", nil)
+		endpoint.Fields.Append(&core.Field{
+			FieldType: core.LIST,
+			Key:       "peer_vpc_ids",
+			NestedValue: &core.InlineResource{
+				Fields: []*core.Field{{FieldType: core.SCALAR, ScalarValue: core.NewScalarValue("vpc-0123abcd", core.TypeString)}},
+			},
+		})
+
+		dataSources := GenerateDataSources(map[string][]*ImportedResource{"aws_vpc_peering_connection": {imported(endpoint, "pcx-1234")}})
+		Expect(dataSources).To(HaveLen(1))
+		Expect(endpoint.Fields.Fields[0].NestedValue.Fields[0].Link).To(Equal("data.aws_vpc.vpc-0123abcd.id"))
+	})
+
+	It("should look up the default VPC without its ID", func() {
+		group := imported(testResource("aws_security_group", "web", map[string]string{"vpc_id": "vpc-0123abcd"}), "sg-1234")
+		group.lookups = map[string]map[string]string{"vpc-0123abcd": {"default": "true", "cidr_block": "172.31.0.0/16"}}
+
+		dataSources := GenerateDataSources(map[string][]*ImportedResource{"aws_security_group": {group}})
+		Expect(dataSources).To(HaveLen(1))
+		Expect(dataSources[0].Address()).To(Equal("data.aws_vpc.default"))
+		Expect(arguments(dataSources[0])).To(Equal(map[string][]string{"default": {"true"}}))
+	})
+
+	It("should look up other VPCs by their CIDR block and Name tag", func() {
+		group := imported(testResource("aws_security_group", "web", map[string]string{"vpc_id": "vpc-0123abcd"}), "sg-1234")
+		group.lookups = map[string]map[string]string{"vpc-0123abcd": {"default": "false", "cidr_block": "10.0.0.0/16", "tags.Name": "main"}}
+
+		dataSources := GenerateDataSources(map[string][]*ImportedResource{"aws_security_group": {group}})
+		Expect(dataSources[0].Address()).To(Equal("data.aws_vpc.main"))
+		Expect(arguments(dataSources[0])).To(Equal(map[string][]string{"cidr_block": {"10.0.0.0/16"}, "tags.Name": {"main"}}))
+	})
+
+	It("should look up AMIs by their owner and name", func() {
+		instance := imported(testResource("aws_instance", "web", map[string]string{"ami": "ami-0123abcd"}), "i-1234")
+		instance.lookups = map[string]map[string]string{
+			"ami-0123abcd": {"name": "amzn2-ami-hvm-2.0", "owner_id": "137112412989", "image_owner_alias": "amazon"},
+		}
+
+		dataSources := GenerateDataSources(map[string][]*ImportedResource{"aws_instance": {instance}})
+		Expect(dataSources[0].Address()).To(Equal("data.aws_ami.amzn2-ami-hvm-2_0"))
+		Expect(arguments(dataSources[0])).To(Equal(map[string][]string{"owners": {"amazon"}, "filter.name": {"amzn2-ami-hvm-2.0"}}))
+	})
+
+	It("should look up values which were not described by their ID", func() {
+		instance := imported(testResource("aws_instance", "web", map[string]string{"ami": "ami-0123abcd"}), "i-1234")
+
+		dataSources := GenerateDataSources(map[string][]*ImportedResource{"aws_instance": {instance}})
+		Expect(arguments(dataSources[0])).To(Equal(map[string][]string{"filter.image-id": {"ami-0123abcd"}}))
+	})
+
+	It("should look up AWS managed policies in any attribute", func() {
+		attachment := testResource("aws_iam_role_policy_attachment", "admin", map[string]string{
+			"policy_arn": "arn:aws:iam::aws:policy/AdministratorAccess",
+		})
+
+		dataSources := GenerateDataSources(map[string][]*ImportedResource{"aws_iam_role_policy_attachment": {imported(attachment, "admin")}})
+		Expect(link(attachment, "policy_arn")).To(Equal("data.aws_iam_policy.AdministratorAccess.arn"))
+		Expect(arguments(dataSources[0])).To(Equal(map[string][]string{"arn": {"arn:aws:iam::aws:policy/AdministratorAccess"}}))
+	})
+
+	It("should share a data source between resources of the same provider, and name them uniquely", func() {
+		web := testResource("aws_security_group", "web", map[string]string{"vpc_id": "vpc-0123abcd"})
+		east := testResource("aws_security_group", "east", map[string]string{"vpc_id": "vpc-0123abcd"})
+		west := testResource("aws_security_group", "west", map[string]string{"vpc_id": "vpc-0123abcd"})
+		west.Provider = "aws.usw2"
+
+		dataSources := GenerateDataSources(map[string][]*ImportedResource{
+			"aws_security_group": {imported(web, "sg-1"), imported(east, "sg-2"), imported(west, "sg-3")},
+		})
+		Expect(dataSources).To(HaveLen(2))
+		Expect(link(web, "vpc_id")).To(Equal("data.aws_vpc.vpc-0123abcd.id"))
+		Expect(link(east, "vpc_id")).To(Equal("data.aws_vpc.vpc-0123abcd.id"))
+		Expect(link(west, "vpc_id")).To(Equal("data.aws_vpc.vpc-0123abcd-2.id"))
+	})
+
+	It("should not replace values which are already linked, or look a resource up from itself", func() {
+		linked := testResource("aws_security_group", "web", map[string]string{"vpc_id": "vpc-0123abcd"})
+		linked.Fields.Fields[0].Link = "aws_vpc.main.id"
+		ami := testResource("aws_ami", "base", map[string]string{"source_ami": "ami-0123abcd"})
+
+		dataSources := GenerateDataSources(map[string][]*ImportedResource{
+			"aws_security_group": {imported(linked, "sg-1234")},
+			"aws_ami":            {imported(ami, "ami-0123abcd")},
+		})
+		Expect(dataSources).To(BeEmpty())
+		Expect(link(linked, "vpc_id")).To(Equal("aws_vpc.main.id"))
+	})
+})
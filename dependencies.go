@@ -0,0 +1,258 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/jmcgill/formation/core"
+)
+
+// When importing with -with-dependencies, the selected resources are imported along with every resource they
+// reference, directly or transitively, so that the configuration which is written is self-contained. Resource
+// types which may be referenced are found by following the links declared by each importer, and the links which
+// InferLink may propose. Once everything has been imported and linked, resources of those types which are not
+// referenced are dropped.
+//
+// A selected resource type may also be referenced, e.g. by a filtered resource of the same or another selected
+// type. Such types are imported as dependencies, and their resources which match the filter are kept whether or
+// not they are referenced.
+
+// DependencyTypes returns every resource type that the importers in roots may link to, directly or transitively,
+// including any of the roots themselves.
+func DependencyTypes(importers map[string]core.Importer, roots map[string]core.Importer, provider *schema.Provider) []string {
+	queued := make(map[string]bool)
+	queue := make([]string, 0, len(roots))
+	for resourceType := range roots {
+		queued[resourceType] = true
+		queue = append(queue, resourceType)
+	}
+
+	targets := make(map[string]bool)
+	for len(queue) > 0 {
+		resourceType := queue[0]
+		queue = queue[1:]
+
+		importer, ok := importers[resourceType]
+		if !ok {
+			continue
+		}
+
+		for _, targetType := range linkTargets(resourceType, importer, importers, provider) {
+			if _, ok := importers[targetType]; !ok {
+				continue
+			}
+
+			targets[targetType] = true
+			if !queued[targetType] {
+				queued[targetType] = true
+				queue = append(queue, targetType)
+			}
+		}
+	}
+
+	dependencies := make([]string, 0, len(targets))
+	for targetType := range targets {
+		dependencies = append(dependencies, targetType)
+	}
+	sort.Strings(dependencies)
+	return dependencies
+}
+
+// RootImporters returns the importers in roots which are not also dependencies. The others are imported along
+// with the dependencies, so that their resources which were not selected can still be referenced.
+func RootImporters(roots map[string]core.Importer, dependencies map[string]core.Importer) map[string]core.Importer {
+	selected := make(map[string]core.Importer)
+	for resourceType, importer := range roots {
+		if _, ok := dependencies[resourceType]; !ok {
+			selected[resourceType] = importer
+		}
+	}
+	return selected
+}
+
+// The resource types a resource of resourceType may link to. Besides the links declared by its importer, an
+// attribute named after a resource type (e.g. vpc_id) may be inferred to link to that type. An attribute may also
+// hold an EC2 ID or an ARN, which may be inferred to link to the type those identify, but only attributes named
+// after that type (e.g. security_groups or role) are expected to hold them. Attributes named arn or *_arn which name
+// no type, and policies, may hold the ARN of anything. Attributes which cannot be configured are never linked.
+func linkTargets(resourceType string, importer core.Importer, importers map[string]core.Importer, provider *schema.Provider) []string {
+	var targets []string
+	for _, target := range importer.Links() {
+		targets = append(targets, strings.SplitN(target, ".", 2)[0])
+	}
+
+	r, ok := provider.ResourcesMap[resourceType]
+	if !ok {
+		return targets
+	}
+
+	var policyAttributes []string
+	if policyImporter, ok := importer.(core.PolicyImporter); ok {
+		policyAttributes = policyImporter.PolicyAttributes()
+	}
+
+	configurableAttributes(r.Schema, func(name string) {
+		for _, suffix := range []string{"_ids", "_id", "_arn"} {
+			if strings.HasSuffix(name, suffix) {
+				stem := strings.TrimSuffix(name, suffix)
+				for targetType := range importers {
+					if namedAfter(stem)(targetType) {
+						targets = append(targets, targetType)
+					}
+				}
+				break
+			}
+		}
+
+		stem := referenceStem(name)
+		for _, p := range idPrefixes {
+			if refersTo(stem, p.resourceType) {
+				targets = append(targets, p.resourceType)
+			}
+		}
+
+		var arnTargets []string
+		for _, types := range arnTypes {
+			for _, targetType := range types {
+				if refersTo(stem, targetType) {
+					arnTargets = append(arnTargets, targetType)
+				}
+			}
+		}
+
+		anyARN := len(arnTargets) == 0 && (name == "arn" || strings.HasSuffix(name, "_arn") || strings.HasSuffix(name, "_arns"))
+		if anyARN || contains(policyAttributes, name) {
+			arnTargets = nil
+			for _, types := range arnTypes {
+				arnTargets = append(arnTargets, types...)
+			}
+		}
+		targets = append(targets, arnTargets...)
+	})
+	return targets
+}
+
+// Attributes which hold the ID of a resource type without being named after it, by the stem of their name.
+var referenceAliases = map[string][]string{
+	"allocation":          {"aws_eip"},
+	"egress_only_gateway": {"aws_egress_only_internet_gateway"},
+}
+
+// The name of an attribute without the suffix of a reference or a plural, e.g. security_group for
+// vpc_security_group_ids or security_groups.
+func referenceStem(name string) string {
+	for _, suffix := range []string{"_ids", "_id", "_arns", "_arn", "s"} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return name
+}
+
+// Whether an attribute with the given stem may refer to a resource of resourceType: it is named after the type
+// (role for aws_iam_role), or the type is named at the end of it (vpc_security_group for aws_security_group).
+func refersTo(stem string, resourceType string) bool {
+	if stem == "" {
+		return false
+	}
+	for _, alias := range referenceAliases[stem] {
+		if alias == resourceType {
+			return true
+		}
+	}
+	return namedAfter(stem)(resourceType) || strings.HasSuffix(stem, "_"+strings.TrimPrefix(resourceType, "aws_"))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Call visit with the name of every attribute of s which can be written in configuration, including the
+// attributes of nested blocks.
+func configurableAttributes(s map[string]*schema.Schema, visit func(name string)) {
+	for name, attribute := range s {
+		if !attribute.Optional && !attribute.Required {
+			continue
+		}
+		visit(name)
+
+		if nested, ok := attribute.Elem.(*schema.Resource); ok {
+			configurableAttributes(nested.Schema, visit)
+		}
+	}
+}
+
+// SelectDependencies keeps every resource which was selected directly, and every dependency which one of those
+// resources links to. Links must already have been resolved.
+func SelectDependencies(allResources map[string][]*ImportedResource) map[string][]*ImportedResource {
+	byAddress := make(map[string]*ImportedResource)
+	var queue []*ImportedResource
+	for _, resourceType := range SortedTypes(allResources) {
+		for _, importedResource := range allResources[resourceType] {
+			resource := importedResource.resource
+			byAddress[resource.Type+"."+resource.Name] = importedResource
+
+			if !importedResource.dependency {
+				queue = append(queue, importedResource)
+			}
+		}
+	}
+
+	keep := make(map[*ImportedResource]bool)
+	for _, importedResource := range queue {
+		keep[importedResource] = true
+	}
+
+	for len(queue) > 0 {
+		importedResource := queue[0]
+		queue = queue[1:]
+
+		addresses := linkedAddresses(importedResource.resource.Fields)
+		for _, document := range importedResource.policyDocuments {
+			addresses = append(addresses, linkedAddresses(document.Fields)...)
+		}
+
+		for _, address := range addresses {
+			target, ok := byAddress[address]
+			if !ok || keep[target] {
+				continue
+			}
+			keep[target] = true
+			queue = append(queue, target)
+		}
+	}
+
+	selected := make(map[string][]*ImportedResource)
+	for resourceType, resources := range allResources {
+		for _, importedResource := range resources {
+			if keep[importedResource] {
+				selected[resourceType] = append(selected[resourceType], importedResource)
+			}
+		}
+	}
+	return selected
+}
+
+// The addresses (type.name) of every resource linked to from r.
+func linkedAddresses(r *core.InlineResource) []string {
+	var addresses []string
+	for _, f := range r.Fields {
+		if f.Link != "" {
+			parts := strings.SplitN(f.Link, ".", 3)
+			if len(parts) == 3 {
+				addresses = append(addresses, parts[0]+"."+parts[1])
+			}
+		}
+
+		if f.NestedValue != nil {
+			addresses = append(addresses, linkedAddresses(f.NestedValue)...)
+		}
+	}
+	return addresses
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/jmcgill/formation/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// An importer which only declares links
+type linksImporter map[string]string
+
+func (linksImporter) Describe(meta interface{}) ([]*core.Instance, error) {
+	return nil, nil
+}
+
+func (i linksImporter) Links() map[string]string {
+	return i
+}
+
+// An importer which declares no links, and the attributes which hold policies
+type policyImporter []string
+
+func (policyImporter) Describe(meta interface{}) ([]*core.Instance, error) {
+	return nil, nil
+}
+
+func (policyImporter) Links() map[string]string {
+	return nil
+}
+
+func (i policyImporter) PolicyAttributes() []string {
+	return i
+}
+
+var _ = Describe("DependencyTypes", func() {
+	importers := map[string]core.Importer{
+		"aws_ecs_service":                             linksImporter{"service_registries.registry_arn": "aws_service_discovery_service.arn"},
+		"aws_service_discovery_service":               linksImporter{"dns_config.namespace_id": "aws_service_discovery_private_dns_namespace.id"},
+		"aws_service_discovery_private_dns_namespace": linksImporter{},
+		"aws_route53_record":                          linksImporter{},
+		"aws_route53_zone":                            linksImporter{},
+		"aws_security_group":                          linksImporter{},
+		"aws_cloudwatch_metric_alarm":                 linksImporter{},
+		"aws_instance":                                linksImporter{},
+		"aws_iam_instance_profile":                    linksImporter{},
+		"aws_iam_role":                                linksImporter{},
+		"aws_sns_topic":                               linksImporter{},
+		"aws_cloudwatch_event_target":                 linksImporter{},
+		"aws_iam_role_policy":                         policyImporter{"policy"},
+		"aws_elb":                                     linksImporter{},
+	}
+
+	provider := &schema.Provider{
+		ResourcesMap: map[string]*schema.Resource{
+			"aws_route53_record": {
+				Schema: map[string]*schema.Schema{
+					"alias": {
+						Type:     schema.TypeSet,
+						Optional: true,
+						Elem: &schema.Resource{
+							Schema: map[string]*schema.Schema{
+								"zone_id": {Type: schema.TypeString, Required: true},
+							},
+						},
+					},
+				},
+			},
+			"aws_instance": {
+				Schema: map[string]*schema.Schema{
+					"vpc_security_group_ids": {Type: schema.TypeSet, Optional: true, Elem: &schema.Schema{Type: schema.TypeString}},
+					"iam_instance_profile":   {Type: schema.TypeString, Optional: true},
+				},
+			},
+			"aws_cloudwatch_event_target": {
+				Schema: map[string]*schema.Schema{
+					"arn": {Type: schema.TypeString, Required: true},
+				},
+			},
+			"aws_iam_role_policy": {
+				Schema: map[string]*schema.Schema{
+					"policy": {Type: schema.TypeString, Required: true},
+				},
+			},
+			"aws_elb": {
+				Schema: map[string]*schema.Schema{
+					"source_security_group_id": {Type: schema.TypeString, Computed: true},
+				},
+			},
+		},
+	}
+
+	It("should follow declared links transitively", func() {
+		roots := map[string]core.Importer{"aws_ecs_service": importers["aws_ecs_service"]}
+		Expect(DependencyTypes(importers, roots, provider)).To(ContainElement("aws_service_discovery_service"))
+		Expect(DependencyTypes(importers, roots, provider)).To(ContainElement("aws_service_discovery_private_dns_namespace"))
+	})
+
+	It("should follow links inferred from the names of nested attributes", func() {
+		roots := map[string]core.Importer{"aws_route53_record": importers["aws_route53_record"]}
+		Expect(DependencyTypes(importers, roots, provider)).To(ContainElement("aws_route53_zone"))
+	})
+
+	It("should include the types whose IDs and ARNs an attribute is named after", func() {
+		roots := map[string]core.Importer{"aws_instance": importers["aws_instance"]}
+		dependencies := DependencyTypes(importers, roots, provider)
+		Expect(dependencies).To(ContainElement("aws_security_group"))
+		Expect(dependencies).To(ContainElement("aws_iam_instance_profile"))
+		Expect(dependencies).ToNot(ContainElement("aws_sns_topic"))
+		Expect(dependencies).ToNot(ContainElement("aws_iam_role"))
+	})
+
+	It("should not include types whose IDs and ARNs no attribute may hold", func() {
+		roots := map[string]core.Importer{"aws_route53_record": importers["aws_route53_record"]}
+		dependencies := DependencyTypes(importers, roots, provider)
+		Expect(dependencies).ToNot(ContainElement("aws_security_group"))
+		Expect(dependencies).ToNot(ContainElement("aws_sns_topic"))
+	})
+
+	It("should include every type an ARN may identify for attributes which may hold any ARN", func() {
+		for _, resourceType := range []string{"aws_cloudwatch_event_target", "aws_iam_role_policy"} {
+			roots := map[string]core.Importer{resourceType: importers[resourceType]}
+			dependencies := DependencyTypes(importers, roots, provider)
+			Expect(dependencies).To(ContainElement("aws_sns_topic"))
+			Expect(dependencies).To(ContainElement("aws_iam_role"))
+			Expect(dependencies).ToNot(ContainElement("aws_security_group"))
+		}
+	})
+
+	It("should ignore attributes which cannot be configured", func() {
+		roots := map[string]core.Importer{"aws_elb": importers["aws_elb"]}
+		Expect(DependencyTypes(importers, roots, provider)).To(BeEmpty())
+	})
+
+	It("should not include types which nothing may link to", func() {
+		roots := map[string]core.Importer{"aws_ecs_service": importers["aws_ecs_service"]}
+		Expect(DependencyTypes(importers, roots, provider)).ToNot(ContainElement("aws_cloudwatch_metric_alarm"))
+		Expect(DependencyTypes(importers, roots, provider)).ToNot(ContainElement("aws_route53_zone"))
+	})
+
+	It("should include selected types which are also linked to", func() {
+		roots := map[string]core.Importer{
+			"aws_route53_record": importers["aws_route53_record"],
+			"aws_route53_zone":   importers["aws_route53_zone"],
+		}
+		dependencies := DependencyTypes(importers, roots, provider)
+		Expect(dependencies).To(ContainElement("aws_route53_zone"))
+		Expect(dependencies).ToNot(ContainElement("aws_route53_record"))
+	})
+
+	It("should import selected types which are also dependencies with the dependencies", func() {
+		roots := map[string]core.Importer{
+			"aws_ecs_service":               importers["aws_ecs_service"],
+			"aws_service_discovery_service": importers["aws_service_discovery_service"],
+		}
+		dependencies := map[string]core.Importer{"aws_service_discovery_service": importers["aws_service_discovery_service"]}
+		Expect(RootImporters(roots, dependencies)).To(Equal(map[string]core.Importer{"aws_ecs_service": importers["aws_ecs_service"]}))
+	})
+})
+
+var _ = Describe("SelectDependencies", func() {
+	// A resource whose only field links to each of links
+	imported := func(resourceType string, name string, dependency bool, links ...string) *ImportedResource {
+		resource := testResource(resourceType, name, nil)
+		for _, link := range links {
+			resource.Fields.Append(&core.Field{
+				FieldType: core.LIST,
+				Key:       "refs",
+				NestedValue: &core.InlineResource{
+					Fields: []*core.Field{{FieldType: core.SCALAR, Link: link, ScalarValue: core.NewScalarValue("ref", core.TypeString)}},
+				},
+			})
+		}
+		return &ImportedResource{resource: resource, dependency: dependency}
+	}
+
+	addresses := func(allResources map[string][]*ImportedResource) []string {
+		var addresses []string
+		for _, resources := range allResources {
+			for _, importedResource := range resources {
+				addresses = append(addresses, importedResource.resource.Address())
+			}
+		}
+		return addresses
+	}
+
+	It("should keep selected resources and the dependencies they reference, directly or transitively", func() {
+		allResources := map[string][]*ImportedResource{
+			"aws_instance": {imported("aws_instance", "web", false, "aws_subnet.private.id")},
+			"aws_subnet": {
+				imported("aws_subnet", "private", true, "aws_vpc.main.id"),
+				imported("aws_subnet", "public", true, "aws_vpc.main.id"),
+			},
+			"aws_vpc": {
+				imported("aws_vpc", "main", true),
+				imported("aws_vpc", "other", true),
+			},
+		}
+
+		Expect(addresses(SelectDependencies(allResources))).To(ConsistOf("aws_instance.web", "aws_subnet.private", "aws_vpc.main"))
+	})
+
+	It("should keep dependencies referenced by policy documents", func() {
+		instance := imported("aws_iam_role_policy", "web", false)
+		document := testResource("aws_iam_policy_document", "web", nil)
+		document.DataSource = true
+		document.Fields.Append(&core.Field{FieldType: core.SCALAR, Key: "resources", Link: "aws_s3_bucket.logs.arn"})
+		instance.policyDocuments = []*core.Resource{document}
+
+		allResources := map[string][]*ImportedResource{
+			"aws_iam_role_policy": {instance},
+			"aws_s3_bucket":       {imported("aws_s3_bucket", "logs", true)},
+		}
+
+		Expect(addresses(SelectDependencies(allResources))).To(ConsistOf("aws_iam_role_policy.web", "aws_s3_bucket.logs"))
+	})
+})
+
+var _ = Describe("linkedAddresses", func() {
+	It("should find links in nested fields", func() {
+		fields := &core.InlineResource{
+			Fields: []*core.Field{
+				{FieldType: core.SCALAR, Key: "vpc_id", Link: "aws_vpc.main.id"},
+				{FieldType: core.SCALAR, Key: "name"},
+				{
+					FieldType: core.SET,
+					Key:       "ingress",
+					NestedValue: &core.InlineResource{
+						Fields: []*core.Field{
+							{
+								FieldType: core.NESTED,
+								NestedValue: &core.InlineResource{
+									Fields: []*core.Field{{FieldType: core.SCALAR, Key: "security_groups", Link: "aws_security_group.web.id"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		Expect(linkedAddresses(fields)).To(Equal([]string{"aws_vpc.main", "aws_security_group.web"}))
+	})
+
+	It("should ignore links which do not name an attribute", func() {
+		fields := &core.InlineResource{
+			Fields: []*core.Field{{FieldType: core.SCALAR, Key: "vpc_id", Link: "aws_vpc.main"}},
+		}
+		Expect(linkedAddresses(fields)).To(BeEmpty())
+	})
+})
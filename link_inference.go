@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jmcgill/formation/core"
+)
+
+// Most references between AWS resources can be recognised without any help from the importer, either
+// because the value has a distinctive shape (an ARN, or an ID such as sg-1234) or because the attribute is
+// named after the thing it refers to (vpc_id, subnet_ids, role_arn). InferLink uses these clues to propose a
+// link, which is only accepted if exactly one imported resource matches.
+
+// Prefixes of the IDs that EC2 assigns to resources, and the resource type which owns each prefix.
+var idPrefixes = []struct {
+	prefix       string
+	resourceType string
+}{
+	{"eigw-", "aws_egress_only_internet_gateway"},
+	{"eipalloc-", "aws_eip"},
+	{"eni-", "aws_network_interface"},
+	{"i-", "aws_instance"},
+	{"igw-", "aws_internet_gateway"},
+	{"acl-", "aws_network_acl"},
+	{"nat-", "aws_nat_gateway"},
+	{"pcx-", "aws_vpc_peering_connection"},
+	{"rtb-", "aws_route_table"},
+	{"sg-", "aws_security_group"},
+	{"snap-", "aws_ebs_snapshot"},
+	{"subnet-", "aws_subnet"},
+	{"vol-", "aws_ebs_volume"},
+	{"vpc-", "aws_vpc"},
+}
+
+// The resource types which an ARN may refer to, keyed by service and resource type segments (or by service
+// alone, for services whose ARNs have no resource type).
+var arnTypes = map[string][]string{
+	"ecs:cluster":                       {"aws_ecs_cluster"},
+	"ecs:service":                       {"aws_ecs_service"},
+	"ecs:task-definition":               {"aws_ecs_task_definition"},
+	"elasticloadbalancing:loadbalancer": {"aws_alb", "aws_lb", "aws_elb"},
+	"elasticloadbalancing:targetgroup":  {"aws_alb_target_group", "aws_lb_target_group"},
+	"iam:group":                         {"aws_iam_group"},
+	"iam:instance-profile":              {"aws_iam_instance_profile"},
+	"iam:policy":                        {"aws_iam_policy"},
+	"iam:role":                          {"aws_iam_role"},
+	"iam:user":                          {"aws_iam_user"},
+	"kms:key":                           {"aws_kms_key"},
+	"lambda:function":                   {"aws_lambda_function"},
+	"logs:log-group":                    {"aws_cloudwatch_log_group"},
+	"s3":                                {"aws_s3_bucket"},
+	"sns":                               {"aws_sns_topic"},
+	"sqs":                               {"aws_sqs_queue"},
+}
+
+// InferLink proposes the field that value should link to. key is the path to the field within its resource,
+// without any list indexes (e.g. route.gateway_id).
+func InferLink(index FieldIndex, root *core.Resource, key string, value string) (*FieldIndexEntry, bool) {
+	if types, ok := typesForARN(value); ok {
+		// An ARN is unique, so one of a service which is not listed in arnTypes may refer to any type
+		if len(types) == 0 {
+			return findInferredLink(index, root, value, []string{"arn"}, anyType)
+		}
+		return findInferredLink(index, root, value, []string{"arn"}, oneOf(types))
+	}
+
+	for _, p := range idPrefixes {
+		if strings.HasPrefix(value, p.prefix) {
+			return findInferredLink(index, root, value, []string{"id"}, oneOf([]string{p.resourceType}))
+		}
+	}
+
+	name := key[strings.LastIndex(key, ".")+1:]
+	switch {
+	case strings.HasSuffix(name, "_ids"):
+		return findInferredLink(index, root, value, []string{"id"}, namedAfter(strings.TrimSuffix(name, "_ids")))
+	case strings.HasSuffix(name, "_id"):
+		// Some resources expose their ID under a second name, e.g. aws_route53_zone.zone_id
+		return findInferredLink(index, root, value, []string{"id", name}, namedAfter(strings.TrimSuffix(name, "_id")))
+	case strings.HasSuffix(name, "_arn"):
+		return findInferredLink(index, root, value, []string{"arn"}, namedAfter(strings.TrimSuffix(name, "_arn")))
+	}
+
+	return nil, false
+}
+
+// Returns the resource types that an ARN may refer to, or false if value is not an ARN.
+func typesForARN(value string) ([]string, bool) {
+	// arn:partition:service:region:account-id:resource
+	parts := strings.SplitN(value, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return nil, false
+	}
+
+	service, resource := parts[2], parts[5]
+	resourceType := strings.FieldsFunc(resource, func(r rune) bool {
+		return r == '/' || r == ':'
+	})
+
+	if len(resourceType) > 1 {
+		if types, ok := arnTypes[service+":"+resourceType[0]]; ok {
+			return types, true
+		}
+	}
+	return arnTypes[service], true
+}
+
+func anyType(string) bool {
+	return true
+}
+
+func oneOf(types []string) func(string) bool {
+	return func(resourceType string) bool {
+		for _, t := range types {
+			if t == resourceType {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Matches resource types which are named after stem, e.g. aws_security_group for security_group.
+func namedAfter(stem string) func(string) bool {
+	return func(resourceType string) bool {
+		return resourceType == "aws_"+stem || strings.HasSuffix(resourceType, "_"+stem)
+	}
+}
+
+// Find the top level attribute of another resource which holds value. Only resources of a type which matches are
+// considered, and a link is only proposed if exactly one of them holds value.
+func findInferredLink(index FieldIndex, root *core.Resource, value string, attributes []string, matches func(string) bool) (*FieldIndexEntry, bool) {
+	var candidates []*FieldIndexEntry
+	for _, attribute := range attributes {
+		for _, entry := range index[value] {
+			if entry.resource == root || entry.path != entry.resource.Type+"."+attribute || !Linkable(root, entry.resource) {
+				continue
+			}
+			if matches(entry.resource.Type) {
+				candidates = append(candidates, entry)
+			}
+		}
+
+		// Attributes are listed in order of preference
+		if len(candidates) > 0 {
+			break
+		}
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	return nil, false
+}
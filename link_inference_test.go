@@ -0,0 +1,207 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jmcgill/formation/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InferLink", func() {
+	const roleARN = "arn:aws:iam::123456789012:role/web"
+
+	cases := []struct {
+		description string
+		targets     []*core.Resource
+		key         string
+		value       string
+
+		// The reference InferLink should propose, or empty if it should not propose one
+		link string
+	}{
+		{
+			description: "an attribute named after a resource type with _id",
+			targets:     []*core.Resource{testResource("aws_ecs_cluster", "main", map[string]string{"id": "cluster-a"})},
+			key:         "cluster_id",
+			value:       "cluster-a",
+			link:        "aws_ecs_cluster.main.id",
+		},
+		{
+			description: "an _id attribute to the attribute of the same name",
+			targets:     []*core.Resource{testResource("aws_route53_zone", "main", map[string]string{"id": "/hostedzone/Z1", "zone_id": "Z1"})},
+			key:         "zone_id",
+			value:       "Z1",
+			link:        "aws_route53_zone.main.zone_id",
+		},
+		{
+			description: "the elements of an attribute named after a resource type with _ids",
+			targets:     []*core.Resource{testResource("aws_ecs_cluster", "main", map[string]string{"id": "cluster-a"})},
+			key:         "placement.cluster_ids",
+			value:       "cluster-a",
+			link:        "aws_ecs_cluster.main.id",
+		},
+		{
+			description: "an attribute named after a resource type with _arn",
+			targets:     []*core.Resource{testResource("aws_sns_topic", "alerts", map[string]string{"arn": "alerts-topic"})},
+			key:         "topic_arn",
+			value:       "alerts-topic",
+			link:        "aws_sns_topic.alerts.arn",
+		},
+		{
+			description: "no link from an _id attribute to a resource of a type it is not named after",
+			targets:     []*core.Resource{testResource("aws_ecs_cluster", "main", map[string]string{"id": "cluster-a"})},
+			key:         "service_id",
+			value:       "cluster-a",
+		},
+		{
+			description: "an ARN of a service with no known resource types",
+			targets:     []*core.Resource{testResource("aws_dynamodb_table", "jobs", map[string]string{"arn": "arn:aws:dynamodb:us-east-1:123456789012:table/jobs"})},
+			key:         "source",
+			value:       "arn:aws:dynamodb:us-east-1:123456789012:table/jobs",
+			link:        "aws_dynamodb_table.jobs.arn",
+		},
+		{
+			description: "no link from an ARN to a resource of another type",
+			targets:     []*core.Resource{testResource("aws_iam_instance_profile", "web", map[string]string{"arn": roleARN})},
+			key:         "execution",
+			value:       roleARN,
+		},
+		{
+			description: "an ARN in any attribute",
+			targets:     []*core.Resource{testResource("aws_iam_role", "web", map[string]string{"arn": roleARN})},
+			key:         "execution",
+			value:       roleARN,
+			link:        "aws_iam_role.web.arn",
+		},
+		{
+			description: "an ARN to the resource type named by its service and resource type segments",
+			targets: []*core.Resource{
+				testResource("aws_iam_instance_profile", "web", map[string]string{"arn": roleARN}),
+				testResource("aws_iam_role", "web", map[string]string{"arn": roleARN}),
+			},
+			key:   "execution",
+			value: roleARN,
+			link:  "aws_iam_role.web.arn",
+		},
+		{
+			description: "an ARN to the resource type named by its service alone",
+			targets: []*core.Resource{
+				testResource("aws_sqs_queue", "jobs", map[string]string{"arn": "arn:aws:sns:us-east-1:123456789012:jobs"}),
+				testResource("aws_sns_topic", "jobs", map[string]string{"arn": "arn:aws:sns:us-east-1:123456789012:jobs"}),
+			},
+			key:   "target",
+			value: "arn:aws:sns:us-east-1:123456789012:jobs",
+			link:  "aws_sns_topic.jobs.arn",
+		},
+		{
+			description: "an sg- ID to a security group",
+			targets:     []*core.Resource{testResource("aws_security_group", "web", map[string]string{"id": "sg-1234"})},
+			key:         "groups",
+			value:       "sg-1234",
+			link:        "aws_security_group.web.id",
+		},
+		{
+			description: "a subnet- ID to a subnet",
+			targets:     []*core.Resource{testResource("aws_subnet", "private", map[string]string{"id": "subnet-1234"})},
+			key:         "placement",
+			value:       "subnet-1234",
+			link:        "aws_subnet.private.id",
+		},
+		{
+			description: "a vpc- ID to a VPC",
+			targets:     []*core.Resource{testResource("aws_vpc", "main", map[string]string{"id": "vpc-1234"})},
+			key:         "network",
+			value:       "vpc-1234",
+			link:        "aws_vpc.main.id",
+		},
+		{
+			description: "no link from a vpc- ID to a resource which is not a VPC",
+			targets:     []*core.Resource{testResource("aws_vpc_endpoint", "s3", map[string]string{"id": "vpc-1234"})},
+			key:         "network",
+			value:       "vpc-1234",
+		},
+		{
+			description: "no link from an attribute which matches several resource types equally well",
+			targets: []*core.Resource{
+				testResource("aws_iam_group", "admins", map[string]string{"id": "admins"}),
+				testResource("aws_placement_group", "admins", map[string]string{"id": "admins"}),
+			},
+			key:   "group_id",
+			value: "admins",
+		},
+		{
+			description: "no link from an ARN held by several resources of the same type",
+			targets: []*core.Resource{
+				testResource("aws_iam_role", "web", map[string]string{"arn": roleARN}),
+				testResource("aws_iam_role", "web-copy", map[string]string{"arn": roleARN}),
+			},
+			key:   "role_arn",
+			value: roleARN,
+		},
+		{
+			description: "no link to an attribute which is not the ID or ARN",
+			targets:     []*core.Resource{testResource("aws_ecs_cluster", "main", map[string]string{"name": "cluster-a"})},
+			key:         "cluster_id",
+			value:       "cluster-a",
+		},
+		{
+			description: "no link from an attribute with no distinctive name or value",
+			targets:     []*core.Resource{testResource("aws_ecs_cluster", "main", map[string]string{"id": "cluster-a"})},
+			key:         "description",
+			value:       "cluster-a",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		It("should infer "+c.description, func() {
+			root := testResource("aws_instance", "root", map[string]string{c.key: c.value})
+			entry, ok := InferLink(testIndex(append(c.targets, root)...), root, c.key, c.value)
+			if c.link == "" {
+				Expect(ok).To(BeFalse())
+				return
+			}
+
+			Expect(ok).To(BeTrue())
+			Expect(strings.Replace(entry.path, entry.resource.Type, entry.resource.Type+"."+entry.resource.Name, 1)).To(Equal(c.link))
+		})
+	}
+
+	It("should not link a resource to itself", func() {
+		root := testResource("aws_security_group", "web", map[string]string{"id": "sg-1234", "source_security_group_id": "sg-1234"})
+		_, ok := InferLink(testIndex(root), root, "source_security_group_id", "sg-1234")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should not link to a resource in another region", func() {
+		target := testResource("aws_security_group", "web", map[string]string{"id": "sg-1234"})
+		target.Provider = "aws.euw1"
+		root := testResource("aws_instance", "root", map[string]string{"security_groups": "sg-1234"})
+		_, ok := InferLink(testIndex(target, root), root, "security_groups", "sg-1234")
+		Expect(ok).To(BeFalse())
+	})
+})
+
+var _ = Describe("LinkFields", func() {
+	vpc := testResource("aws_vpc", "main", map[string]string{"id": "vpc-1234"})
+	defaultVPC := testResource("aws_default_vpc", "default", map[string]string{"id": "vpc-1234"})
+
+	link := func(links map[string]string) string {
+		root := testResource("aws_security_group", "web", map[string]string{"vpc_id": "vpc-1234"})
+		LinkFields(root, root.Fields, links, testIndex(vpc, defaultVPC, root))
+		return root.Fields.Fields[0].Link
+	}
+
+	It("should infer links which are not declared", func() {
+		Expect(link(nil)).To(Equal("aws_vpc.main.id"))
+	})
+
+	It("should prefer links declared by the importer to inferred links", func() {
+		Expect(link(map[string]string{"vpc_id": "aws_default_vpc.id"})).To(Equal("aws_default_vpc.default.id"))
+	})
+
+	It("should infer a link when the declared link matches nothing", func() {
+		Expect(link(map[string]string{"vpc_id": "aws_vpc_peering_connection.id"})).To(Equal("aws_vpc.main.id"))
+	})
+})
@@ -1,11 +1,12 @@
 package main
 
 import (
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"path/filepath"
+	"sort"
 	"strconv"
 
 	"github.com/jmcgill/formation/aws"
@@ -13,6 +14,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/config/configschema"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
@@ -43,15 +45,17 @@ func MarkComputedFields(r *core.InlineResource, s *configschema.Block) *core.Inl
 			continue
 		}
 
-		if f.FieldType == core.LIST && f.NestedValue.Fields[0].FieldType == core.NESTED {
-			MarkComputedFields(f.NestedValue, &s.BlockTypes[f.Key].Block)
+		isList := f.FieldType == core.LIST || f.FieldType == core.SET
+
+		// Attributes which hold a list of objects have no block in the schema
+		if block, ok := s.BlockTypes[f.Key]; ok && isList {
+			MarkComputedFields(f.NestedValue, &block.Block)
 		}
 
 		// Assume that lists of non-objects are never computed
 		// This is definitely wrong, but I need a case study to work out what this should look like
-		if f.FieldType == core.LIST && f.NestedValue.Fields[0].FieldType != core.NESTED {
+		if isList {
 			continue
-			// MarkComputedFields(f.NestedValue, &s.Attributes[f.Key].Block)
 		}
 
 		if f.FieldType == core.NESTED {
@@ -91,28 +95,29 @@ func DecorateWithDefaultFields(instanceState *terraform.InstanceState, r *core.I
 
 		var defaultValue string
 
-		// TODO(jimmy): Switch to a TYPE enum - can pull this straight out of the schema object
-		isBool := false
-
-		switch v.Default.(type) {
+		switch d := v.Default.(type) {
 		case bool:
-			defaultValue = strconv.FormatBool(v.Default.(bool))
-			isBool = true
+			defaultValue = strconv.FormatBool(d)
+		case int:
+			defaultValue = strconv.Itoa(d)
+		case float64:
+			defaultValue = strconv.FormatFloat(d, 'f', -1, 64)
 		case string:
-			defaultValue = v.Default.(string)
+			defaultValue = d
 		}
 
 		instancePath := AppendToInstancePath(path, key)
 		instanceState.Attributes[instancePath] = defaultValue
 
+		// helper/schema and Formation number their primitive types in the same way
+		valueType := core.ValueType(v.Type)
+
 		field := &core.Field{
-			FieldType: core.SCALAR,
-			Path:      instancePath,
-			Key:       key,
-			ScalarValue: &core.ScalarValue{
-				StringValue: defaultValue,
-				IsBool:      isBool,
-			},
+			FieldType:   core.SCALAR,
+			ValueType:   valueType,
+			Path:        instancePath,
+			Key:         key,
+			ScalarValue: core.NewScalarValue(defaultValue, valueType),
 		}
 		r.Fields = append(r.Fields, field)
 	}
@@ -121,7 +126,7 @@ func DecorateWithDefaultFields(instanceState *terraform.InstanceState, r *core.I
 		instancePath := AppendToInstancePath(path, f.Key)
 
 		// HACK: Assume all resources are nested
-		if f.FieldType == core.LIST && f.NestedValue.Fields[0].FieldType == core.NESTED {
+		if (f.FieldType == core.LIST || f.FieldType == core.SET) && f.NestedValue.Fields[0].FieldType == core.NESTED {
 			// Scalar lists will never have a default value, so we don't need to expand the parent key when
 			// recursing into a list. Instead we will rely on each nested object to do this.
 			DecorateWithDefaultFields(instanceState, f.NestedValue.Fields[0].NestedValue, terraformSchema[f.Key].Elem.(*schema.Resource).Schema, instancePath)
@@ -165,17 +170,22 @@ func IndexFields(resource *core.Resource, r *core.InlineResource, index FieldInd
 			continue
 		}
 
-		if f.FieldType == core.LIST || f.FieldType == core.NESTED {
+		if f.FieldType == core.LIST || f.FieldType == core.SET || f.FieldType == core.NESTED {
 
 			IndexFields(resource, f.NestedValue, index)
 		}
 	}
 }
 
-func FindLink(index FieldIndex, value string, allowedPath string) (*core.Resource, bool) {
+// Resources can only refer to resources managed by the same provider, or to global resources such as IAM roles.
+func Linkable(root *core.Resource, target *core.Resource) bool {
+	return root.Provider == target.Provider || aws.IsGlobal(target.Type)
+}
+
+func FindLink(index FieldIndex, root *core.Resource, value string, allowedPath string) (*core.Resource, bool) {
 	if fields, ok := index[value]; ok {
 		for _, field := range fields {
-			if field.path == allowedPath {
+			if field.path == allowedPath && Linkable(root, field.resource) {
 				return field.resource, true
 			}
 		}
@@ -200,17 +210,27 @@ func RecursivelyLinkFields(root *core.Resource, r *core.InlineResource, links ma
 				z = f.Key
 			}
 
-			// This field _can_ link to another resource
+			// Elements of a list of scalars are linked using the path of the list
+			if f.Key == "" {
+				z = path
+			}
+
+			// Links declared by the importer take precedence over inferred links
 			if allowedPath, ok := links[z]; ok {
-				if resource, ok := FindLink(index, f.ScalarValue.StringValue, allowedPath); ok {
+				if resource, ok := FindLink(index, root, f.ScalarValue.StringValue, allowedPath); ok {
 					// Avoid self links
 					if resource.Name != root.Name {
 						// Substitute in the resource name
-						resolvedPath := strings.Replace(allowedPath, resource.Type, resource.Type+"."+resource.Name, 1)
+						resolvedPath := strings.Replace(allowedPath, resource.Type, resource.Address(), 1)
 						f.Link = resolvedPath
 					}
+					continue
 				}
 			}
+
+			if entry, ok := InferLink(index, root, z, f.ScalarValue.StringValue); ok {
+				f.Link = strings.Replace(entry.path, entry.resource.Type, entry.resource.Address(), 1)
+			}
 			continue
 		}
 
@@ -219,7 +239,7 @@ func RecursivelyLinkFields(root *core.Resource, r *core.InlineResource, links ma
 			continue
 		}
 
-		if f.FieldType == core.LIST {
+		if f.FieldType == core.LIST || f.FieldType == core.SET {
 			var z string
 			if path != "" {
 				z = path + "." + f.Key
@@ -239,6 +259,46 @@ func RecursivelyLinkFields(root *core.Resource, r *core.InlineResource, links ma
 type ImportedResource struct {
 	resource *core.Resource
 	state    *terraform.InstanceState
+	schema   *configschema.Block
+
+	// The ID used to import this resource, as it would be passed to provider.ImportState
+	importID string
+
+	// The state returned by Refresh, before default fields were added to state
+	refreshed *terraform.InstanceState
+
+	// The other resources this resource can reference, as declared by its importer
+	links map[string]string
+
+	// The region this resource was imported from, when importing more than one region
+	region string
+
+	// Whether this resource was only imported because other resources may reference it
+	dependency bool
+
+	// Whether this resource was already in the tfstate file being merged into, and its state there is kept
+	keepExistingState bool
+
+	// The account, partition and region this resource was imported from, if known
+	identity *Identity
+
+	// References to make in place of the account ID, partition and region in values, when templating
+	substitutions []*core.Substitution
+
+	// The attributes of this resource which hold an IAM policy, as declared by its importer
+	policyAttributes []string
+
+	// aws_iam_policy_document data sources for the policies held by this resource
+	policyDocuments []*core.Resource
+
+	// The attributes of the AMIs and VPCs this resource refers to, keyed by ID, which data sources search by
+	lookups map[string]map[string]string
+}
+
+// SetRegion assigns this resource to the aliased provider for region.
+func (r *ImportedResource) SetRegion(region string) {
+	r.region = region
+	r.resource.Provider = "aws." + aws.RegionAlias(region)
 }
 
 func main() {
@@ -248,180 +308,563 @@ func main() {
 	errors := log.New(f, "[ERROR] ", log.Ldate|log.Ltime)
 
 	tfstate := flag.String("tfstate", "", "Path to an existing tfstate file to merge")
+	mergePolicy := flag.String("merge-policy", "overwrite", "What to do with resources which are already in the -tfstate file: keep-existing, overwrite or fail")
 	resourceToImport := flag.String("resource", "", "A specific resource type to import")
-	flag.Parse()
+	exclude := flag.String("exclude", "", "Comma separated list of resource types not to import")
+	ids := flag.String("ids", "", "Comma separated list of the IDs of the resources to import")
+	withDependencies := flag.Bool("with-dependencies", false, "Also import every resource referenced by the selected resources, directly or transitively")
+	policyDocuments := flag.Bool("policy-documents", false, "Write IAM and resource policies as aws_iam_policy_document data sources")
+	template := flag.Bool("template", false, "Replace account IDs, regions and partitions in values with references to the aws_caller_identity, aws_region and aws_partition data sources")
+	dataSources := flag.Bool("data-sources", false, "Refer to AMIs, VPCs and AWS managed IAM policies which were not imported with data sources, rather than by ID")
+	outputFormat := flag.String("output-format", "hcl", "Configuration format to write: hcl (.tf), json (.tf.json) or both (.tf, with .tf.json in a json subdirectory)")
+	syntaxName := flag.String("syntax", "hcl1", "Configuration syntax to generate: hcl1 (Terraform 0.11) or hcl2 (Terraform 0.12+)")
+	stateFormat := flag.String("state-format", "v3", "How to record imported state: v3 or v4 (terraform.tfstate, v4 implies -syntax hcl2) or import (imports.tf, implies -syntax hcl2)")
+	parallelism := flag.Int("parallelism", 16, "Maximum number of concurrent requests to AWS")
+	serviceParallelism := flag.Int("service-parallelism", 4, "Maximum number of concurrent requests to each AWS service")
+	serviceLimits := flag.String("service-limits", "", "Per service overrides for -service-parallelism, e.g. iamconn=2,r53conn=1")
+	checkpointDir := flag.String("checkpoint", ".formation-checkpoint", "Directory in which to checkpoint imported resources. Set to an empty string to disable checkpointing")
+	resume := flag.Bool("resume", false, "Resume an interrupted import from the checkpoint directory")
+	snapshotPath := flag.String("snapshot", "", "When importing, save a snapshot of all imported resources to this file. When rendering, the snapshot to render")
+	regionNames := flag.String("regions", "", "Comma separated list of regions to import, or all. Each region is given its own aliased provider")
+	accountsPath := flag.String("accounts", "", "A YAML file listing accounts to import. Each account is written to its own directory")
+	managed := flag.String("managed", "", "Comma separated list of state files, or directories of state and configuration, whose resources are already managed and should not be imported")
+	configPath := flag.String("config", "", "A YAML file with settings for this run. Flags override settings in the file")
+
+	// The first argument may be a command. Importing from AWS is the default.
+	command := "import"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
 
-	// TODO(jimmy): Bundle these into an object
-	allResources := make(map[string][]*ImportedResource)
+	config := DefaultConfig()
+	if *configPath != "" {
+		config, err = ReadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Error reading configuration %s", err)
+		}
+	}
 
-	// TODO(JIMMY): hide this away in a struct
-	index := make(FieldIndex)
+	// Flags given on the command line take precedence over the configuration file
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "resource":
+			config.Include = strings.Split(*resourceToImport, ",")
+		case "exclude":
+			config.Exclude = strings.Split(*exclude, ",")
+		case "ids":
+			config.Filters.IDs = strings.Split(*ids, ",")
+		case "with-dependencies":
+			config.Dependencies = *withDependencies
+		case "data-sources":
+			config.DataSources = *dataSources
+		case "template":
+			config.Template = *template
+		case "policy-documents":
+			config.PolicyDocuments = *policyDocuments
+		case "output-format":
+			config.Output.Format = *outputFormat
+		case "syntax":
+			config.Syntax = *syntaxName
+		case "state-format":
+			config.StateFormat = *stateFormat
+		case "merge-policy":
+			config.MergePolicy = *mergePolicy
+		case "managed":
+			config.Managed = strings.Split(*managed, ",")
+		case "parallelism":
+			config.Concurrency.Parallelism = *parallelism
+		case "service-parallelism":
+			config.Concurrency.ServiceParallelism = *serviceParallelism
+		case "service-limits":
+			limits, err := parseServiceLimits(*serviceLimits)
+			if err != nil {
+				log.Fatal(err)
+			}
+			config.Concurrency.ServiceLimits = limits
+		case "regions":
+			config.Regions = strings.Split(*regionNames, ",")
+		case "accounts":
+			accounts, err := ReadAccounts(*accountsPath)
+			if err != nil {
+				log.Fatalf("Error reading accounts %s", err)
+			}
+			config.Accounts = accounts
+		}
+	})
 
-	importers := aws.Importers()
+	if err := config.Validate(); err != nil {
+		log.Fatal(err)
+	}
 
-	// Restrict to a specific resource type, if requested
-	if *resourceToImport != "" {
-		i := make(map[string]core.Importer)
-		parts := strings.Split(*resourceToImport, ",")
-		for _, p := range parts {
-			i[p] = importers[p]
-		}
+	syntax, err := core.ParseSyntax(config.Syntax)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		importers = i
+	switch config.StateFormat {
+	case "v4":
+		// Version 4 state can only be read by Terraform 0.12 and later
+		syntax = core.HCL2
+	case "import":
+		// Import blocks were introduced in Terraform 1.5, which cannot parse HCL1
+		syntax = core.HCL2
 	}
 
-	// Configure Terraform Plugin
-	provider := aws2.Provider()
+	policy, err := core.ParseMergePolicy(config.MergePolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// A duplicate Provider which is guaranteed to be configured in the same way as
-	// the AWS probvider above. This is needed so that we can access otherwisr private
-	// fields that are configured during initialization.
-	localProvider := aws.Provider()
-	c := terraform.NewResourceConfig(nil)
-	localProvider.Input(&UIInput{}, c)
+	filter, err := config.Filters.Filter()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	err = localProvider.Configure(c)
+	// Reading managed resources and finding dependencies only needs the provider schema
+	schemaProvider := aws2.Provider().(*schema.Provider)
+	managedResources, err := ReadManagedResources(config.Managed, schemaProvider)
 	if err != nil {
-		panic("Error configuring internal provider")
+		log.Fatalf("Error reading managed resources %s", err)
 	}
-	localSchemaProvider := localProvider.(*schema.Provider)
 
-	c = terraform.NewResourceConfig(nil)
-	provider.Input(&UIInput{}, c)
-	err = provider.Configure(c)
+	allImporters := aws.Importers()
+	importers, err := config.SelectImporters(allImporters)
 	if err != nil {
-		log.Fatalf("Error while configuring provider %s", err)
+		log.Fatal(err)
 	}
 
-	// For each importer
-	for resourceType, importer := range importers {
-		fmt.Printf("*** Importing: %s\n", resourceType)
+	dependencies, err := config.DependencyImporters(allImporters, importers, schemaProvider)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		if _, err := os.Stat(resourceType + ".tf"); err == nil {
-			fmt.Printf("*** Skipping resource\n")
-			continue
+	// Checking links only needs the provider schema, and writes nothing
+	if command == "lint-links" {
+		os.Exit(lintLinks(importers))
+	}
+
+	r := &run{
+		importers:       importers,
+		dependencies:    dependencies,
+		errors:          errors,
+		checkpointDir:   *checkpointDir,
+		resume:          *resume,
+		snapshotPath:    *snapshotPath,
+		filter:          filter,
+		managed:         managedResources,
+		dataSources:     config.DataSources,
+		template:        config.Template,
+		policyDocuments: config.PolicyDocuments,
+		naming:          config.Naming,
+		skipExisting:    config.Output.SkipExisting && config.Output.Layout == "type",
+		syntax:          syntax,
+		layout:          config.Output.Layout,
+		outputFormat:    config.Output.Format,
+		stateFormat:     config.StateFormat,
+		mergePolicy:     policy,
+		ignoreChanges:   config.IgnoreChanges,
+	}
+
+	if config.Output.Dir != "" {
+		if err := os.MkdirAll(config.Output.Dir, 0755); err != nil {
+			log.Fatalf("Error creating output directory %s", err)
 		}
+	}
 
-		instances, err := importer.Describe(localSchemaProvider.Meta())
-		if err != nil {
-			panic(err)
+	switch command {
+	case "import":
+		if *resume && *checkpointDir == "" {
+			log.Fatal("-resume requires a -checkpoint directory")
 		}
+		r.limiter = NewLimiter(config.Concurrency.Parallelism, config.Concurrency.ServiceParallelism, config.Concurrency.ServiceLimits)
 
-		for _, instance := range instances {
-			var instancesToImport []*terraform.InstanceState
-			importViaTerraform := true
+		if len(config.Accounts) == 0 {
+			if err := checkStateFormat(*tfstate, config.StateFormat); err != nil {
+				log.Fatal(err)
+			}
+			r.importAccount(nil, config.Output.Dir, expandRegions(config.Regions), *tfstate)
+			r.exit()
+			return
+		}
 
-			instanceInfo := &terraform.InstanceInfo{
-				// Id is a unique name to represent this instance. This is not related
-				// to InstanceState.ID in any way.
-				Id: instance.ID,
+		if *tfstate != "" {
+			log.Fatal("-tfstate cannot be used with accounts, set tfstate for each account instead")
+		}
 
-				// Type is the resource type of this instance
-				Type: resourceType,
+		// Nothing is imported unless every account can be written
+		for _, account := range config.Accounts {
+			if err := checkStateFormat(account.TFState, config.StateFormat); err != nil {
+				log.Fatal(err)
 			}
+		}
 
-			if patchyImporter, ok := importer.(core.PatchyImporter); ok {
-				instancesToImport, importViaTerraform, err = patchyImporter.Import(instance, localSchemaProvider.Meta())
+		for _, account := range config.Accounts {
+			regions := expandRegions(config.Regions)
+			if len(account.Regions) > 0 {
+				regions = expandRegions(account.Regions)
 			}
 
-			if importViaTerraform {
-				instancesToImport, err = provider.ImportState(instanceInfo, instance.ID)
-				if err != nil {
-					errors.Printf("Error importing instance: %s. Instance will be skipped", err)
-					continue
-				}
+			dir := inDir(config.Output.Dir, account.OutputDir)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				log.Fatalf("Error creating output directory %s", err)
 			}
 
-			for _, instanceToImport := range instancesToImport {
-				instanceState, err := provider.Refresh(instanceInfo, instanceToImport)
-				if err != nil {
-					errors.Printf("Error refreshing Instance State %s. Instance will be skipped", instanceToImport)
-					continue
-					// log.Fatalf("Error refreshing Instance State %s", instanceToImport)
-				}
+			fmt.Printf("*** Importing account: %s\n", account.Name)
+			r.importAccount(account, dir, regions, account.TFState)
+		}
+		r.exit()
 
-				if instanceState == nil {
-					continue
-				}
+	case "render", "verify":
+		if *snapshotPath == "" {
+			log.Fatalf("%s requires a -snapshot to render", command)
+		}
 
-				if patchyImporter, ok := importer.(core.PatchyImporter); ok {
-					instanceState = patchyImporter.Clean(instanceState, localSchemaProvider.Meta())
-				}
+		// Rendering only needs the provider schema, so the provider is never configured
+		provider := aws2.Provider()
+		pipeline := &Pipeline{
+			Provider: provider,
+			Errors:   errors,
+			Filter:   filter,
+			Managed:  managedResources,
+			Naming:   config.Naming,
+
+			IgnoreChanges: config.IgnoreChanges,
+		}
+		if err := checkStateFormat(*tfstate, config.StateFormat); err != nil {
+			log.Fatal(err)
+		}
+		allResources, err := ReadSnapshot(*snapshotPath, pipeline)
+		if err != nil {
+			log.Fatalf("Error reading snapshot %s", err)
+		}
+		// Verifying diffs every rendered resource against its refreshed state, as terraform plan would. Nothing is
+		// written to the output directory, so configuration is rendered to a directory which is removed afterwards.
+		dir := config.Output.Dir
+		if command == "verify" {
+			r.diff = true
+			dir, err = ioutil.TempDir("", "formation-verify")
+			if err != nil {
+				log.Fatalf("Error creating temporary directory %s", err)
+			}
+		}
+		r.write(dir, nil, *tfstate, provider, allResources)
+		if r.diff {
+			os.RemoveAll(dir)
+		}
+		r.exit()
 
-				// Convert this resource from Terraform's internal format to a Formation Resource
-				parser := core.InstanceStateParser{}
-				resource := parser.Parse(instanceState)
+	default:
+		log.Fatalf("Unknown command %s, expected import, render, verify or lint-links", command)
+	}
+}
 
-				/// Fill in name and type
-				resource.Name = instance.Name
-				resource.Type = resourceType
+// Exit with status 1 if any configuration which was written does not match its state, or would change, so that
+// scripts can tell that it needs attention.
+func (r *run) exit() {
+	if r.mismatched > 0 || r.changed > 0 {
+		os.Exit(1)
+	}
+}
 
-				// Get the schema for this resource
-				request := &terraform.ProviderSchemaRequest{
-					ResourceTypes: []string{resourceType},
-				}
-				s, _ := provider.GetSchema(request)
-				resourceSchema := s.ResourceTypes[resourceType]
+// The settings shared by every account imported during one run of Formation.
+type run struct {
+	importers map[string]core.Importer
+	limiter   *Limiter
+	errors    *log.Logger
+
+	// Importers for resources which are only kept if an imported resource references them
+	dependencies map[string]core.Importer
+
+	checkpointDir string
+	resume        bool
+	snapshotPath  string
+
+	filter          *core.Filter
+	managed         *ManagedResources
+	dataSources     bool
+	template        bool
+	policyDocuments bool
+	naming          string
+	skipExisting    bool
+	ignoreChanges   map[string][]string
+
+	syntax       core.Syntax
+	layout       string
+	outputFormat string
+	stateFormat  string
+	mergePolicy  core.MergePolicy
+
+	// Whether to diff the written configuration against the refreshed state, and how many resources would change
+	diff    bool
+	changed int
+
+	// How many resources could not be read back from the written configuration, or read back differently from
+	// their state
+	mismatched int
+}
 
-				if patchyImporter, ok := importer.(core.PatchyImporter); ok {
-					resourceSchema = patchyImporter.AdjustSchema(resourceSchema)
-				}
+// Import every region of an account and write its configuration and state to dir. A nil account uses the
+// credentials in the environment.
+func (r *run) importAccount(account *Account, dir string, regions []string, tfstate string) {
+	var checkpoint *Checkpoint
+	if r.checkpointDir != "" {
+		var err error
+		checkpoint, err = OpenCheckpoint(inDir(dir, r.checkpointDir), r.resume)
+		if err != nil {
+			log.Fatalf("Error opening checkpoint %s", err)
+		}
 
-				// Mark computed fields - we don't want to output these
-				MarkComputedFields(resource.Fields, resourceSchema)
+		// Everything will have been written by the time this returns, so there is nothing left to resume
+		defer checkpoint.Remove()
+	}
 
-				// To get the resource schema we need to poke into the internal implementation of the AWS provider
-				schemaProvider := provider.(*schema.Provider)
-				DecorateWithDefaultFields(instanceState, resource.Fields, schemaProvider.ResourcesMap[resourceType].Schema, "")
+	var provider terraform.ResourceProvider
+	allResources := make(map[string][]*ImportedResource)
 
-				// Store this resource for later
-				allResources[resourceType] = append(allResources[resourceType], &ImportedResource{
-					resource: resource,
-					state:    instanceState,
-				})
+	for i, region := range regions {
+		var localSchemaProvider *schema.Provider
+		provider, localSchemaProvider = configureProviders(account, region)
+
+		pipeline := &Pipeline{
+			Provider:   provider,
+			Meta:       localSchemaProvider.Meta(),
+			Limiter:    r.limiter,
+			Errors:     r.errors,
+			Checkpoint: checkpoint,
+			Region:     region,
+			OutputDir:  dir,
+
+			SkipExisting: r.skipExisting,
+			Filter:       r.filter,
+			Managed:      r.managed,
+			Naming:       r.naming,
+			Identity:     clientIdentity(localSchemaProvider.Meta()),
+			DataSources:  r.dataSources,
+
+			IgnoreChanges: r.ignoreChanges,
+		}
+		for resourceType, resources := range pipeline.Run(regionalImporters(RootImporters(r.importers, r.dependencies), i == 0)) {
+			allResources[resourceType] = append(allResources[resourceType], resources...)
+		}
 
-				// Index this resource
-				IndexFields(resource, resource.Fields, index)
+		if len(r.dependencies) > 0 {
+			// Filters select which resources to start from, so they do not apply to dependencies
+			pipeline.Filter = nil
+			pipeline.Dependency = true
+			pipeline.SelectedTypes = r.importers
+			pipeline.SelectedFilter = r.filter
+			for resourceType, resources := range pipeline.Run(regionalImporters(r.dependencies, i == 0)) {
+				allResources[resourceType] = append(allResources[resourceType], resources...)
 			}
 		}
+	}
 
-		//f, err := os.Create(resourceType + ".tf")
-		//defer f.Close()
-		//
-		//if err != nil {
-		//	log.Fatalf("Error creating file for resource %s\n", resourceType)
-		//}
-
-		//for i, importedResource := range allResources[resourceType] {
-		//	resource := importedResource.resource
-		//
-		//	// TEMP: Disable resource linking
-		//	// LinkFields(resource, resource.Fields, importers[resource.Type].Links(), index)
-		//
-		//	printer := core.Printer{}
-		//	printer.PrintToFile(f, resource)
-		//
-		//	// Space out resources for readability
-		//	if i != len(allResources[resourceType])-1 {
-		//		fmt.Fprint(f, "\n\n")
-		//	}
-		//}
+	if r.snapshotPath != "" {
+		if err := WriteSnapshot(inDir(dir, r.snapshotPath), allResources); err != nil {
+			log.Fatalf("Error writing snapshot %s", err)
+		}
 	}
 
+	r.write(dir, account, tfstate, provider, allResources)
+}
+
+// Global services are imported along with the first region.
+func regionalImporters(importers map[string]core.Importer, first bool) map[string]core.Importer {
+	if first {
+		return importers
+	}
+
+	regional := make(map[string]core.Importer)
+	for resourceType, importer := range importers {
+		if !aws.IsGlobal(resourceType) {
+			regional[resourceType] = importer
+		}
+	}
+	return regional
+}
+
+// Link and print every resource, and write configuration and state to dir.
+func (r *run) write(dir string, account *Account, tfstate string, provider terraform.ResourceProvider, allResources map[string][]*ImportedResource) {
+	RenameDuplicates(allResources)
+
+	// Resources are matched to existing state before they are linked, so that links use their existing names
+	if tfstate != "" && r.stateFormat != "import" {
+		conflicts := planMerge(allResources, tfstate, r.mergePolicy, provider.(*schema.Provider), r.managed.Entries())
+		for _, conflict := range conflicts {
+			fmt.Printf("*** Conflict: %s\n", conflict)
+		}
+
+		if len(conflicts) > 0 && r.mergePolicy == core.FailOnConflict {
+			log.Fatalf("%d imported resources are already in %s", len(conflicts), tfstate)
+		}
+	} else {
+		// Imported resources may not reuse the address of a managed resource
+		imported, importedResources := mergeEntries(allResources)
+		core.ReserveNames(r.managed.Entries(), imported)
+		for i, entry := range imported {
+			importedResources[i].resource.Name = entry.Name
+		}
+	}
+
+	// TODO(JIMMY): hide this away in a struct
+	index := make(FieldIndex)
+
+	// Index every resource. This happens in a stable order so that links are resolved deterministically.
+	for _, resourceType := range SortedTypes(allResources) {
+		for _, importedResource := range allResources[resourceType] {
+			IndexFields(importedResource.resource, importedResource.resource.Fields, index)
+		}
+	}
+
+	// Resources which are already managed can be linked to, but are never written
+	r.managed.Index(index)
+
 	// At this point, all resources have been index
-	for resourceType, resources := range allResources {
-		f, err := os.Create(resourceType + ".tf")
-		defer f.Close()
+	for _, resources := range allResources {
+		for _, importedResource := range resources {
+			resource := importedResource.resource
+			LinkFields(resource, resource.Fields, importedResource.links, index)
+		}
+	}
+
+	if r.policyDocuments {
+		ConvertPolicyDocuments(allResources, index)
+	}
+
+	// Dependencies can only be selected once every link has been resolved
+	if len(r.dependencies) > 0 {
+		allResources = SelectDependencies(allResources)
+	}
+
+	// Anything which is still unlinked may be looked up instead
+	var dataSources []*core.Resource
+	if r.dataSources {
+		dataSources = GenerateDataSources(allResources)
+	}
+	if r.template {
+		dataSources = append(dataSources, TemplateIdentity(allResources, r.syntax)...)
+	}
 
+	var filenames []string
+	if r.outputFormat != "json" {
+		filenames = r.writeConfig(dir, provider, dataSources, allResources)
+	}
+
+	// TODO(jimmy): Pull this out of the terraform Context object
+	tfVersion := "0.11.1"
+	if r.syntax == core.HCL2 {
+		tfVersion = "0.12.0"
+	}
+
+	if r.outputFormat != "json" {
+		writeProviders(dir, account, allResources, r.syntax)
+	}
+
+	// Terraform would see every resource twice if both were written to the same directory
+	if r.outputFormat != "hcl" {
+		jsonDir := dir
+		if r.outputFormat == "both" {
+			jsonDir = filepath.Join(dir, "json")
+			if err := os.MkdirAll(jsonDir, 0755); err != nil {
+				log.Fatalf("Error creating output directory %s", err)
+			}
+		}
+		jsonFilenames := r.writeJSONConfig(jsonDir, account, dataSources, allResources)
+		if r.outputFormat == "json" {
+			filenames = jsonFilenames
+		}
+	}
+
+	// Configuration is checked as Terraform will read it: from the .tf files when they are written, otherwise from
+	// the .tf.json files
+	configs, failed := readConfig(filenames, r.syntax, provider.(*schema.Provider))
+	r.mismatched += verifyConfig(configs, failed, allResources)
+	if r.diff {
+		r.changed += diffConfig(configs, provider.(*schema.Provider), allResources)
+	}
+
+	switch r.stateFormat {
+	case "import":
+		if r.outputFormat != "json" {
+			writeImportBlocks(dir, allResources)
+		}
+	case "v4":
+		writeStateV4(dir, allResources, tfstate, provider.(*schema.Provider))
+	default:
+		writeStateV3(dir, allResources, tfstate, tfVersion)
+	}
+}
+
+// Print every data source and resource as HCL. Resources are written to a file for their type, or to main.tf.
+// Returns the path of every file written.
+func (r *run) writeConfig(dir string, provider terraform.ResourceProvider, dataSources []*core.Resource, allResources map[string][]*ImportedResource) []string {
+	files := make(map[string]*os.File)
+	var paths []string
+	open := func(filename string) *os.File {
+		if r.layout == "single" {
+			filename = "main.tf"
+		}
+
+		f, ok := files[filename]
+		if ok {
+			fmt.Fprint(f, "\n\n")
+			return f
+		}
+
+		path := filepath.Join(dir, filename)
+		f, err := os.Create(path)
 		if err != nil {
-			log.Fatalf("Error creating file for resource %s\n", resourceType)
+			log.Fatalf("Error creating %s\n", filename)
 		}
+		files[filename] = f
+		paths = append(paths, path)
+		return f
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	printDataSource := func(f *os.File, dataSource *core.Resource, substitutions []*core.Substitution) {
+		// Data sources missing from this version of the provider are printed without a schema
+		printer := core.Printer{Syntax: r.syntax, Substitutions: substitutions}
+		if s, ok := provider.(*schema.Provider).DataSourcesMap[dataSource.Type]; ok {
+			printer.Schema = s.CoreConfigSchema()
+		}
+		printer.PrintToFile(f, dataSource)
+	}
+
+	if len(dataSources) > 0 {
+		f := open("data.tf")
+		for i, dataSource := range dataSources {
+			printDataSource(f, dataSource, nil)
+
+			if i != len(dataSources)-1 {
+				fmt.Fprint(f, "\n\n")
+			}
+		}
+	}
+
+	for _, resourceType := range SortedTypes(allResources) {
+		resources := allResources[resourceType]
+		f := open(resourceType + ".tf")
 
 		for i, importedResource := range resources {
-			resource := importedResource.resource
-			LinkFields(resource, resource.Fields, importers[resource.Type].Links(), index)
+			// Policy documents are written alongside the resource they belong to
+			for _, document := range importedResource.policyDocuments {
+				printDataSource(f, document, importedResource.substitutions)
+				fmt.Fprint(f, "\n\n")
+			}
 
-			printer := core.Printer{}
+			resource := importedResource.resource
+			printer := core.Printer{
+				Syntax:        r.syntax,
+				Schema:        importedResource.schema,
+				Substitutions: importedResource.substitutions,
+			}
 			printer.PrintToFile(f, resource)
 
 			// Space out resources for readability
@@ -430,69 +873,276 @@ func main() {
 			}
 		}
 	}
+	return paths
+}
 
-	// Write TFState
-	state := terraform.State{
-		Version: 3,
+// Write every data source, resource and provider as JSON configuration, in the same files as writeConfig and
+// writeProviders but with a .tf.json extension. Returns the path of every file written.
+func (r *run) writeJSONConfig(dir string, account *Account, dataSources []*core.Resource, allResources map[string][]*ImportedResource) []string {
+	configs := make(map[string]*core.JSONConfig)
+	var filenames []string
+	config := func(filename string) *core.JSONConfig {
+		if r.layout == "single" {
+			filename = "main.tf.json"
+		}
 
-		// TODO(jimmy): Pull this out of the terraform Context object
-		TFVersion: "0.11.1",
+		c, ok := configs[filename]
+		if !ok {
+			c = &core.JSONConfig{Syntax: r.syntax}
+			configs[filename] = c
+			filenames = append(filenames, filename)
+		}
+		return c
+	}
 
-		Serial: 1,
+	for _, dataSource := range dataSources {
+		config("data.tf.json").AddResource(dataSource, nil)
+	}
 
-		// TODO(jimmy): Work out how this is generated
-		Lineage: "Formation",
+	for _, resourceType := range SortedTypes(allResources) {
+		c := config(resourceType + ".tf.json")
+		for _, importedResource := range allResources[resourceType] {
+			for _, document := range importedResource.policyDocuments {
+				c.AddResource(document, importedResource.substitutions)
+			}
+			c.AddResource(importedResource.resource, importedResource.substitutions)
+		}
+	}
 
-		Modules: []*terraform.ModuleState{
-			{
-				Path: []string{
-					"root",
-				},
-			},
-		},
+	// Providers and import blocks are always kept in their own files, as they are for HCL
+	providers := &core.JSONConfig{Syntax: r.syntax}
+	for _, fields := range providerConfigs(account, allResources) {
+		providers.AddProvider("aws", fields)
+	}
+	configs["providers.tf.json"] = providers
+	filenames = append(filenames, "providers.tf.json")
+
+	if r.stateFormat == "import" {
+		imports := &core.JSONConfig{Syntax: r.syntax}
+		for _, resourceType := range SortedTypes(allResources) {
+			for _, importedResource := range allResources[resourceType] {
+				imports.AddImport(importedResource.resource, importedResource.importID)
+			}
+		}
+		configs["imports.tf.json"] = imports
+		filenames = append(filenames, "imports.tf.json")
 	}
-	state.Modules[0].Resources = make(map[string]*terraform.ResourceState)
 
-	if *tfstate != "" {
-		contents, err := ioutil.ReadFile(*tfstate)
+	var paths []string
+	for _, filename := range filenames {
+		if configs[filename].Empty() {
+			continue
+		}
+
+		path := filepath.Join(dir, filename)
+		f, err := os.Create(path)
 		if err != nil {
-			log.Fatal("Error reading existing TFState file")
+			log.Fatalf("Error creating %s\n", filename)
 		}
 
-		err = json.Unmarshal(contents, &state)
+		err = configs[filename].PrintToFile(f)
+		f.Close()
 		if err != nil {
-			log.Fatal("Error unmarshaling JSON")
+			log.Fatalf("Error writing %s: %s", filename, err)
 		}
+		paths = append(paths, path)
+	}
+	return paths
+}
 
-		// Clear any resources being imported, in case we've changed the way
-		// their key is constructed
-		if *resourceToImport != "" {
-			for key, _ := range state.Modules[0].Resources {
-				if strings.HasPrefix(key, *resourceToImport) {
-					delete(state.Modules[0].Resources, key)
-				}
-			}
+// Resolve a path relative to an output directory. Absolute paths are left alone.
+func inDir(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Print every link declared by an importer which does not match the provider schema. Returns the exit status.
+func lintLinks(importers map[string]core.Importer) int {
+	problems := aws.LintLinks(importers, aws2.Provider().(*schema.Provider))
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+
+	if len(problems) > 0 {
+		fmt.Printf("%d invalid links\n", len(problems))
+		return 1
+	}
+	return 0
+}
+
+// Expand a list of regions, which may be all. An empty region configures the provider from the environment, as
+// when no regions are given.
+func expandRegions(regions []string) []string {
+	if len(regions) == 0 {
+		return []string{""}
+	}
+
+	if len(regions) == 1 && regions[0] == "all" {
+		return aws.AllRegions()
+	}
+
+	return regions
+}
+
+// Build the configuration for a provider. If region is empty, the region is taken from the environment, and if
+// account is nil so are the credentials.
+func providerConfig(account *Account, region string) *terraform.ResourceConfig {
+	settings := make(map[string]interface{})
+	if account != nil {
+		settings = account.providerSettings()
+	}
+	if region != "" {
+		settings["region"] = region
+	}
+
+	if len(settings) == 0 {
+		return terraform.NewResourceConfig(nil)
+	}
+
+	raw, err := config.NewRawConfig(settings)
+	if err != nil {
+		log.Fatalf("Error building configuration for region %s: %s", region, err)
+	}
+	return terraform.NewResourceConfig(raw)
+}
+
+// Configure the Terraform AWS provider, and a duplicate of it which exposes its internal AWSClient to importers.
+func configureProviders(account *Account, region string) (terraform.ResourceProvider, *schema.Provider) {
+	// Configure Terraform Plugin
+	provider := aws2.Provider()
+
+	// A duplicate Provider which is guaranteed to be configured in the same way as
+	// the AWS probvider above. This is needed so that we can access otherwisr private
+	// fields that are configured during initialization.
+	localProvider := aws.Provider()
+	c := providerConfig(account, region)
+	localProvider.Input(&UIInput{}, c)
+
+	err := localProvider.Configure(c)
+	if err != nil {
+		panic("Error configuring internal provider")
+	}
+	localSchemaProvider := localProvider.(*schema.Provider)
+
+	c = providerConfig(account, region)
+	provider.Input(&UIInput{}, c)
+	err = provider.Configure(c)
+	if err != nil {
+		log.Fatalf("Error while configuring provider %s", err)
+	}
+
+	return provider, localSchemaProvider
+}
+
+// Write an aliased provider block for every region that resources were imported from, with the credentials of
+// account. Nothing is written when only the default provider is used and there is no account.
+func writeProviders(dir string, account *Account, allResources map[string][]*ImportedResource, syntax core.Syntax) {
+	providers := providerConfigs(account, allResources)
+	if len(providers) == 0 {
+		return
+	}
+
+	f, err := os.Create(filepath.Join(dir, "providers.tf"))
+	if err != nil {
+		log.Fatal("Failure to create providers file")
+	}
+	defer f.Close()
+
+	printer := core.Printer{Syntax: syntax}
+	for i, fields := range providers {
+		printer.PrintProviderToFile(f, "aws", fields)
+
+		if i != len(providers)-1 {
+			fmt.Fprint(f, "\n\n")
 		}
 	}
+	fmt.Fprint(f, "\n")
+}
 
+// The configuration of the AWS provider for every region that resources were imported from, in a stable order.
+func providerConfigs(account *Account, allResources map[string][]*ImportedResource) []*core.InlineResource {
+	seen := make(map[string]bool)
+	var regions []string
 	for _, resources := range allResources {
 		for _, importedResource := range resources {
-			resource := importedResource.resource
-			r := &terraform.ResourceState{
-				Type:     resource.Type,
-				Primary:  importedResource.state,
-				Provider: "provider.aws",
+			if importedResource.region != "" && !seen[importedResource.region] {
+				seen[importedResource.region] = true
+				regions = append(regions, importedResource.region)
 			}
-			state.Modules[0].Resources[resource.Type+"."+resource.Name] = r
 		}
 	}
 
-	f, err = os.Create("terraform.tfstate")
+	if len(regions) == 0 && account == nil {
+		return nil
+	}
+	sort.Strings(regions)
+
+	// Resources which were imported using the region from the environment use the default provider
+	if len(regions) == 0 {
+		regions = []string{""}
+	}
+
+	var providers []*core.InlineResource
+	for _, region := range regions {
+		fields := &core.InlineResource{}
+		if region != "" {
+			fields.Append(stringField("alias", aws.RegionAlias(region)))
+			fields.Append(stringField("region", region))
+		}
+		if account != nil {
+			for _, field := range account.providerFields() {
+				fields.Append(field)
+			}
+		}
+		providers = append(providers, fields)
+	}
+	return providers
+}
+
+// Write an import block for every imported resource, so that Terraform can adopt them during plan.
+func writeImportBlocks(dir string, allResources map[string][]*ImportedResource) {
+	f, err := os.Create(filepath.Join(dir, "imports.tf"))
 	if err != nil {
-		log.Fatal("Failure to create TFState file")
+		log.Fatal("Failure to create imports file")
 	}
 	defer f.Close()
 
-	j, _ := json.MarshalIndent(state, "", "    ")
-	f.Write(j)
+	// Sort by type so that the output is stable between runs
+	resourceTypes := SortedTypes(allResources)
+
+	printer := core.Printer{}
+	for i, resourceType := range resourceTypes {
+		for j, importedResource := range allResources[resourceType] {
+			printer.PrintImportToFile(f, importedResource.resource, importedResource.importID)
+
+			if i != len(resourceTypes)-1 || j != len(allResources[resourceType])-1 {
+				fmt.Fprint(f, "\n\n")
+			}
+		}
+	}
+	fmt.Fprint(f, "\n")
+}
+
+// Parse a comma separated list of service=limit pairs.
+func parseServiceLimits(value string) (map[string]int, error) {
+	limits := make(map[string]int)
+	if value == "" {
+		return limits, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid service limit %s, expected service=limit", pair)
+		}
+
+		limit, err := strconv.Atoi(parts[1])
+		if err != nil || limit < 1 {
+			return nil, fmt.Errorf("invalid service limit %s, expected a positive integer", pair)
+		}
+		limits[parts[0]] = limit
+	}
+	return limits, nil
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/jmcgill/formation/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFormation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Formation Suite")
+}
+
+// A resource with a top level scalar field for each attribute, in the same shape as one parsed from state.
+func testResource(resourceType string, name string, attributes map[string]string) *core.Resource {
+	resource := &core.Resource{
+		Type:   resourceType,
+		Name:   name,
+		Fields: &core.InlineResource{},
+	}
+
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		resource.Fields.Append(&core.Field{
+			FieldType:   core.SCALAR,
+			Key:         key,
+			Path:        key,
+			ScalarValue: core.NewScalarValue(attributes[key], core.TypeString),
+		})
+	}
+	return resource
+}
+
+func testIndex(resources ...*core.Resource) FieldIndex {
+	index := make(FieldIndex)
+	for _, resource := range resources {
+		IndexResource(resource, index)
+	}
+	return index
+}
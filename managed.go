@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/hashicorp/hcl2/hclparse"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/jmcgill/formation/core"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ManagedResources are resources which are already managed by Terraform, and are never imported again. Imported
+// resources can still link to them, using their existing addresses.
+//
+// They are read from state files, configuration files, or directories containing either. Configuration
+// only identifies a resource if it contains an import block for it, because resource blocks do not record IDs.
+// The addresses of resource blocks are still reserved, so that no imported resource is given the same address.
+type ManagedResources struct {
+	// Keyed by type and ID
+	ids map[string]bool
+
+	// The resources in the root module, which can be linked to. Only their top level attributes are known.
+	resources []*core.Resource
+
+	// The addresses of resource blocks in the root module, keyed by type and name
+	blocks map[string]*core.MergeEntry
+}
+
+func ReadManagedResources(paths []string, provider *schema.Provider) (*ManagedResources, error) {
+	m := &ManagedResources{
+		ids:    make(map[string]bool),
+		blocks: make(map[string]*core.MergeEntry),
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		found := len(m.ids) + len(m.blocks)
+		if !info.IsDir() {
+			if filepath.Ext(path) == ".tf" {
+				err = m.readConfiguration(path)
+			} else {
+				err = m.readState(path, provider)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", path, err)
+			}
+		} else {
+			states, _ := filepath.Glob(filepath.Join(path, "*.tfstate"))
+			for _, state := range states {
+				if err := m.readState(state, provider); err != nil {
+					return nil, fmt.Errorf("%s: %s", state, err)
+				}
+			}
+
+			configs, _ := filepath.Glob(filepath.Join(path, "*.tf"))
+			for _, config := range configs {
+				if err := m.readConfiguration(config); err != nil {
+					return nil, fmt.Errorf("%s: %s", config, err)
+				}
+			}
+		}
+
+		if len(m.ids)+len(m.blocks) == found {
+			fmt.Printf("*** Warning: %s does not contain any managed resources\n", path)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *ManagedResources) readState(path string, provider *schema.Provider) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	state, err := readStateV4(contents, provider)
+	if err != nil {
+		return err
+	}
+	state.SortResources()
+
+	for _, r := range state.Resources {
+		if r.Mode != "managed" {
+			continue
+		}
+
+		for _, instance := range r.Instances {
+			if instance.Deposed != "" {
+				continue
+			}
+
+			id, _ := instance.Attributes["id"].(string)
+			m.add(r.Type, instanceName(r.Name, instance.IndexKey), providerAlias(r.Provider), id, instance.Attributes, r.Module == "")
+		}
+	}
+	return nil
+}
+
+// Import blocks (Terraform 1.5+) record both the address and the ID of a resource, e.g.
+//
+//	import {
+//	  to = aws_vpc.main
+//	  id = "vpc-1234"
+//	}
+//
+// Resource blocks only record the address.
+func (m *ManagedResources) readConfiguration(path string) error {
+	file, diags := hclparse.NewParser().ParseHCLFile(path)
+	if diags.HasErrors() {
+		return diags
+	}
+
+	content, _, diags := file.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "import"},
+			{Type: "resource", LabelNames: []string{"type", "name"}},
+		},
+	})
+	if diags.HasErrors() {
+		return diags
+	}
+
+	for _, block := range content.Blocks {
+		if block.Type == "resource" {
+			m.blocks[block.Labels[0]+"."+block.Labels[1]] = &core.MergeEntry{Type: block.Labels[0], Name: block.Labels[1]}
+			continue
+		}
+
+		attributes, diags := block.Body.JustAttributes()
+		if diags.HasErrors() {
+			return diags
+		}
+
+		to, ok := attributes["to"]
+		if !ok {
+			continue
+		}
+		id, ok := attributes["id"]
+		if !ok {
+			continue
+		}
+
+		traversal, diags := traversalForExpr(to.Expr)
+		if diags.HasErrors() {
+			return diags
+		}
+
+		value, diags := id.Expr.Value(nil)
+		if diags.HasErrors() || value.Type() != cty.String || !value.IsKnown() {
+			continue
+		}
+
+		resourceType, name, inModule := resourceAddress(traversal)
+		if resourceType == "" {
+			continue
+		}
+
+		var alias string
+		if provider, ok := attributes["provider"]; ok {
+			if t, diags := hcl.AbsTraversalForExpr(provider.Expr); !diags.HasErrors() && len(t) == 2 {
+				if attr, ok := t[1].(hcl.TraverseAttr); ok {
+					alias = attr.Name
+				}
+			}
+		}
+
+		// Resources in modules cannot be referred to from outside that module
+		m.add(resourceType, name, alias, value.AsString(), map[string]interface{}{"id": value.AsString()}, !inModule)
+	}
+	return nil
+}
+
+// The vendored parser only reads numeric indexes as part of a traversal, so string keys (e.g. the key of a
+// for_each instance, or of a module called with for_each) split the expression, and are joined back up here.
+func traversalForExpr(expr hcl.Expression) (hcl.Traversal, hcl.Diagnostics) {
+	switch e := expr.(type) {
+	case *hclsyntax.IndexExpr:
+		traversal, diags := traversalForExpr(e.Collection)
+		key, keyDiags := e.Key.Value(nil)
+		diags = append(diags, keyDiags...)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		return append(traversal, hcl.TraverseIndex{Key: key}), nil
+	case *hclsyntax.RelativeTraversalExpr:
+		traversal, diags := traversalForExpr(e.Source)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		return append(traversal, e.Traversal...), nil
+	}
+	return hcl.AbsTraversalForExpr(expr)
+}
+
+// The type and name of the resource a traversal refers to, e.g. aws_vpc.main, aws_instance.web[0] or
+// module.network.aws_vpc.main, and whether that resource is in a module.
+func resourceAddress(traversal hcl.Traversal) (string, string, bool) {
+	var names []string
+	var index interface{}
+	inModule := false
+	for _, step := range traversal {
+		switch s := step.(type) {
+		case hcl.TraverseRoot:
+			names = append(names, s.Name)
+		case hcl.TraverseAttr:
+			names = append(names, s.Name)
+		case hcl.TraverseIndex:
+			if s.Key.Type() == cty.String {
+				index = s.Key.AsString()
+			} else if s.Key.Type() == cty.Number {
+				i, _ := s.Key.AsBigFloat().Int64()
+				index = i
+			}
+		}
+
+		// Skip past module.<name>[index]
+		if len(names) == 2 && names[0] == "module" {
+			names = nil
+			inModule = true
+		}
+		if len(names) == 0 {
+			index = nil
+		}
+	}
+
+	if len(names) != 2 {
+		return "", "", inModule
+	}
+	return names[0], instanceName(names[1], index), inModule
+}
+
+// The name of an instance of a resource created with count or for_each includes its index, e.g. web[0]
+func instanceName(name string, indexKey interface{}) string {
+	switch key := indexKey.(type) {
+	case nil:
+		return name
+	case string:
+		return name + "[" + strconv.Quote(key) + "]"
+	case json.Number:
+		return name + "[" + key.String() + "]"
+	default:
+		return fmt.Sprintf("%s[%v]", name, key)
+	}
+}
+
+func (m *ManagedResources) add(resourceType string, name string, alias string, id string, attributes map[string]interface{}, linkable bool) {
+	if id == "" || m.ids[resourceType+"."+id] {
+		return
+	}
+	m.ids[resourceType+"."+id] = true
+
+	if !linkable {
+		return
+	}
+
+	resource := &core.Resource{
+		Type:   resourceType,
+		Name:   name,
+		Fields: &core.InlineResource{},
+	}
+	if alias != "" {
+		resource.Provider = "aws." + alias
+	}
+
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Links only ever refer to top level attributes
+	for _, key := range keys {
+		switch value := attributes[key].(type) {
+		case string, bool, json.Number, float64:
+			resource.Fields.Append(&core.Field{
+				FieldType:   core.SCALAR,
+				ValueType:   core.TypeString,
+				Key:         key,
+				Path:        key,
+				ScalarValue: core.NewScalarValue(fmt.Sprint(value), core.TypeString),
+			})
+		}
+	}
+
+	m.resources = append(m.resources, resource)
+}
+
+// Contains returns true if a resource of resourceType with any of ids is already managed.
+func (m *ManagedResources) Contains(resourceType string, ids ...string) bool {
+	if m == nil {
+		return false
+	}
+
+	for _, id := range ids {
+		if m.ids[resourceType+"."+id] {
+			return true
+		}
+	}
+	return false
+}
+
+// Index adds managed resources to index, so that imported resources can link to them.
+func (m *ManagedResources) Index(index FieldIndex) {
+	if m == nil {
+		return
+	}
+
+	for _, resource := range m.resources {
+		IndexFields(resource, resource.Fields, index)
+	}
+}
+
+// Entries returns the address of every managed resource which imported resources must not reuse.
+func (m *ManagedResources) Entries() []*core.MergeEntry {
+	if m == nil {
+		return nil
+	}
+
+	entries := make([]*core.MergeEntry, 0, len(m.resources)+len(m.blocks))
+	for _, resource := range m.resources {
+		entries = append(entries, &core.MergeEntry{Type: resource.Type, Name: resource.Name})
+	}
+
+	addresses := make([]string, 0, len(m.blocks))
+	for address := range m.blocks {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		entries = append(entries, m.blocks[address])
+	}
+	return entries
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl2/hcl"
+	"github.com/hashicorp/hcl2/hcl/hclsyntax"
+	"github.com/jmcgill/formation/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ReadManagedResources", func() {
+	tempDir := func() string {
+		dir, err := ioutil.TempDir("", "managed")
+		Expect(err).ShouldNot(HaveOccurred())
+		return dir
+	}
+
+	write := func(dir string, name string, contents string) string {
+		path := filepath.Join(dir, name)
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).ShouldNot(HaveOccurred())
+		return path
+	}
+
+	addresses := func(m *ManagedResources) []string {
+		var addresses []string
+		for _, entry := range m.Entries() {
+			addresses = append(addresses, entry.Type+"."+entry.Name)
+		}
+		return addresses
+	}
+
+	It("should read managed resources from state", func() {
+		dir := tempDir()
+		defer os.RemoveAll(dir)
+
+		path := write(dir, "terraform.tfstate", `{
+  "version": 4,
+  "terraform_version": "0.12.0",
+  "serial": 1,
+  "lineage": "test",
+  "outputs": {},
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "aws_vpc",
+      "name": "main",
+      "provider": "provider.aws",
+      "instances": [{"schema_version": 1, "attributes": {"id": "vpc-1234", "cidr_block": "10.0.0.0/16"}}]
+    },
+    {
+      "mode": "managed",
+      "type": "aws_subnet",
+      "name": "private",
+      "each": "map",
+      "provider": "provider.aws.use1",
+      "instances": [{"index_key": "a", "schema_version": 1, "attributes": {"id": "subnet-a"}}]
+    },
+    {
+      "module": "module.network",
+      "mode": "managed",
+      "type": "aws_vpc",
+      "name": "inner",
+      "provider": "provider.aws",
+      "instances": [{"schema_version": 1, "attributes": {"id": "vpc-5678"}}]
+    },
+    {
+      "mode": "data",
+      "type": "aws_vpc",
+      "name": "default",
+      "provider": "provider.aws",
+      "instances": [{"schema_version": 0, "attributes": {"id": "vpc-9999"}}]
+    }
+  ]
+}`)
+
+		m, err := ReadManagedResources([]string{path}, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(m.Contains("aws_vpc", "vpc-1234")).To(BeTrue())
+		Expect(m.Contains("aws_subnet", "subnet-a")).To(BeTrue())
+		Expect(m.Contains("aws_vpc", "vpc-5678")).To(BeTrue())
+		Expect(m.Contains("aws_vpc", "vpc-9999")).To(BeFalse())
+
+		// Resources in modules cannot be linked to, so do not take an address
+		Expect(addresses(m)).To(Equal([]string{"aws_subnet.private[\"a\"]", "aws_vpc.main"}))
+	})
+
+	It("should read import blocks and reserve the addresses of resource blocks", func() {
+		dir := tempDir()
+		defer os.RemoveAll(dir)
+
+		write(dir, "main.tf", `
+resource "aws_vpc" "main" {
+  cidr_block = "10.0.0.0/16"
+}
+
+resource "aws_subnet" "private" {
+  for_each = toset(["a", "b"])
+  vpc_id   = aws_vpc.main.id
+}
+
+import {
+  to = aws_vpc.main
+  id = "vpc-1234"
+}
+
+import {
+  to       = aws_subnet.private["a"]
+  id       = "subnet-a"
+  provider = aws.use1
+}
+
+import {
+  to = module.network["east"].aws_vpc.inner
+  id = "vpc-5678"
+}
+`)
+
+		m, err := ReadManagedResources([]string{dir}, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(m.Contains("aws_vpc", "vpc-1234")).To(BeTrue())
+		Expect(m.Contains("aws_subnet", "subnet-a")).To(BeTrue())
+		Expect(m.Contains("aws_vpc", "vpc-5678")).To(BeTrue())
+		Expect(addresses(m)).To(ConsistOf("aws_vpc.main", "aws_subnet.private[\"a\"]", "aws_subnet.private", "aws_vpc.main"))
+	})
+
+	It("should reserve the addresses of configuration without state or import blocks", func() {
+		dir := tempDir()
+		defer os.RemoveAll(dir)
+
+		write(dir, "main.tf", `
+resource "aws_vpc" "main" {
+  cidr_block = "10.0.0.0/16"
+}
+`)
+
+		m, err := ReadManagedResources([]string{dir}, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		imported := []*core.MergeEntry{{Type: "aws_vpc", Name: "main"}}
+		core.ReserveNames(m.Entries(), imported)
+		Expect(imported[0].Name).To(Equal("main-2"))
+	})
+
+	It("should accept a path which holds no managed resources", func() {
+		dir := tempDir()
+		defer os.RemoveAll(dir)
+
+		m, err := ReadManagedResources([]string{dir}, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(m.Entries()).To(BeEmpty())
+	})
+})
+
+var _ = Describe("resourceAddress", func() {
+	cases := []struct {
+		expression string
+		address    string
+		inModule   bool
+	}{
+		{`aws_vpc.main`, "aws_vpc.main", false},
+		{`aws_instance.web[0]`, "aws_instance.web[0]", false},
+		{`aws_instance.web["a"]`, `aws_instance.web["a"]`, false},
+		{`module.network.aws_vpc.main`, "aws_vpc.main", true},
+		{`module.network[0].aws_vpc.main`, "aws_vpc.main", true},
+		{`module.network["east"].aws_vpc.main`, "aws_vpc.main", true},
+		{`module.network["east"].aws_vpc.main["a"]`, `aws_vpc.main["a"]`, true},
+		{`module.network["east"].module.subnets[1].aws_subnet.private[2]`, "aws_subnet.private[2]", true},
+		{`aws_vpc`, "", false},
+		{`module.network`, "", true},
+	}
+
+	for _, c := range cases {
+		c := c
+		It("should find the resource "+c.expression+" refers to", func() {
+			expr, diags := hclsyntax.ParseExpression([]byte(c.expression), "", hcl.Pos{Line: 1, Column: 1})
+			Expect(diags.HasErrors()).To(BeFalse())
+
+			traversal, diags := traversalForExpr(expr)
+			Expect(diags.HasErrors()).To(BeFalse())
+
+			resourceType, name, inModule := resourceAddress(traversal)
+			address := ""
+			if resourceType != "" {
+				address = resourceType + "." + name
+			}
+			Expect(address).To(Equal(c.address))
+			Expect(inModule).To(Equal(c.inModule))
+		})
+	}
+})
+
+var _ = Describe("instanceName", func() {
+	It("should add the index of a resource created with count or for_each", func() {
+		Expect(instanceName("web", nil)).To(Equal("web"))
+		Expect(instanceName("web", "a")).To(Equal(`web["a"]`))
+		Expect(instanceName("web", `quoted "key"`)).To(Equal(`web["quoted \"key\""]`))
+		Expect(instanceName("web", json.Number("2"))).To(Equal("web[2]"))
+		Expect(instanceName("web", int64(3))).To(Equal("web[3]"))
+	})
+})
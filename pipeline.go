@@ -0,0 +1,540 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/jmcgill/formation/aws"
+	"github.com/jmcgill/formation/core"
+)
+
+// Limiter bounds the number of concurrent requests made to AWS, both in total and for each AWS service.
+type Limiter struct {
+	global     chan struct{}
+	perService int
+	overrides  map[string]int
+
+	mu       sync.Mutex
+	services map[string]chan struct{}
+}
+
+// NewLimiter creates a Limiter. overrides replaces perService for specific services, keyed by the name of the
+// connection in AWSClient (e.g. ec2conn).
+func NewLimiter(global int, perService int, overrides map[string]int) *Limiter {
+	return &Limiter{
+		global:     make(chan struct{}, global),
+		perService: perService,
+		overrides:  overrides,
+		services:   make(map[string]chan struct{}),
+	}
+}
+
+func (l *Limiter) service(name string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.services[name]; !ok {
+		limit := l.perService
+		if override, ok := l.overrides[name]; ok {
+			limit = override
+		}
+		l.services[name] = make(chan struct{}, limit)
+	}
+	return l.services[name]
+}
+
+// Acquire blocks until a request can be made to the given service.
+func (l *Limiter) Acquire(service string) {
+	// Wait for the service first, so that a busy service does not hold global slots that other services could use
+	l.service(service) <- struct{}{}
+	l.global <- struct{}{}
+}
+
+// Release marks a request to the given service as complete.
+func (l *Limiter) Release(service string) {
+	<-l.global
+	<-l.service(service)
+}
+
+// Pipeline discovers, imports and refreshes resources concurrently.
+type Pipeline struct {
+	Provider terraform.ResourceProvider
+
+	// Meta from the local copy of the AWS provider, passed to importers
+	Meta interface{}
+
+	Limiter *Limiter
+	Errors  *log.Logger
+
+	// Optional. When set, every refreshed instance is saved to the checkpoint, and instances which are already
+	// in the checkpoint are not imported again.
+	Checkpoint *Checkpoint
+
+	// Optional. The region that Provider is configured for, when importing more than one region. Resources are
+	// assigned to an aliased provider for this region.
+	Region string
+
+	// Optional. The directory that configuration is written to.
+	OutputDir string
+
+	// Skip resource types which already have configuration in OutputDir
+	SkipExisting bool
+
+	// Optional. Only instances which match the filter are imported.
+	Filter *core.Filter
+
+	// Optional. Instances which are already managed by Terraform are not imported.
+	Managed *ManagedResources
+
+	// How resources are named: name (the default) or id
+	Naming string
+
+	// Resources imported by this pipeline are dependencies, which are only kept if another resource references them
+	Dependency bool
+
+	// Optional. When importing dependencies, the resource types which were also selected directly, and the filter
+	// which selected them. Resources of these types which match the filter are kept whether or not they are
+	// referenced.
+	SelectedTypes  map[string]core.Importer
+	SelectedFilter *core.Filter
+
+	// Optional. The account, partition and region that Provider imports from.
+	Identity *Identity
+
+	// Optional. Attributes to ignore changes to, by resource type, as well as those declared by each importer.
+	IgnoreChanges map[string][]string
+
+	// Describe the AMIs and VPCs which resources refer to, so that data sources can look them up without their IDs
+	DataSources bool
+
+	// The attributes of every value described so far, or nil for values which could not be described
+	lookupsMu sync.Mutex
+	lookups   map[string]map[string]string
+}
+
+// Run imports every instance of every resource type in importers. Within each resource type, resources are
+// returned in the order they were described, no matter how the work was scheduled.
+func (p *Pipeline) Run(importers map[string]core.Importer) map[string][]*ImportedResource {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	// Results are stored by position so that the output is deterministic
+	results := make(map[string][][]*ImportedResource)
+
+	for resourceType, importer := range importers {
+		if p.SkipExisting {
+			if existingConfig(p.OutputDir, resourceType) {
+				fmt.Printf("*** Skipping: %s\n", resourceType)
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(resourceType string, importer core.Importer) {
+			defer wg.Done()
+
+			instances := p.describe(resourceType, importer)
+
+			mu.Lock()
+			results[resourceType] = make([][]*ImportedResource, len(instances))
+			mu.Unlock()
+
+			for i, instance := range instances {
+				wg.Add(1)
+				go func(i int, instance *core.Instance) {
+					defer wg.Done()
+
+					imported := p.importInstance(resourceType, importer, instance)
+
+					mu.Lock()
+					results[resourceType][i] = imported
+					mu.Unlock()
+				}(i, instance)
+			}
+		}(resourceType, importer)
+	}
+
+	wg.Wait()
+
+	allResources := make(map[string][]*ImportedResource)
+	for resourceType, instances := range results {
+		for _, imported := range instances {
+			allResources[resourceType] = append(allResources[resourceType], imported...)
+		}
+	}
+	return allResources
+}
+
+// Returns true if dir already has configuration for resourceType, in either format.
+func existingConfig(dir string, resourceType string) bool {
+	for _, extension := range []string{".tf", ".tf.json"} {
+		if _, err := os.Stat(filepath.Join(dir, resourceType+extension)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Call f while holding a slot for the service that serves resourceType, retrying if AWS throttles the request.
+func (p *Pipeline) call(resourceType string, f func() (interface{}, error)) (interface{}, error) {
+	service := aws.Service(resourceType)
+	p.Limiter.Acquire(service)
+	defer p.Limiter.Release(service)
+
+	return aws.RetryOnThrottling(f)
+}
+
+func (p *Pipeline) describe(resourceType string, importer core.Importer) []*core.Instance {
+	fmt.Printf("*** Importing: %s\n", resourceType)
+
+	instances, err := p.call(resourceType, func() (interface{}, error) {
+		return importer.Describe(p.Meta)
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return instances.([]*core.Instance)
+}
+
+func (p *Pipeline) importInstance(resourceType string, importer core.Importer, instance *core.Instance) []*ImportedResource {
+	if !p.Filter.MatchesInstance(instance) {
+		return nil
+	}
+
+	if p.Managed.Contains(resourceType, instance.ID, instance.Key()) {
+		fmt.Printf("*** Already managed: %s %s\n", resourceType, instance.Key())
+		return nil
+	}
+
+	// The same instance key may be discovered in more than one region
+	key := instance.Key()
+	if p.Region != "" {
+		key = p.Region + "/" + key
+	}
+
+	// Instances which were imported by a previous, interrupted run are taken from the checkpoint
+	if p.Checkpoint != nil {
+		if entry, ok := p.Checkpoint.Get(resourceType, key); ok {
+			return p.process(resourceType, importer, instance, entry.States)
+		}
+	}
+
+	states, ok := p.refresh(resourceType, importer, instance)
+	if !ok {
+		return nil
+	}
+
+	if p.Checkpoint != nil {
+		err := p.Checkpoint.Save(&CheckpointEntry{
+			Type:   resourceType,
+			Name:   instance.Name,
+			Key:    key,
+			States: states,
+		})
+		if err != nil {
+			p.Errors.Printf("Error writing checkpoint for %s.%s: %s", resourceType, instance.Name, err)
+		}
+	}
+
+	return p.process(resourceType, importer, instance, states)
+}
+
+// Import and refresh a single instance. Returns false if the instance could not be imported.
+func (p *Pipeline) refresh(resourceType string, importer core.Importer, instance *core.Instance) ([]*CheckpointState, bool) {
+	var instancesToImport []*terraform.InstanceState
+	var states []*CheckpointState
+	var err error
+	importViaTerraform := true
+
+	instanceInfo := &terraform.InstanceInfo{
+		// Id is a unique name to represent this instance. This is not related
+		// to InstanceState.ID in any way.
+		Id: instance.ID,
+
+		// Type is the resource type of this instance
+		Type: resourceType,
+	}
+
+	if patchyImporter, ok := importer.(core.PatchyImporter); ok {
+		var result interface{}
+		result, err = p.call(resourceType, func() (interface{}, error) {
+			states, viaTerraform, err := patchyImporter.Import(instance, p.Meta)
+			importViaTerraform = viaTerraform
+			return states, err
+		})
+		instancesToImport, _ = result.([]*terraform.InstanceState)
+
+		if err != nil && !importViaTerraform {
+			p.Errors.Printf("Error importing instance: %s. Instance will be skipped", err)
+			return nil, false
+		}
+	}
+
+	if importViaTerraform {
+		result, err := p.call(resourceType, func() (interface{}, error) {
+			return p.Provider.ImportState(instanceInfo, instance.ID)
+		})
+		if err != nil {
+			p.Errors.Printf("Error importing instance: %s. Instance will be skipped", err)
+			return nil, false
+		}
+		instancesToImport = result.([]*terraform.InstanceState)
+	}
+
+	for _, instanceToImport := range instancesToImport {
+		// Resources which Terraform cannot import natively are identified by the state built
+		// by their PatchyImporter. Native imports may also return other resources alongside the one
+		// imported (e.g. the rules of a security group), which are identified by their own ID.
+		importID := instance.ID
+		if !importViaTerraform || (instanceToImport.Ephemeral.Type != "" && instanceToImport.Ephemeral.Type != resourceType) {
+			importID = instanceToImport.ID
+		}
+
+		result, err := p.call(resourceType, func() (interface{}, error) {
+			return p.Provider.Refresh(instanceInfo, instanceToImport)
+		})
+		if err != nil {
+			p.Errors.Printf("Error refreshing Instance State %s. Instance will be skipped", instanceToImport)
+			continue
+		}
+
+		instanceState, _ := result.(*terraform.InstanceState)
+		if instanceState == nil {
+			continue
+		}
+
+		if patchyImporter, ok := importer.(core.PatchyImporter); ok {
+			instanceState = patchyImporter.Clean(instanceState, p.Meta)
+		}
+
+		states = append(states, &CheckpointState{
+			ImportID: importID,
+			State:    instanceState,
+		})
+	}
+
+	return states, true
+}
+
+// Convert refreshed InstanceStates into Formation Resources.
+func (p *Pipeline) process(resourceType string, importer core.Importer, instance *core.Instance, states []*CheckpointState) []*ImportedResource {
+	var imported []*ImportedResource
+
+	links := map[string]string{}
+	if importer != nil {
+		links = importer.Links()
+	}
+
+	for _, state := range states {
+		if !p.Filter.MatchesState(instance, state.State) {
+			continue
+		}
+
+		// Importers which describe instances by something other than their ID are only checked once refreshed
+		if p.Managed.Contains(resourceType, state.State.ID) {
+			fmt.Printf("*** Already managed: %s %s\n", resourceType, state.State.ID)
+			continue
+		}
+
+		// Keep an unmodified copy of the refreshed state, as default fields are added to instanceState below
+		refreshed := state.State.DeepCopy()
+		instanceState := state.State
+
+		// Get the schema for this resource
+		request := &terraform.ProviderSchemaRequest{
+			ResourceTypes: []string{resourceType},
+		}
+		s, _ := p.Provider.GetSchema(request)
+		resourceSchema := s.ResourceTypes[resourceType]
+
+		if patchyImporter, ok := importer.(core.PatchyImporter); ok {
+			resourceSchema = patchyImporter.AdjustSchema(resourceSchema)
+		}
+
+		// Convert this resource from Terraform's internal format to a Formation Resource
+		parser := core.InstanceStateParser{Schema: resourceSchema}
+		resource := parser.Parse(instanceState)
+
+		/// Fill in name and type
+		resource.Name = p.resourceName(instance)
+		resource.Type = resourceType
+
+		// Mark computed fields - we don't want to output these
+		MarkComputedFields(resource.Fields, resourceSchema)
+
+		// To get the resource schema we need to poke into the internal implementation of the AWS provider
+		schemaProvider := p.Provider.(*schema.Provider)
+		DecorateWithDefaultFields(instanceState, resource.Fields, schemaProvider.ResourcesMap[resourceType].Schema, "")
+
+		var policyAttributes []string
+		if policyImporter, ok := importer.(core.PolicyImporter); ok {
+			policyAttributes = policyImporter.PolicyAttributes()
+		}
+		resource.IgnoreChanges = p.ignoreChanges(resourceType, importer)
+
+		// Dependencies of a type which was also selected directly may have been selected themselves
+		dependency := p.Dependency
+		if _, ok := p.SelectedTypes[resourceType]; ok && dependency {
+			dependency = !p.SelectedFilter.MatchesInstance(instance) || !p.SelectedFilter.MatchesState(instance, state.State)
+		}
+
+		importedResource := &ImportedResource{
+			resource:         resource,
+			state:            instanceState,
+			schema:           resourceSchema,
+			importID:         state.ImportID,
+			refreshed:        refreshed,
+			links:            links,
+			dependency:       dependency,
+			identity:         p.Identity,
+			policyAttributes: policyAttributes,
+		}
+		if p.DataSources && p.Meta != nil {
+			importedResource.lookups = p.lookup(importedResource)
+		}
+		if p.Region != "" {
+			// Buckets are listed once for every region, but they and everything in them belong to the bucket's region
+			region := p.Region
+			if aws.HasOwnRegion(resourceType) {
+				region = p.ownRegion(resourceType, refreshed)
+			}
+			importedResource.SetRegion(region)
+		}
+		imported = append(imported, importedResource)
+	}
+
+	return imported
+}
+
+// Describe every value in importedResource which a data source may look up, so that the data source can search by
+// its attributes rather than by value. Values which cannot be described are left out, and looked up by value.
+func (p *Pipeline) lookup(importedResource *ImportedResource) map[string]map[string]string {
+	lookups := make(map[string]map[string]string)
+	visit := func(f *core.Field, kind *dataSourceKind) {
+		value := f.ScalarValue.StringValue
+		if kind.describe == nil || lookups[value] != nil {
+			return
+		}
+		if attributes, ok := p.describeValue(kind, value); ok {
+			lookups[value] = attributes
+		}
+	}
+
+	walkDataSourceValues(importedResource, importedResource.resource.Fields, "", visit)
+	if len(lookups) == 0 {
+		return nil
+	}
+	return lookups
+}
+
+// Describe value, at most once for each pipeline.
+func (p *Pipeline) describeValue(kind *dataSourceKind, value string) (map[string]string, bool) {
+	p.lookupsMu.Lock()
+	attributes, ok := p.lookups[value]
+	p.lookupsMu.Unlock()
+	if ok {
+		return attributes, attributes != nil
+	}
+
+	result, err := p.call(kind.resourceType, func() (interface{}, error) {
+		return kind.describe(p.Meta, value)
+	})
+	if err != nil {
+		p.Errors.Printf("Error describing %s: %s. It will be looked up by ID", value, err)
+	}
+	attributes, _ = result.(map[string]string)
+
+	// Failures are remembered too, so that each value is only described once
+	p.lookupsMu.Lock()
+	if p.lookups == nil {
+		p.lookups = make(map[string]map[string]string)
+	}
+	p.lookups[value] = attributes
+	p.lookupsMu.Unlock()
+	return attributes, attributes != nil
+}
+
+// The region that a resource of a type which has its own region belongs to, or the region of the pipeline if it
+// cannot be found.
+func (p *Pipeline) ownRegion(resourceType string, state *terraform.InstanceState) string {
+	if region := state.Attributes["region"]; region != "" {
+		return region
+	}
+	if p.Meta == nil {
+		return p.Region
+	}
+
+	result, err := p.call(resourceType, func() (interface{}, error) {
+		return aws.ResourceRegion(p.Meta, resourceType, state.Attributes)
+	})
+	if err != nil {
+		p.Errors.Printf("Error finding the region of %s %s: %s. It will be assigned to %s", resourceType, state.ID, err, p.Region)
+		return p.Region
+	}
+	return result.(string)
+}
+
+// The attributes of a resource type to ignore changes to, declared by its importer and then by the configuration
+// file, without repeats.
+func (p *Pipeline) ignoreChanges(resourceType string, importer core.Importer) []string {
+	var attributes []string
+	if ignoringImporter, ok := importer.(core.IgnoreChangesImporter); ok {
+		attributes = append(attributes, ignoringImporter.IgnoreChanges()...)
+	}
+	attributes = append(attributes, p.IgnoreChanges[resourceType]...)
+
+	var ignoreChanges []string
+	seen := make(map[string]bool)
+	for _, attribute := range attributes {
+		if !seen[attribute] {
+			seen[attribute] = true
+			ignoreChanges = append(ignoreChanges, attribute)
+		}
+	}
+	return ignoreChanges
+}
+
+// The name of the resource for an instance, according to the naming strategy of the pipeline.
+func (p *Pipeline) resourceName(instance *core.Instance) string {
+	if p.Naming == "id" {
+		if instance.ID != "" {
+			return core.Format(instance.ID)
+		}
+		return core.Format(instance.Key())
+	}
+	return instance.Name
+}
+
+// SortedTypes returns the resource types in allResources in a stable order.
+func SortedTypes(allResources map[string][]*ImportedResource) []string {
+	resourceTypes := make([]string, 0, len(allResources))
+	for resourceType := range allResources {
+		resourceTypes = append(resourceTypes, resourceType)
+	}
+	sort.Strings(resourceTypes)
+	return resourceTypes
+}
+
+// Regional imports with the same name as each other are renamed after their region, so that every resource
+// has a unique address.
+func RenameDuplicates(allResources map[string][]*ImportedResource) {
+	for _, resources := range allResources {
+		count := make(map[string]int)
+		for _, importedResource := range resources {
+			count[importedResource.resource.Name]++
+		}
+
+		for _, importedResource := range resources {
+			if count[importedResource.resource.Name] > 1 && importedResource.region != "" {
+				importedResource.resource.Name += "-" + aws.RegionAlias(importedResource.region)
+			}
+		}
+	}
+}
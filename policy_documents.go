@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/jmcgill/formation/core"
+)
+
+// With -policy-documents, attributes which hold an IAM policy (as declared by importers which implement
+// core.PolicyImporter) are written as aws_iam_policy_document data sources, and refer to the json attribute of that
+// data source. Policies which the data source cannot express are left as they are.
+
+// ConvertPolicyDocuments creates a data source for every policy attribute which can be converted, and links the
+// principals and resources in each policy to other resources where it can. Every resource must already be in index.
+func ConvertPolicyDocuments(allResources map[string][]*ImportedResource, index FieldIndex) {
+	names := make(map[string]bool)
+	for _, resourceType := range SortedTypes(allResources) {
+		for _, importedResource := range allResources[resourceType] {
+			resource := importedResource.resource
+			for _, attribute := range importedResource.policyAttributes {
+				field := topLevelField(resource.Fields, attribute)
+				if field == nil || field.FieldType != core.SCALAR || field.Link != "" {
+					continue
+				}
+
+				fields, ok := core.ParsePolicyDocument(field.ScalarValue.StringValue)
+				if !ok {
+					continue
+				}
+
+				// e.g. deploy for a policy, or deploy-assume-role-policy for the trust policy of a role
+				base := resource.Name
+				if attribute != "policy" {
+					base += "-" + strings.Replace(attribute, "_", "-", -1)
+				}
+				name := base
+				for i := 2; names[name]; i++ {
+					name = base + "-" + strconv.Itoa(i)
+				}
+				names[name] = true
+
+				document := &core.Resource{
+					Type:       "aws_iam_policy_document",
+					Name:       name,
+					Provider:   resource.Provider,
+					DataSource: true,
+					Fields:     fields,
+				}
+
+				// Linking on behalf of the resource prevents a policy from referring to the resource it belongs to
+				// (e.g. a bucket policy naming its own bucket), which would be a cycle
+				LinkFields(resource, document.Fields, map[string]string{}, index)
+
+				field.Link = document.Address() + ".json"
+				importedResource.policyDocuments = append(importedResource.policyDocuments, document)
+			}
+		}
+	}
+}
+
+func topLevelField(r *core.InlineResource, key string) *core.Field {
+	for _, f := range r.Fields {
+		if f.Key == key {
+			return f
+		}
+	}
+	return nil
+}
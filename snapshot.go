@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/jmcgill/formation/aws"
+	"github.com/jmcgill/formation/core"
+)
+
+const snapshotVersion = 1
+
+// Snapshot stores everything needed to render configuration and state for a set of imported resources, so
+// that output can be regenerated without access to AWS.
+type Snapshot struct {
+	Version   int                 `json:"version"`
+	Resources []*SnapshotResource `json:"resources"`
+}
+
+type SnapshotResource struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	ImportID string `json:"import_id"`
+
+	// The InstanceState returned by Refresh, before any default fields were added
+	State *terraform.InstanceState `json:"state"`
+
+	// The links declared by the importer for this type at the time the snapshot was taken
+	Links map[string]string `json:"links"`
+
+	// The region the resource was imported from, when more than one region was imported
+	Region string `json:"region,omitempty"`
+
+	// The account, partition and region the resource was imported from. Missing from older snapshots.
+	Identity *Identity `json:"identity,omitempty"`
+
+	// The attributes of the AMIs and VPCs the resource refers to, when imported with -data-sources
+	Lookups map[string]map[string]string `json:"lookups,omitempty"`
+}
+
+// WriteSnapshot saves all imported resources to path, in a stable order.
+func WriteSnapshot(path string, allResources map[string][]*ImportedResource) error {
+	snapshot := &Snapshot{
+		Version:   snapshotVersion,
+		Resources: make([]*SnapshotResource, 0),
+	}
+
+	for _, resourceType := range SortedTypes(allResources) {
+		for _, importedResource := range allResources[resourceType] {
+			snapshot.Resources = append(snapshot.Resources, &SnapshotResource{
+				Type:     resourceType,
+				Name:     importedResource.resource.Name,
+				ImportID: importedResource.importID,
+				State:    importedResource.refreshed,
+				Links:    importedResource.links,
+				Region:   importedResource.region,
+				Identity: importedResource.identity,
+				Lookups:  importedResource.lookups,
+			})
+		}
+	}
+
+	contents, err := json.MarshalIndent(snapshot, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, contents, 0644)
+}
+
+// ReadSnapshot loads the resources in a snapshot, and converts them to Formation resources using the
+// provider schema in the same way as a live import.
+func ReadSnapshot(path string, p *Pipeline) (map[string][]*ImportedResource, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{}
+	if err := json.Unmarshal(contents, snapshot); err != nil {
+		return nil, err
+	}
+
+	importers := aws.Importers()
+	resourcesMap := p.Provider.(*schema.Provider).ResourcesMap
+	allResources := make(map[string][]*ImportedResource)
+	for _, r := range snapshot.Resources {
+		// Snapshots taken by another version of Formation may hold types this version cannot import
+		if _, ok := importers[r.Type]; !ok {
+			return nil, fmt.Errorf("%s.%s: there is no importer for %s", r.Type, r.Name, r.Type)
+		}
+		if _, ok := resourcesMap[r.Type]; !ok {
+			return nil, fmt.Errorf("%s.%s: the AWS provider does not support %s", r.Type, r.Name, r.Type)
+		}
+
+		instance := &core.Instance{Name: r.Name, ID: r.ImportID}
+		if !p.Filter.MatchesInstance(instance) {
+			continue
+		}
+
+		states := []*CheckpointState{
+			{ImportID: r.ImportID, State: r.State},
+		}
+
+		for _, importedResource := range p.process(r.Type, importers[r.Type], instance, states) {
+			importedResource.links = r.Links
+			importedResource.identity = r.Identity
+			importedResource.lookups = r.Lookups
+			if r.Region != "" {
+				importedResource.SetRegion(r.Region)
+			}
+			allResources[r.Type] = append(allResources[r.Type], importedResource)
+		}
+	}
+
+	return allResources, nil
+}
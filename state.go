@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/config/configschema"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/jmcgill/formation/core"
+)
+
+// Version 3 state cannot hold the resources of version 4 state, so an existing tfstate file in the version 4 format
+// can only be merged into by writing version 4 state. Returns an error if stateFormat would write version 3 state.
+func checkStateFormat(tfstate string, stateFormat string) error {
+	if tfstate == "" || stateFormat == "v4" || stateFormat == "import" {
+		return nil
+	}
+
+	contents, err := ioutil.ReadFile(tfstate)
+	if err != nil {
+		return err
+	}
+
+	version, err := stateVersion(contents)
+	if err != nil {
+		return fmt.Errorf("%s: %s", tfstate, err)
+	}
+	if version >= 4 {
+		return fmt.Errorf("%s is version %d state, which cannot be merged into version 3 state. Pass -state-format v4 to merge into it", tfstate, version)
+	}
+	return nil
+}
+
+// The version of a state file, read from its header.
+func stateVersion(contents []byte) (int, error) {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(contents, &header); err != nil {
+		return 0, err
+	}
+	return header.Version, nil
+}
+
+// Write all imported resources to terraform.tfstate in dir using the version 3 (Terraform 0.11) format. If an
+// existing tfstate file is provided, resources are merged into it. It must not be version 4 state.
+func writeStateV3(dir string, allResources map[string][]*ImportedResource, tfstate string, tfVersion string) {
+	state := terraform.State{
+		Version: 3,
+
+		TFVersion: tfVersion,
+
+		Serial: 1,
+
+		Lineage: core.NewLineage(),
+
+		Modules: []*terraform.ModuleState{
+			{
+				Path: []string{
+					"root",
+				},
+			},
+		},
+	}
+	state.Modules[0].Resources = make(map[string]*terraform.ResourceState)
+
+	if tfstate != "" {
+		contents, err := ioutil.ReadFile(tfstate)
+		if err != nil {
+			log.Fatal("Error reading existing TFState file")
+		}
+
+		// Resources would be silently dropped from version 4 state, rather than merged into
+		if version, err := stateVersion(contents); err == nil && version >= 4 {
+			log.Fatalf("%s is version %d state, which cannot be merged into version 3 state", tfstate, version)
+		}
+
+		// The existing lineage is kept, so that Terraform accepts this file as a successor of the existing state
+		err = json.Unmarshal(contents, &state)
+		if err != nil {
+			log.Fatal("Error unmarshaling JSON")
+		}
+		state.Serial++
+	}
+
+	for _, resources := range allResources {
+		for _, importedResource := range resources {
+			if importedResource.keepExistingState {
+				continue
+			}
+
+			resource := importedResource.resource
+			r := &terraform.ResourceState{
+				Type:     resource.Type,
+				Primary:  importedResource.state,
+				Provider: providerAddress(resource),
+			}
+			state.Modules[0].Resources[resource.Type+"."+resource.Name] = r
+		}
+	}
+
+	f, err := os.Create(filepath.Join(dir, "terraform.tfstate"))
+	if err != nil {
+		log.Fatal("Failure to create TFState file")
+	}
+	defer f.Close()
+
+	j, _ := json.MarshalIndent(&state, "", "    ")
+	f.Write(j)
+}
+
+// Write all imported resources to terraform.tfstate in dir using the version 4 (Terraform 0.12+) format. If an
+// existing tfstate file is provided, resources are merged into it. Existing version 3 files are upgraded.
+func writeStateV4(dir string, allResources map[string][]*ImportedResource, tfstate string, provider *schema.Provider) {
+	state := &core.StateV4{
+		Version:          4,
+		TerraformVersion: "0.12.0",
+		Serial:           1,
+		Lineage:          core.NewLineage(),
+		Outputs:          make(map[string]json.RawMessage),
+	}
+
+	if tfstate != "" {
+		contents, err := ioutil.ReadFile(tfstate)
+		if err != nil {
+			log.Fatal("Error reading existing TFState file")
+		}
+
+		existing, err := readStateV4(contents, provider)
+		if err != nil {
+			log.Fatalf("Error reading existing TFState file: %s", err)
+		}
+
+		// The existing lineage is kept, so that Terraform accepts this file as a successor of the existing state
+		state = existing
+		state.Serial++
+	}
+
+	for _, resources := range allResources {
+		for _, importedResource := range resources {
+			if importedResource.keepExistingState {
+				continue
+			}
+
+			resource := importedResource.resource
+
+			// Replace any existing resource with the same address
+			for i, r := range state.Resources {
+				if r.Mode == "managed" && r.Type == resource.Type && r.Name == resource.Name && r.Module == "" {
+					state.Resources = append(state.Resources[:i], state.Resources[i+1:]...)
+					break
+				}
+			}
+
+			state.Resources = append(state.Resources, &core.ResourceStateV4{
+				Mode:     "managed",
+				Type:     resource.Type,
+				Name:     resource.Name,
+				Provider: providerAddress(resource),
+				Instances: []*core.InstanceStateV4{
+					instanceStateV4(resource.Type, importedResource.state, provider),
+				},
+			})
+		}
+	}
+	state.SortResources()
+
+	f, err := os.Create(filepath.Join(dir, "terraform.tfstate"))
+	if err != nil {
+		log.Fatal("Failure to create TFState file")
+	}
+	defer f.Close()
+
+	j, _ := json.MarshalIndent(state, "", "    ")
+	f.Write(j)
+}
+
+// Match imported resources to the resources in an existing tfstate file, and give them the same names. Names in
+// taken are never given to an imported resource. Returns every imported resource which was already in that state.
+func planMerge(allResources map[string][]*ImportedResource, tfstate string, policy core.MergePolicy, provider *schema.Provider, taken []*core.MergeEntry) []*core.MergeConflict {
+	contents, err := ioutil.ReadFile(tfstate)
+	if err != nil {
+		log.Fatal("Error reading existing TFState file")
+	}
+
+	state, err := readStateV4(contents, provider)
+	if err != nil {
+		log.Fatalf("Error reading existing TFState file: %s", err)
+	}
+
+	// Resources upgraded from version 3 state are in no particular order
+	state.SortResources()
+
+	var existing []*core.MergeEntry
+	for _, r := range state.Resources {
+		if r.Mode != "managed" || r.Module != "" {
+			continue
+		}
+
+		// Resources created with count or for_each cannot be matched, but their names are still taken
+		entry := &core.MergeEntry{Type: r.Type, Name: r.Name, ProviderAlias: providerAlias(r.Provider)}
+		if r.EachMode == "" && len(r.Instances) == 1 {
+			entry.ID, _ = r.Instances[0].Attributes["id"].(string)
+		}
+		existing = append(existing, entry)
+	}
+
+	// Entries without an ID only reserve their name
+	existing = append(existing, taken...)
+
+	imported, importedResources := mergeEntries(allResources)
+	conflicts := core.PlanMerge(existing, imported, policy)
+	for i, entry := range imported {
+		importedResources[i].resource.Name = entry.Name
+		importedResources[i].keepExistingState = !entry.WriteState
+	}
+	return conflicts
+}
+
+// A MergeEntry for every imported resource, in a stable order.
+func mergeEntries(allResources map[string][]*ImportedResource) ([]*core.MergeEntry, []*ImportedResource) {
+	var imported []*core.MergeEntry
+	var importedResources []*ImportedResource
+	for _, resourceType := range SortedTypes(allResources) {
+		for _, importedResource := range allResources[resourceType] {
+			imported = append(imported, &core.MergeEntry{
+				Type:          resourceType,
+				Name:          importedResource.resource.Name,
+				ID:            importedResource.state.ID,
+				ProviderAlias: providerAlias(providerAddress(importedResource.resource)),
+			})
+			importedResources = append(importedResources, importedResource)
+		}
+	}
+	return imported, importedResources
+}
+
+// The address of the provider configuration which manages a resource, e.g. provider.aws.use1
+func providerAddress(resource *core.Resource) string {
+	if resource.Provider == "" {
+		return "provider.aws"
+	}
+	return "provider." + resource.Provider
+}
+
+// The alias in a provider address, which is either provider.aws.alias (Terraform 0.12 and earlier) or
+// provider["registry.terraform.io/hashicorp/aws"].alias. Empty for the default provider.
+func providerAlias(address string) string {
+	if i := strings.LastIndex(address, "]"); i != -1 {
+		return strings.TrimPrefix(address[i+1:], ".")
+	}
+
+	parts := strings.SplitN(address, ".", 3)
+	if len(parts) == 3 {
+		return parts[2]
+	}
+	return ""
+}
+
+// Convert a flatmap InstanceState into a typed version 4 instance, using the provider schema for its type.
+func instanceStateV4(resourceType string, in *terraform.InstanceState, provider *schema.Provider) *core.InstanceStateV4 {
+	var resourceSchema *configschema.Block
+	var schemaVersion uint64
+	if r, ok := provider.ResourcesMap[resourceType]; ok {
+		resourceSchema = r.CoreConfigSchema()
+		schemaVersion = uint64(r.SchemaVersion)
+	} else {
+		resourceSchema = &configschema.Block{}
+	}
+
+	attributes := core.AttributesFromFlatmap(in.Attributes, resourceSchema)
+	attributes["id"] = in.ID
+
+	instance := &core.InstanceStateV4{
+		SchemaVersion: schemaVersion,
+		Attributes:    attributes,
+	}
+
+	// Provider private data (e.g. timeouts) is stored as JSON in version 4 state
+	if len(in.Meta) > 0 {
+		if v, ok := in.Meta["schema_version"].(string); ok {
+			if version, err := strconv.ParseUint(v, 10, 64); err == nil {
+				instance.SchemaVersion = version
+			}
+		}
+		instance.Private, _ = json.Marshal(in.Meta)
+	}
+
+	return instance
+}
+
+// Read an existing state file, upgrading it to version 4 if required.
+func readStateV4(contents []byte, provider *schema.Provider) (*core.StateV4, error) {
+	version, err := stateVersion(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if version >= 4 {
+		// Numbers are preserved exactly, rather than being converted to float64
+		decoder := json.NewDecoder(bytes.NewReader(contents))
+		decoder.UseNumber()
+
+		state := &core.StateV4{}
+		if err := decoder.Decode(state); err != nil {
+			return nil, err
+		}
+		if state.Outputs == nil {
+			state.Outputs = make(map[string]json.RawMessage)
+		}
+		return state, nil
+	}
+
+	var old terraform.State
+	if err := json.Unmarshal(contents, &old); err != nil {
+		return nil, err
+	}
+
+	state := &core.StateV4{
+		Version:          4,
+		TerraformVersion: "0.12.0",
+		Serial:           uint64(old.Serial),
+		Lineage:          old.Lineage,
+		Outputs:          make(map[string]json.RawMessage),
+	}
+
+	// Only resources in the root module are upgraded. Formation never writes to any other module.
+	for _, module := range old.Modules {
+		if !module.IsRoot() {
+			continue
+		}
+
+		for key, r := range module.Resources {
+			if r.Primary == nil {
+				continue
+			}
+
+			mode := "managed"
+			key = strings.TrimPrefix(key, r.Type+".")
+			if strings.HasPrefix(key, "data.") {
+				mode = "data"
+				key = strings.TrimPrefix(key, "data."+r.Type+".")
+			}
+
+			// Resources created with count have their index appended to their name
+			var indexKey interface{}
+			if parts := strings.Split(key, "."); len(parts) == 2 {
+				if index, err := strconv.Atoi(parts[1]); err == nil {
+					key = parts[0]
+					indexKey = index
+				}
+			}
+
+			instance := instanceStateV4(r.Type, r.Primary, provider)
+			instance.IndexKey = indexKey
+			instance.Dependencies = r.Dependencies
+
+			existing := findResourceStateV4(state, mode, r.Type, key)
+			if existing == nil {
+				existing = &core.ResourceStateV4{
+					Mode:     mode,
+					Type:     r.Type,
+					Name:     key,
+					Provider: r.Provider,
+				}
+				if indexKey != nil {
+					existing.EachMode = "list"
+				}
+				state.Resources = append(state.Resources, existing)
+			}
+			existing.Instances = append(existing.Instances, instance)
+		}
+	}
+
+	return state, nil
+}
+
+func findResourceStateV4(state *core.StateV4, mode string, resourceType string, name string) *core.ResourceStateV4 {
+	for _, r := range state.Resources {
+		if r.Mode == mode && r.Type == resourceType && r.Name == name && r.Module == "" {
+			return r
+		}
+	}
+	return nil
+}
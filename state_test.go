@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("checkStateFormat", func() {
+	write := func(contents string) (string, string) {
+		dir, err := ioutil.TempDir("", "state")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		path := filepath.Join(dir, "terraform.tfstate")
+		Expect(ioutil.WriteFile(path, []byte(contents), 0644)).ShouldNot(HaveOccurred())
+		return dir, path
+	}
+
+	It("should refuse to merge version 4 state into version 3 state", func() {
+		dir, path := write(`{"version": 4, "lineage": "test", "serial": 3, "resources": []}`)
+		defer os.RemoveAll(dir)
+
+		Expect(checkStateFormat(path, "v3")).Should(HaveOccurred())
+		Expect(checkStateFormat(path, "")).Should(HaveOccurred())
+		Expect(checkStateFormat(path, "v4")).ShouldNot(HaveOccurred())
+		Expect(checkStateFormat(path, "import")).ShouldNot(HaveOccurred())
+	})
+
+	It("should merge version 3 state in either format", func() {
+		dir, path := write(`{"version": 3, "lineage": "test", "serial": 3, "modules": []}`)
+		defer os.RemoveAll(dir)
+
+		Expect(checkStateFormat(path, "v3")).ShouldNot(HaveOccurred())
+		Expect(checkStateFormat(path, "v4")).ShouldNot(HaveOccurred())
+	})
+
+	It("should accept any format without existing state", func() {
+		Expect(checkStateFormat("", "v3")).ShouldNot(HaveOccurred())
+	})
+})
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jmcgill/formation/aws"
+	"github.com/jmcgill/formation/core"
+)
+
+// With -template, the account ID, region and partition that resources were imported from are replaced in values
+// with references to the aws_caller_identity, aws_region and aws_partition data sources, so that the same
+// configuration can be applied to other accounts (e.g. both staging and production).
+
+// Identity is the account, partition and region that resources are imported from.
+type Identity struct {
+	AccountID string `json:"account_id,omitempty"`
+	Partition string `json:"partition,omitempty"`
+	Region    string `json:"region,omitempty"`
+}
+
+// The identity of the AWSClient used by importers.
+func clientIdentity(meta interface{}) *Identity {
+	client, ok := meta.(*aws.AWSClient)
+	if !ok {
+		return nil
+	}
+
+	return &Identity{
+		AccountID: client.AccountID(),
+		Partition: client.Partition(),
+		Region:    client.Region(),
+	}
+}
+
+// A substitution which may be made for part of an Identity, and the data source it refers to.
+type identitySubstitution struct {
+	substitution   *core.Substitution
+	dataSourceType string
+	attribute      string
+}
+
+func identitySubstitutions(identity *Identity) []*identitySubstitution {
+	var substitutions []*identitySubstitution
+	if identity.AccountID != "" {
+		substitutions = append(substitutions, &identitySubstitution{
+			substitution:   &core.Substitution{Literal: identity.AccountID},
+			dataSourceType: "aws_caller_identity",
+			attribute:      "account_id",
+		})
+	}
+
+	if identity.Region != "" {
+		substitutions = append(substitutions, &identitySubstitution{
+			substitution:   &core.Substitution{Literal: identity.Region},
+			dataSourceType: "aws_region",
+			attribute:      "name",
+		})
+	}
+
+	// The partition (e.g. aws) is too short to replace anywhere but inside an ARN
+	if identity.Partition != "" {
+		substitutions = append(substitutions, &identitySubstitution{
+			substitution:   &core.Substitution{Prefix: "arn:", Literal: identity.Partition, Suffix: ":"},
+			dataSourceType: "aws_partition",
+			attribute:      "partition",
+		})
+	}
+
+	return substitutions
+}
+
+// TemplateIdentity decides which substitutions to make in the values of each resource which are not links, and
+// returns the data sources those substitutions refer to in a stable order. Resources are only templated if their
+// identity is known.
+func TemplateIdentity(allResources map[string][]*ImportedResource, syntax core.Syntax) []*core.Resource {
+	byAddress := make(map[string]*core.Resource)
+	var dataSources []*core.Resource
+
+	// Each provider reads its own account, region and partition
+	dataSource := func(resourceType string, provider string) *core.Resource {
+		name := "current"
+		if provider != "" {
+			name += "-" + strings.TrimPrefix(provider, "aws.")
+		}
+
+		if existing, ok := byAddress[resourceType+"."+name]; ok {
+			return existing
+		}
+
+		d := &core.Resource{
+			Type:       resourceType,
+			Name:       name,
+			Provider:   provider,
+			DataSource: true,
+			Fields:     &core.InlineResource{},
+		}
+
+		// Versions of the AWS provider used with Terraform 0.11 look up every region unless asked for the current one
+		if resourceType == "aws_region" && syntax == core.HCL1 {
+			d.Fields.Append(&core.Field{
+				FieldType:   core.SCALAR,
+				Key:         "current",
+				ScalarValue: core.NewScalarValue("true", core.TypeBool),
+			})
+		}
+
+		byAddress[resourceType+"."+name] = d
+		dataSources = append(dataSources, d)
+		return d
+	}
+
+	for _, resourceType := range SortedTypes(allResources) {
+		for _, importedResource := range allResources[resourceType] {
+			if importedResource.identity == nil {
+				continue
+			}
+
+			// Policy documents are printed with the same substitutions as the resource they belong to
+			values := unlinkedValues(importedResource.resource.Fields)
+			for _, document := range importedResource.policyDocuments {
+				values = append(values, unlinkedValues(document.Fields)...)
+			}
+			for _, candidate := range identitySubstitutions(importedResource.identity) {
+				if !containsAny(candidate.substitution, values) {
+					continue
+				}
+
+				d := dataSource(candidate.dataSourceType, importedResource.resource.Provider)
+				candidate.substitution.Expression = d.Address() + "." + candidate.attribute
+				importedResource.substitutions = append(importedResource.substitutions, candidate.substitution)
+			}
+		}
+	}
+
+	sort.SliceStable(dataSources, func(i, j int) bool {
+		if dataSources[i].Type != dataSources[j].Type {
+			return dataSources[i].Type < dataSources[j].Type
+		}
+		return dataSources[i].Name < dataSources[j].Name
+	})
+	return dataSources
+}
+
+// Every string value in r which the printer would write literally.
+func unlinkedValues(r *core.InlineResource) []string {
+	var values []string
+	for _, f := range r.Fields {
+		if f.Computed || f.Link != "" {
+			continue
+		}
+
+		if f.FieldType == core.SCALAR {
+			values = append(values, f.ScalarValue.StringValue)
+			continue
+		}
+
+		if f.NestedValue != nil {
+			values = append(values, unlinkedValues(f.NestedValue)...)
+		}
+	}
+	return values
+}
+
+func containsAny(substitution *core.Substitution, values []string) bool {
+	for _, value := range values {
+		if substitution.Contains(value) {
+			return true
+		}
+	}
+	return false
+}
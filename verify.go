@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/config/configschema"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/jmcgill/formation/core"
+)
+
+// Once configuration has been written, every file is parsed again and each resource is decoded against its schema,
+// then compared with the state it was printed from. A resource which does not read back as its state would be
+// changed by the next plan, so each attribute which differs is reported. Nothing is rewritten.
+//
+// The verify command goes further, and asks the provider to diff the configuration of each resource against its
+// refreshed state, as terraform plan would. This happens entirely offline, so it catches missing defaults and
+// computed fields which were printed without needing credentials for the account.
+
+// Read back every file written by writeConfig, and return each resource decoded from them by address. Files and
+// resources which cannot be read back are reported, and counted in the number returned.
+func readConfig(filenames []string, syntax core.Syntax, provider *schema.Provider) (map[string]*core.ConfigResource, int) {
+	reader := &core.ConfigReader{
+		Syntax: syntax,
+		Schema: configSchemas(provider),
+	}
+
+	configs := make(map[string]*core.ConfigResource)
+	failed := 0
+	for _, filename := range filenames {
+		src, err := ioutil.ReadFile(filename)
+		if err != nil {
+			fmt.Printf("*** Cannot read back %s: %s\n", filename, err)
+			failed++
+			continue
+		}
+
+		resources, err := reader.Read(filename, src)
+		if err != nil {
+			fmt.Printf("*** Cannot parse %s: %s\n", filename, err)
+			failed++
+			continue
+		}
+
+		for _, resource := range resources {
+			if resource.Err != nil {
+				fmt.Printf("*** Cannot decode %s: %s\n", resource.Address(), resource.Err)
+				failed++
+				continue
+			}
+			configs[resource.Address()] = resource
+		}
+	}
+	return configs, failed
+}
+
+// Report each resource whose configuration does not match its state. Returns the number of resources reported,
+// including those which could not be read back at all.
+func verifyConfig(configs map[string]*core.ConfigResource, failed int, allResources map[string][]*ImportedResource) int {
+	for _, resourceType := range SortedTypes(allResources) {
+		for _, importedResource := range allResources[resourceType] {
+			// Resources without a schema are not decoded
+			resource, ok := configs[importedResource.resource.Address()]
+			if !ok || resource.Config == nil {
+				continue
+			}
+
+			differences := core.Verify(resource, importedResource.state, importedResource.schema)
+			for _, difference := range differences {
+				fmt.Printf("*** %s does not match its state: %s\n", resource.Address(), difference)
+			}
+			if len(differences) > 0 {
+				failed++
+			}
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("*** %d resources in the generated configuration do not match their state\n", failed)
+	}
+	return failed
+}
+
+// Diff the configuration of every resource against its refreshed state, and report every attribute which would
+// change, grouped by importer. Returns the number of resources which would change.
+func diffConfig(configs map[string]*core.ConfigResource, provider *schema.Provider, allResources map[string][]*ImportedResource) int {
+	changed := 0
+	for _, resourceType := range SortedTypes(allResources) {
+		resources := allResources[resourceType]
+
+		var lines []string
+		resourcesChanged := 0
+		for _, importedResource := range resources {
+			resource, ok := configs[importedResource.resource.Address()]
+			if !ok || resource.Config == nil {
+				continue
+			}
+
+			changes, err := diffResource(provider, importedResource, resource)
+			if err != nil {
+				changes = []string{fmt.Sprintf("cannot be diffed: %s", err)}
+			}
+
+			for _, change := range changes {
+				lines = append(lines, resource.Address()+": "+change)
+			}
+			if len(changes) > 0 {
+				resourcesChanged++
+			}
+		}
+
+		if resourcesChanged == 0 {
+			continue
+		}
+
+		fmt.Printf("*** %s: %d of %d resources would change\n", resourceType, resourcesChanged, len(resources))
+		for _, line := range lines {
+			fmt.Printf("    %s\n", line)
+		}
+		changed += resourcesChanged
+	}
+
+	if changed == 0 {
+		fmt.Printf("*** No changes. The generated configuration matches the refreshed state of every resource\n")
+	}
+	return changed
+}
+
+// Ask the provider to diff one resource, and describe each attribute which would change in the same way as
+// terraform plan. Attributes which would only change because their configuration refers to something unknown are
+// left out, as they cannot be checked offline, as are attributes whose changes the resource ignores. Any other
+// attribute which would become computed is reported, e.g. one which was left out of configuration.
+func diffResource(provider *schema.Provider, importedResource *ImportedResource, resource *core.ConfigResource) (changes []string, err error) {
+	// The provider is never configured, and some CustomizeDiff functions expect it to be
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("the provider panicked: %v", r)
+		}
+	}()
+
+	state := importedResource.refreshed
+	if state == nil {
+		state = importedResource.state
+	}
+
+	info := &terraform.InstanceInfo{
+		Id:   resource.Address(),
+		Type: resource.Type,
+	}
+	config := resource.ResourceConfig()
+	diff, err := provider.Diff(info, state.DeepCopy(), config)
+	if err != nil || diff == nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(diff.Attributes))
+	for key := range diff.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		attribute := diff.Attributes[key]
+		if attribute.Old == attribute.New && !attribute.NewRemoved {
+			continue
+		}
+		if attribute.NewComputed && unknown(key, config.ComputedKeys) {
+			continue
+		}
+		if ignored(key, importedResource.resource.IgnoreChanges) {
+			continue
+		}
+
+		change := fmt.Sprintf("%s: %q => %q", key, attribute.Old, attribute.New)
+		if attribute.NewRemoved {
+			change = fmt.Sprintf("%s: %q => <removed>", key, attribute.Old)
+		}
+		if attribute.RequiresNew {
+			change += " (forces new resource)"
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// Whether the attribute key in a diff is unknown because of the configuration: it is one of computedKeys, is held by
+// one of them, or is the count of a collection which holds one of them. Set elements are keyed by hash in a diff but
+// by position in configuration, so any two element keys are taken to match.
+func unknown(key string, computedKeys []string) bool {
+	segments := strings.Split(key, ".")
+	last := segments[len(segments)-1]
+	collection := last == "#" || last == "%"
+
+	for _, computed := range computedKeys {
+		computedSegments := strings.Split(computed, ".")
+		if collection && hasPathPrefix(computedSegments, segments[:len(segments)-1]) {
+			return true
+		}
+		if !collection && hasPathPrefix(segments, computedSegments) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPathPrefix(segments []string, prefix []string) bool {
+	if len(prefix) > len(segments) {
+		return false
+	}
+	for i := range prefix {
+		if segments[i] != prefix[i] && !(isElementKey(segments[i]) && isElementKey(prefix[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Lists are keyed by index, and sets by hash, which is prefixed with ~ when the element is partly unknown
+func isElementKey(segment string) bool {
+	segment = strings.TrimPrefix(segment, "~")
+	if segment == "" {
+		return false
+	}
+	for _, c := range segment {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// As in Terraform 0.11, ignoring an attribute also ignores everything nested inside it.
+func ignored(key string, ignoreChanges []string) bool {
+	for _, attribute := range ignoreChanges {
+		if key == attribute || strings.HasPrefix(key, attribute+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Look up the schema of each resource and data source type, building it only once.
+func configSchemas(provider *schema.Provider) func(string, bool) *configschema.Block {
+	schemas := make(map[string]*configschema.Block)
+	return func(resourceType string, dataSource bool) *configschema.Block {
+		key := resourceType
+		if dataSource {
+			key = "data." + resourceType
+		}
+
+		if s, ok := schemas[key]; ok {
+			return s
+		}
+
+		var s *configschema.Block
+		if dataSource {
+			if r, ok := provider.DataSourcesMap[resourceType]; ok {
+				s = r.CoreConfigSchema()
+			}
+		} else if r, ok := provider.ResourcesMap[resourceType]; ok {
+			s = r.CoreConfigSchema()
+		}
+		schemas[key] = s
+		return s
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/jmcgill/formation/core"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("diffResource", func() {
+	provider := &schema.Provider{
+		ResourcesMap: map[string]*schema.Resource{
+			"aws_thing": {
+				Schema: map[string]*schema.Schema{
+					"name":   {Type: schema.TypeString, Optional: true},
+					"target": {Type: schema.TypeString, Optional: true},
+					"arn":    {Type: schema.TypeString, Computed: true},
+				},
+				CustomizeDiff: func(d *schema.ResourceDiff, meta interface{}) error {
+					// As providers do when a change to one attribute changes another
+					if d.HasChange("name") {
+						return d.SetNewComputed("arn")
+					}
+					return nil
+				},
+			},
+		},
+	}
+
+	imported := &ImportedResource{
+		resource: testResource("aws_thing", "main", nil),
+		refreshed: &terraform.InstanceState{
+			ID:         "thing-1",
+			Attributes: map[string]string{"id": "thing-1", "name": "main", "target": "vpc-1", "arn": "arn:thing-1"},
+		},
+	}
+
+	It("should leave out attributes which refer to something unknown", func() {
+		changes, err := diffResource(provider, imported, &core.ConfigResource{
+			Type:   "aws_thing",
+			Name:   "main",
+			Config: map[string]interface{}{"name": "main", "target": config.UnknownVariableValue},
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(changes).To(BeEmpty())
+	})
+
+	It("should report computed attributes which do not refer to anything unknown", func() {
+		changes, err := diffResource(provider, imported, &core.ConfigResource{
+			Type:   "aws_thing",
+			Name:   "main",
+			Config: map[string]interface{}{"name": "renamed", "target": "vpc-1"},
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(changes).To(Equal([]string{`arn: "arn:thing-1" => ""`, `name: "main" => "renamed"`}))
+	})
+})
+
+var _ = Describe("unknown", func() {
+	cases := []struct {
+		key          string
+		computedKeys []string
+		unknown      bool
+	}{
+		{"vpc_id", []string{"vpc_id"}, true},
+		{"vpc_id", []string{"subnet_id"}, false},
+		{"vpc_id", nil, false},
+		{"ingress.0.cidr_blocks", []string{"ingress.0"}, true},
+		{"ingress.0.cidr_blocks", []string{"ingress.0.cidr_blocks.1"}, false},
+		{"security_groups.#", []string{"security_groups.1"}, true},
+		{"tags.%", []string{"tags.Name"}, true},
+		{"tags.%", []string{"tag_specifications.0"}, false},
+		{"ingress.~1234.security_groups", []string{"ingress.0.security_groups"}, true},
+		{"ingress.1234.security_groups", []string{"ingress.0.security_groups"}, true},
+		{"ingress.1234.self", []string{"ingress.0.security_groups"}, false},
+		{"name_prefix", []string{"name"}, false},
+	}
+
+	for _, c := range cases {
+		c := c
+		It("should decide whether "+c.key+" is unknown", func() {
+			Expect(unknown(c.key, c.computedKeys)).To(Equal(c.unknown))
+		})
+	}
+})